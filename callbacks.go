@@ -1,6 +1,8 @@
 package torrent
 
 import (
+	"time"
+
 	"github.com/anacrolix/torrent/mse"
 	pp "github.com/anacrolix/torrent/peer_protocol"
 )
@@ -38,8 +40,39 @@ type Callbacks struct {
 	// Sends status event updates. Useful to inform the user of specific events as they happen,
 	// for logging or to action on.
 	StatusUpdated []func(StatusUpdatedEvent)
+
+	// Called with the Client lock held when a complete piece fails a hash check by scrubbing or
+	// verification on read. The piece is then queued for a hash check, which marks it not complete
+	// and queues it for download if it fails again.
+	PieceCorrupted []func(PieceCorruptedEvent)
+
+	// Called with the Client lock held when a deadline set with Torrent.SetPieceDeadline passes
+	// before the piece completes.
+	PieceDeadlineMissed []func(PieceDeadlineMissedEvent)
 }
 
+type PieceCorruptedEvent struct {
+	Torrent *Torrent
+	Piece   int
+	Source  PieceCorruptionSource
+	// Set if the piece data couldn't be read.
+	Err error
+}
+
+type PieceDeadlineMissedEvent struct {
+	Torrent  *Torrent
+	Piece    int
+	Deadline time.Time
+}
+
+// What found a complete piece to be corrupt.
+type PieceCorruptionSource string
+
+const (
+	PieceCorruptionScrub      PieceCorruptionSource = "scrub"
+	PieceCorruptionUploadRead PieceCorruptionSource = "upload read"
+)
+
 type ReceivedUsefulDataEvent = PeerMessageEvent
 
 type PeerMessageEvent struct {
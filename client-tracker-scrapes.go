@@ -0,0 +1,189 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	g "github.com/anacrolix/generics"
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent/tracker"
+	"github.com/anacrolix/torrent/tracker/udp"
+	"github.com/anacrolix/torrent/types/infohash"
+)
+
+// How often we check for trackers that are due to be scraped.
+const trackerScrapeCheckInterval = 10 * time.Second
+
+type trackerScrapeState struct {
+	// Don't scrape the tracker again before this.
+	next    time.Time
+	running bool
+}
+
+type trackerScrapeResult struct {
+	Seeders   int32
+	Leechers  int32
+	Completed int32
+	Time      time.Time
+	Err       error
+}
+
+func (cl *Client) scrapeTrackersPeriodically() {
+	ticker := time.NewTicker(min(cl.config.TrackerScrapeInterval, trackerScrapeCheckInterval))
+	defer ticker.Stop()
+	for {
+		cl.startDueTrackerScrapes()
+		select {
+		case <-cl.closed.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Calls f for every trackerScraper that announces for the Torrent, including those in tiers.
+// Call with the Client lock held.
+func (t *Torrent) eachTrackerScraper(f func(*trackerScraper)) {
+	for _, ta := range t.trackerAnnouncers {
+		switch ta := ta.(type) {
+		case *trackerScraper:
+			f(ta)
+		case *trackerTierAnnouncer:
+			for _, e := range ta.entries {
+				for _, s := range e.scrapers {
+					f(s)
+				}
+			}
+		}
+	}
+}
+
+// Starts scrapes for trackers used by any Torrent that aren't waiting out their interval.
+func (cl *Client) startDueTrackerScrapes() {
+	cl.lock()
+	defer cl.unlock()
+	if cl.closed.IsSet() {
+		return
+	}
+	byTracker := make(map[string][]*trackerScraper)
+	for t := range cl.torrents {
+		t.eachTrackerScraper(func(ts *trackerScraper) {
+			key := ts.u.String()
+			byTracker[key] = append(byTracker[key], ts)
+		})
+	}
+	// Forget trackers that are no longer in use.
+	for key, state := range cl.trackerScrapes {
+		if _, ok := byTracker[key]; !ok && !state.running {
+			delete(cl.trackerScrapes, key)
+		}
+	}
+	now := time.Now()
+	for key, scrapers := range byTracker {
+		g.MakeMapIfNil(&cl.trackerScrapes)
+		state, ok := cl.trackerScrapes[key]
+		if !ok {
+			state = &trackerScrapeState{}
+			cl.trackerScrapes[key] = state
+		}
+		if state.running || now.Before(state.next) {
+			continue
+		}
+		state.running = true
+		go cl.scrapeTracker(state, scrapers)
+	}
+}
+
+// Scrapes the infohashes for all the given scrapers, which share a tracker URL, in batches.
+func (cl *Client) scrapeTracker(state *trackerScrapeState, scrapers []*trackerScraper) {
+	interval := cl.config.TrackerScrapeInterval
+	defer func() {
+		cl.lock()
+		defer cl.unlock()
+		state.running = false
+		state.next = time.Now().Add(interval)
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-cl.closed.Done():
+			cancel()
+		}
+	}()
+	for batch := range slices.Chunk(scrapers, udp.MaxScrapeInfoHashes) {
+		res, err := scrapers[0].scrape(ctx, batch)
+		now := time.Now()
+		cl.lock()
+		for i, ts := range batch {
+			ts.lastScrape = trackerScrapeResult{
+				Time: now,
+				Err:  err,
+			}
+			if err != nil {
+				continue
+			}
+			if i >= len(res.Files) {
+				ts.lastScrape.Err = errors.New("no result from tracker")
+				continue
+			}
+			f := res.Files[i]
+			ts.lastScrape.Seeders = f.Seeders
+			ts.lastScrape.Leechers = f.Leechers
+			ts.lastScrape.Completed = f.Completed
+		}
+		cl.unlock()
+		interval = max(interval, res.MinRequestInterval)
+		if err != nil {
+			cl.logger.Levelf(log.Debug, "error scraping %q: %v", scrapers[0].u.String(), err)
+			return
+		}
+	}
+}
+
+// Scrapes the tracker for the infohashes of batch, which must all share this scraper's tracker.
+func (me *trackerScraper) scrape(ctx context.Context, batch []*trackerScraper) (res tracker.ScrapeResponse, err error) {
+	// Limit concurrent use of the same tracker URL by the Client.
+	ref := me.t.cl.activeAnnounceLimiter.GetRef(me.u.String())
+	defer ref.Drop()
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+		return
+	case ref.C() <- struct{}{}:
+	}
+	defer func() {
+		<-ref.C()
+	}()
+	ip, err := me.getIp()
+	if err != nil {
+		err = fmt.Errorf("error getting ip: %s", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, tracker.DefaultTrackerAnnounceTimeout)
+	defer cancel()
+	cfg := me.t.cl.config
+	res, err = tracker.Scrape{
+		Context:             ctx,
+		TrackerUrl:          me.trackerUrl(ip),
+		InfoHashes:          g.SliceMap(batch, func(ts *trackerScraper) infohash.T { return ts.shortInfohash }),
+		HostHeader:          me.u.Host,
+		ServerName:          me.u.Hostname(),
+		HttpProxy:           cfg.HTTPProxy,
+		HttpRequestDirector: cfg.HttpRequestDirector,
+		DialContext:         cfg.TrackerDialContext,
+		ListenPacket:        cfg.TrackerListenPacket,
+		UserAgent:           cfg.HTTPUserAgent,
+		UdpNetwork:          me.u.Scheme,
+		Logger:              me.t.logger,
+	}.Do()
+	if err != nil {
+		err = fmt.Errorf("scraping: %w", err)
+	}
+	return
+}
@@ -0,0 +1,73 @@
+package torrent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/internal/testutil"
+	httpTracker "github.com/anacrolix/torrent/tracker/http"
+	"github.com/anacrolix/torrent/tracker/udp"
+)
+
+func TestClientTrackerScrapes(t *testing.T) {
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	scrapes := make(chan []string, 10)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/announce", func(w http.ResponseWriter, r *http.Request) {
+		bencode.NewEncoder(w).Encode(httpTracker.HttpResponse{Interval: 1800})
+	})
+	mux.HandleFunc("/scrape", func(w http.ResponseWriter, r *http.Request) {
+		ihs := r.URL.Query()["info_hash"]
+		scrapes <- ihs
+		files := make(map[string]udp.ScrapeInfohashResult)
+		for _, ih := range ihs {
+			files[ih] = udp.ScrapeInfohashResult{Seeders: 3, Leechers: 2, Completed: 7}
+		}
+		bencode.NewEncoder(w).Encode(map[string]any{
+			"files": files,
+			"flags": map[string]any{"min_request_interval": 3600},
+		})
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = false
+	cfg.TrackerScrapeInterval = 100 * time.Millisecond
+	cl, err := NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	mi.AnnounceList = [][]string{{s.URL + "/announce"}}
+	tor, err := cl.AddTorrent(mi)
+	qt.Assert(t, qt.IsNil(err))
+
+	select {
+	case ihs := <-scrapes:
+		qt.Check(t, qt.DeepEquals(ihs, []string{tor.InfoHash().AsString()}))
+	case <-time.After(10 * time.Second):
+		t.Fatal("tracker wasn't scraped")
+	}
+	for {
+		statuses := tor.TrackerStatuses()
+		qt.Assert(t, qt.HasLen(statuses, 1))
+		if !statuses[0].LastScrape.IsZero() {
+			qt.Check(t, qt.IsNil(statuses[0].LastScrapeError))
+			qt.Check(t, qt.Equals(statuses[0].Completed, 7))
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// The tracker's min_request_interval holds off further scrapes.
+	select {
+	case <-scrapes:
+		t.Fatal("tracker scraped again before min_request_interval")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
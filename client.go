@@ -106,6 +106,8 @@ type Client struct {
 	numWebSeedRequests map[webseedHostKeyHandle]int
 
 	activeAnnounceLimiter limiter.Instance
+	// Scrape scheduling per tracker URL.
+	trackerScrapes map[string]*trackerScrapeState
 	// TODO: Move this onto ClientConfig.
 	httpClient *http.Client
 
@@ -419,6 +421,9 @@ func NewClient(cfg *ClientConfig) (cl *Client, err error) {
 	}
 
 	go cl.forwardPort()
+	if !cfg.DisableTrackers && cfg.TrackerScrapeInterval > 0 {
+		go cl.scrapeTrackersPeriodically()
+	}
 	if !cfg.NoDHT {
 		for _, s := range sockets {
 			if pc, ok := s.(net.PacketConn); ok {
@@ -518,12 +523,29 @@ func (cl *Client) NewAnacrolixDhtServer(conn net.PacketConn) (s *dht.Server, err
 		OnQuery:       cl.config.DHTOnQuery,
 		Logger:        logger,
 	}
+	var nodesCache g.Option[dhtNodesCacheFile]
+	if cl.config.DhtNodesCacheDir != "" {
+		nodesCache.Set(cl.dhtNodesCacheFile(conn))
+		cache, fresh, err := nodesCache.Value.load()
+		if err != nil {
+			logger.Levelf(log.Warning, "error loading dht nodes cache: %v", err)
+		}
+		if fresh && cfg.PublicIP == nil {
+			// With a public IP the node ID is derived from it instead.
+			cfg.NodeId = cache.Id
+		}
+		cfg.StartingNodes = cl.dhtStartingNodesFromCache(
+			conn.LocalAddr().Network(), dhtConnFamily(conn), cache, fresh)
+	}
 	if f := cl.config.ConfigureAnacrolixDhtServer; f != nil {
 		f(&cfg)
 	}
 	s, err = dht.NewServer(&cfg)
 	if err == nil {
 		go s.TableMaintainer()
+		if nodesCache.Ok {
+			cl.saveDhtNodesPeriodically(s, nodesCache.Value)
+		}
 	}
 	return
 }
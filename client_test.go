@@ -908,3 +908,20 @@ func TestClientConfigSetHandlerNotIgnored(t *testing.T) {
 	h := cl.logger.Handlers[0].(log.StreamHandler)
 	qt.Check(t, qt.Equals(h.W, io.Discard))
 }
+
+func TestVerifyDataSkipsMissingData(t *testing.T) {
+	dir, mi := testutil.GreetingTestTorrent()
+	os.RemoveAll(dir)
+	cfg := TestingConfig(t)
+	cl, err := NewClient(cfg)
+	require.NoError(t, err)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(mi)
+	require.NoError(t, err)
+	<-tt.GotInfo()
+	require.NoError(t, tt.VerifyData())
+	stats := tt.Stats()
+	assert.EqualValues(t, 0, stats.BytesHashed.Int64())
+	assert.GreaterOrEqual(t, stats.PiecesHashSkipped.Int64(), int64(tt.NumPieces()))
+	assert.False(t, tt.Complete().Bool())
+}
@@ -130,6 +130,24 @@ func mainErr(ctx context.Context) error {
 		}},
 		bargle.Subcommand{Name: "serve", Command: serve()},
 		bargle.Subcommand{Name: "create", Command: create()},
+		bargle.Subcommand{Name: "serve-http", Command: func() bargle.Command {
+			var shc ServeHttpCmd
+			cmd := bargle.FromStruct(&shc)
+			cmd.Desc = "streams torrent files over HTTP with range requests"
+			cmd.DefaultAction = func() error {
+				return serveHttp(ctx, shc)
+			}
+			return cmd
+		}()},
+		bargle.Subcommand{Name: "serve-webdav", Command: func() bargle.Command {
+			var swc ServeWebdavCmd
+			cmd := bargle.FromStruct(&swc)
+			cmd.Desc = "exposes torrents as a WebDAV filesystem"
+			cmd.DefaultAction = func() error {
+				return serveWebdav(ctx, swc)
+			}
+			return cmd
+		}()},
 	)
 	// Well this sux, this old version of bargle doesn't return so we can let the gostdapp Context
 	// clean up.
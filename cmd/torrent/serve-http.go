@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/httpserver"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+type ServeHttpCmd struct {
+	Addr        string `default:"localhost:8080" help:"HTTP listen addr"`
+	DataDir     string `help:"directory to store torrent data in"`
+	AddOnDemand bool   `help:"add torrents when they're requested by infohash, and allow adding magnet links"`
+	Responsive  bool   `help:"serve data before pieces are verified"`
+	Seed        bool   `help:"upload to peers"`
+
+	Torrent []string `help:"torrent file path, magnet uri or infohash:<hex> to add on startup, repeatable"`
+}
+
+// Options common to commands that serve a Client's torrents over HTTP.
+type serveClientOpts struct {
+	Addr    string
+	DataDir string
+	Seed    bool
+	Torrent []string
+}
+
+func serveHttp(ctx context.Context, cmd ServeHttpCmd) error {
+	opts := serveClientOpts{cmd.Addr, cmd.DataDir, cmd.Seed, cmd.Torrent}
+	return serveClient(ctx, opts, func(cl *torrent.Client) http.Handler {
+		return httpserver.New(cl, httpserver.Options{
+			AddOnDemand: cmd.AddOnDemand,
+			Responsive:  cmd.Responsive,
+		})
+	})
+}
+
+// Runs a Client with the torrents given, and serves the handler for it until the context is done.
+func serveClient(
+	ctx context.Context,
+	opts serveClientOpts,
+	handler func(*torrent.Client) http.Handler,
+) error {
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.Seed = opts.Seed
+	if opts.DataDir != "" {
+		cfg.DataDir = opts.DataDir
+	}
+	cl, err := torrent.NewClient(cfg)
+	if err != nil {
+		return fmt.Errorf("new torrent client: %w", err)
+	}
+	defer cl.Close()
+	for _, arg := range opts.Torrent {
+		t, err := addTorrentArg(cl, arg)
+		if err != nil {
+			return fmt.Errorf("adding torrent for %q: %w", arg, err)
+		}
+		log.Printf("added %v", t.InfoHash().HexString())
+	}
+	l, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("serving http at http://%v/", l.Addr())
+	srv := http.Server{
+		Handler: handler(cl),
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	err = srv.Serve(l)
+	if errors.Is(err, http.ErrServerClosed) {
+		err = ctx.Err()
+	}
+	return err
+}
+
+func addTorrentArg(cl *torrent.Client, arg string) (*torrent.Torrent, error) {
+	if strings.HasPrefix(arg, "magnet:") {
+		return cl.AddMagnet(arg)
+	}
+	if ihHex, ok := strings.CutPrefix(arg, "infohash:"); ok {
+		var ih metainfo.Hash
+		err := ih.FromHexString(ihHex)
+		if err != nil {
+			return nil, err
+		}
+		t, _ := cl.AddTorrentInfoHash(ih)
+		return t, nil
+	}
+	mi, err := metainfo.LoadFromFile(arg)
+	if err != nil {
+		return nil, fmt.Errorf("loading torrent file: %w", err)
+	}
+	return cl.AddTorrent(mi)
+}
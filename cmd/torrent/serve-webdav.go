@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/webdavfs"
+)
+
+type ServeWebdavCmd struct {
+	Addr     string `default:"localhost:8080" help:"HTTP listen addr"`
+	DataDir  string `help:"directory to store torrent data in"`
+	Writable bool   `help:"allow adding torrents by writing .torrent and .magnet files, and dropping them by deleting them"`
+	Seed     bool   `help:"upload to peers"`
+
+	Torrent []string `help:"torrent file path, magnet uri or infohash:<hex> to add on startup, repeatable"`
+}
+
+func serveWebdav(ctx context.Context, cmd ServeWebdavCmd) error {
+	opts := serveClientOpts{cmd.Addr, cmd.DataDir, cmd.Seed, cmd.Torrent}
+	return serveClient(ctx, opts, func(cl *torrent.Client) http.Handler {
+		return webdavfs.New(cl, webdavfs.Options{Writable: cmd.Writable}).Handler()
+	})
+}
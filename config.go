@@ -36,6 +36,14 @@ type ClientTrackerConfig struct {
 	// Takes a tracker's hostname and requests DNS A and AAAA records.
 	// Used in case DNS lookups require a special setup (i.e., dns-over-https)
 	LookupTrackerIp func(*url.URL) ([]net.IP, error)
+	// Announce as described in BEP 12: trackers are shuffled within each announce-list tier, and
+	// only the first working tracker in each tier is announced to. Trackers that respond are moved
+	// to the front of their tier. By default every tracker is announced to independently.
+	TieredTrackerAnnouncing bool
+	// If non-zero, trackers are scraped for all of the Client's torrents at this interval, or at
+	// the tracker's min_request_interval if that's longer. Infohashes are batched per tracker. The
+	// results are reported in Torrent.TrackerStatuses.
+	TrackerScrapeInterval time.Duration
 }
 
 type ClientDhtConfig struct {
@@ -47,6 +55,12 @@ type ClientDhtConfig struct {
 	PeriodicallyAnnounceTorrentsToDht bool
 	// OnQuery hook func
 	DHTOnQuery func(query *krpc.Msg, source net.Addr) (propagate bool)
+	// If set, the node ID and good nodes of each DHT server created by the Client are saved in this
+	// directory periodically and on close. They're used instead of DhtStartingNodes the next time a
+	// server is created for the same network, unless they're older than DhtNodesCacheMaxAge.
+	DhtNodesCacheDir string
+	// Defaults to a day if zero.
+	DhtNodesCacheMaxAge time.Duration
 }
 
 // Probably not safe to modify this after it's given to a Client, or to pass it to multiple Clients.
@@ -73,6 +87,9 @@ type ClientConfig struct {
 	// Upload even after there's nothing in it for us. By default uploading is
 	// not altruistic, we'll only upload to encourage the peer to reciprocate.
 	Seed bool `long:"seed"`
+	// Don't send chunks stored in files directly from the file to unencrypted TCP connections. The
+	// zero-copy path is only used on Linux, where it uses sendfile.
+	DisableZeroCopyUploads bool
 	// Only applies to chunks uploaded to peers, to maintain responsiveness communicating local
 	// Client state to peers. Each limiter token represents one byte. The Limiter's burst must be
 	// large enough to fit a whole chunk, which is usually 16 KiB (see TorrentSpec.ChunkSize). If
@@ -206,6 +223,17 @@ type ClientConfig struct {
 	DialRateLimiter *rate.Limiter
 
 	PieceHashersPerTorrent int // default: 2
+
+	// Re-hash each torrent's complete pieces this often to detect data that has gone bad in
+	// storage. Scrubbing reads at idle I/O priority where supported. Not done if zero.
+	ScrubInterval time.Duration
+	// Limits the bytes read per second for scrubbing across all torrents. Unlimited if nil. If the
+	// limit is not Inf and the burst is 0, the implementation chooses a suitable burst.
+	ScrubRateLimiter *rate.Limiter
+	// Hash pieces before uploading data from them. A piece is rehashed if it hasn't been verified
+	// for upload in the last minute, so this adds a whole piece read to uploads from seldom used
+	// pieces.
+	VerifyOnRead bool
 }
 
 func (cfg *ClientConfig) SetListenAddr(addr string) *ClientConfig {
@@ -273,6 +301,9 @@ func (cfg *ClientConfig) setRateLimiterBursts() {
 		cfg.UploadRateLimiter.SetBurst(cfg.MaxAllocPeerRequestDataPerConn)
 	}
 	setDefaultDownloadRateLimiterBurstIfZero(cfg.DownloadRateLimiter)
+	if cfg.ScrubRateLimiter != nil && cfg.ScrubRateLimiter.Limit() != rate.Inf && cfg.ScrubRateLimiter.Burst() == 0 {
+		cfg.ScrubRateLimiter.SetBurst(1 << 20)
+	}
 }
 
 // Returns the download rate.Limit handling the special nil case.
@@ -45,11 +45,15 @@ func (cs *ConnStats) wroteMsg(msg *pp.Message) {
 	// TODO: Track messages and not just chunks.
 	switch msg.Type {
 	case pp.Piece:
-		cs.ChunksWritten.Add(1)
-		cs.BytesWrittenData.Add(int64(len(msg.Piece)))
+		cs.wroteChunk(int64(len(msg.Piece)))
 	}
 }
 
+func (cs *ConnStats) wroteChunk(size int64) {
+	cs.ChunksWritten.Add(1)
+	cs.BytesWrittenData.Add(size)
+}
+
 func (cs *ConnStats) receivedChunk(size int64) {
 	cs.ChunksRead.Add(1)
 	cs.BytesReadData.Add(size)
@@ -0,0 +1,161 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/krpc"
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// How often good nodes are saved for DHT servers with a nodes cache.
+const dhtNodesCacheSaveInterval = 5 * time.Minute
+
+// Used if ClientDhtConfig.DhtNodesCacheMaxAge is zero.
+const defaultDhtNodesCacheMaxAge = 24 * time.Hour
+
+// What's saved for each DHT server.
+type dhtNodesCache struct {
+	Id    krpc.ID                  `bencode:"id"`
+	Nodes krpc.CompactIPv6NodeInfo `bencode:"nodes"`
+	Saved int64                    `bencode:"saved"`
+}
+
+// A DHT server's nodes cache on disk.
+type dhtNodesCacheFile struct {
+	path   string
+	maxAge time.Duration
+}
+
+// Returns "udp4" or "udp6" for the address family a DHT server's conn is bound to. The conn's
+// Network is "udp" for both.
+func dhtConnFamily(conn net.PacketConn) string {
+	udpAddr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return conn.LocalAddr().Network()
+	}
+	if udpAddr.IP.To4() != nil {
+		return "udp4"
+	}
+	return "udp6"
+}
+
+func (cl *Client) dhtNodesCacheFile(conn net.PacketConn) dhtNodesCacheFile {
+	name := dhtConnFamily(conn)
+	if udpAddr, ok := conn.LocalAddr().(*net.UDPAddr); ok && !udpAddr.IP.IsUnspecified() {
+		name += "-" + strings.NewReplacer(":", "_", "%", "_").Replace(udpAddr.IP.String())
+	}
+	maxAge := cl.config.DhtNodesCacheMaxAge
+	if maxAge == 0 {
+		maxAge = defaultDhtNodesCacheMaxAge
+	}
+	return dhtNodesCacheFile{
+		path:   filepath.Join(cl.config.DhtNodesCacheDir, "dht-nodes-"+name),
+		maxAge: maxAge,
+	}
+}
+
+// Returns the cache if it exists, and isn't stale.
+func (me dhtNodesCacheFile) load() (ret dhtNodesCache, ok bool, err error) {
+	b, err := os.ReadFile(me.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	err = bencode.Unmarshal(b, &ret)
+	if err != nil {
+		err = fmt.Errorf("decoding %q: %w", me.path, err)
+		return
+	}
+	ok = time.Since(time.Unix(ret.Saved, 0)) < me.maxAge
+	return
+}
+
+func (me dhtNodesCacheFile) save(s *dht.Server) error {
+	nodes := s.Nodes()
+	if len(nodes) == 0 {
+		// Don't throw away a previous cache because we haven't found any nodes yet.
+		return nil
+	}
+	b, err := bencode.Marshal(dhtNodesCache{
+		Id:    s.ID(),
+		Nodes: nodes,
+		Saved: time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(me.path), 0o750)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file and rename so a crash doesn't leave a truncated cache.
+	tmp := me.path + ".tmp"
+	err = os.WriteFile(tmp, b, 0o640)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, me.path)
+}
+
+// Returns cached nodes in the family, per dhtConnFamily, if the cache is fresh, falling back on the
+// configured starting nodes for the network otherwise.
+func (cl *Client) dhtStartingNodesFromCache(
+	network, family string, cache dhtNodesCache, fresh bool,
+) dht.StartingNodesGetter {
+	fallback := cl.config.DhtStartingNodes(network)
+	return func() ([]dht.Addr, error) {
+		var addrs []dht.Addr
+		if fresh {
+			for _, ni := range cache.Nodes {
+				udpAddr := ni.Addr.UDP()
+				if strings.HasSuffix(family, "4") && udpAddr.IP.To4() == nil {
+					continue
+				}
+				if strings.HasSuffix(family, "6") && udpAddr.IP.To4() != nil {
+					continue
+				}
+				addrs = append(addrs, dht.NewAddr(udpAddr))
+			}
+		}
+		if len(addrs) != 0 {
+			return addrs, nil
+		}
+		return fallback()
+	}
+}
+
+// Periodically saves the server's good nodes until the Client is closed, and again when it is.
+func (cl *Client) saveDhtNodesPeriodically(s *dht.Server, file dhtNodesCacheFile) {
+	save := func() {
+		err := file.save(s)
+		if err != nil {
+			cl.logger.Levelf(log.Warning, "error saving dht nodes cache: %v", err)
+		}
+	}
+	cl.onClose = append(cl.onClose, save)
+	go func() {
+		ticker := time.NewTicker(dhtNodesCacheSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-cl.closed.Done():
+				return
+			case <-ticker.C:
+				save()
+			}
+		}
+	}()
+}
@@ -0,0 +1,82 @@
+package torrent
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/krpc"
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func TestDhtNodesCache(t *testing.T) {
+	dir := t.TempDir()
+	file := dhtNodesCacheFile{path: filepath.Join(dir, "dht-nodes-udp"), maxAge: time.Hour}
+	_, ok, err := file.load()
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.IsFalse(ok))
+
+	write := func(saved time.Time) dhtNodesCache {
+		cache := dhtNodesCache{
+			Id: krpc.ID{1, 2, 3},
+			Nodes: krpc.CompactIPv6NodeInfo{
+				{ID: krpc.ID{4}, Addr: krpc.NodeAddr{IP: net.ParseIP("1.2.3.4"), Port: 6881}},
+				{ID: krpc.ID{5}, Addr: krpc.NodeAddr{IP: net.ParseIP("2001:db8::1"), Port: 6881}},
+			},
+			Saved: saved.Unix(),
+		}
+		b, err := bencode.Marshal(cache)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.IsNil(os.WriteFile(file.path, b, 0o640)))
+		return cache
+	}
+	want := write(time.Now())
+	cache, ok, err := file.load()
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.IsTrue(ok))
+	qt.Check(t, qt.Equals(cache.Id, want.Id))
+	qt.Check(t, qt.HasLen(cache.Nodes, 2))
+
+	bootstrap := []dht.Addr{dht.NewAddr(&net.UDPAddr{IP: net.ParseIP("9.9.9.9"), Port: 1})}
+	cl := &Client{config: &ClientConfig{}}
+	cl.config.DhtStartingNodes = func(string) dht.StartingNodesGetter {
+		return func() ([]dht.Addr, error) { return bootstrap, nil }
+	}
+	addrs, err := cl.dhtStartingNodesFromCache("udp", "udp4", cache, ok)()
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.HasLen(addrs, 1))
+	qt.Check(t, qt.Equals(addrs[0].String(), "1.2.3.4:6881"))
+	addrs, _ = cl.dhtStartingNodesFromCache("udp", "udp", cache, ok)()
+	qt.Check(t, qt.HasLen(addrs, 2))
+
+	// Stale caches fall back on the configured starting nodes.
+	write(time.Now().Add(-2 * time.Hour))
+	cache, ok, err = file.load()
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.IsFalse(ok))
+	addrs, _ = cl.dhtStartingNodesFromCache("udp", "udp4", cache, ok)()
+	qt.Assert(t, qt.HasLen(addrs, 1))
+	qt.Check(t, qt.Equals(addrs[0].String(), "9.9.9.9:1"))
+}
+
+// Servers on the unspecified addresses of each family don't share a cache.
+func TestDhtNodesCacheFilePerFamily(t *testing.T) {
+	cl := &Client{config: &ClientConfig{}}
+	cl.config.DhtNodesCacheDir = t.TempDir()
+	udp4, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	qt.Assert(t, qt.IsNil(err))
+	defer udp4.Close()
+	udp6, err := net.ListenPacket("udp6", "[::]:0")
+	if err != nil {
+		t.Skipf("no ipv6: %v", err)
+	}
+	defer udp6.Close()
+	qt.Check(t, qt.Equals(dhtConnFamily(udp4), "udp4"))
+	qt.Check(t, qt.Equals(dhtConnFamily(udp6), "udp6"))
+	qt.Check(t, qt.Not(qt.Equals(cl.dhtNodesCacheFile(udp4).path, cl.dhtNodesCacheFile(udp6).path)))
+}
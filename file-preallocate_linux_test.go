@@ -0,0 +1,45 @@
+package torrent
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+	"golang.org/x/sys/unix"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// Returns the disk space allocated to the file.
+func allocatedBytes(t *testing.T, name string) int64 {
+	var st unix.Stat_t
+	qt.Assert(t, qt.IsNil(unix.Stat(name, &st)))
+	return st.Blocks * 512
+}
+
+func TestFileWantedPreallocation(t *testing.T) {
+	const pieceLength = 1 << 16
+	files := []metainfo.FileInfo{
+		{Path: []string{"a"}, Length: pieceLength + 1},
+		{Path: []string{"b"}, Length: 4 * pieceLength},
+	}
+	check := func(t *testing.T, dir string, tt *Torrent) {
+		testWritePiece(t, tt, 0)
+		// This piece is only in b.
+		testWritePiece(t, tt, 3)
+		qt.Check(t, qt.IsTrue(allocatedBytes(t, filepath.Join(dir, "a.part")) >= files[0].Length))
+		qt.Check(t, qt.IsTrue(allocatedBytes(t, filepath.Join(dir, "b.part")) < files[1].Length))
+	}
+	t.Run("Deselected", func(t *testing.T) {
+		dir, tt := testFileWantedTorrent(t, storage.FilePreallocationWanted, pieceLength, files...)
+		tt.Files()[1].SetPriority(PiecePriorityNone)
+		check(t, dir, tt)
+	})
+	t.Run("DeselectedAfterDownloadAll", func(t *testing.T) {
+		dir, tt := testFileWantedTorrent(t, storage.FilePreallocationWanted, pieceLength, files...)
+		tt.DownloadAll()
+		tt.Files()[1].SetPriority(PiecePriorityNone)
+		check(t, dir, tt)
+	})
+}
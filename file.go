@@ -21,6 +21,7 @@ type File struct {
 	displayPath string
 	prio        PiecePriority
 	piecesRoot  g.Option[infohash_v2.T]
+	index       int
 }
 
 func (f *File) String() string {
@@ -188,6 +189,11 @@ func (f *File) NewReader() Reader {
 	return f.t.newReader(f.Offset(), f.Length())
 }
 
+// Returns a ReaderAt for the file's data, for concurrent random access.
+func (f *File) ReaderAt() ReaderAt {
+	return f.t.newReaderAt(f.Offset(), f.Length())
+}
+
 // NewPassiveReader returns a reader that avoids altering piece priorities while consuming data.
 func (f *File) NewPassiveReader() Reader {
 	return f.t.newPassiveReader(f.Offset(), f.Length())
@@ -196,6 +202,9 @@ func (f *File) NewPassiveReader() Reader {
 // Sets the minimum priority for pieces in the File.
 func (f *File) SetPriority(prio PiecePriority) {
 	f.t.cl._mu.internal.Lock() // Use internal lock to bypass deferred actions
+	// Storage is told even if the priority is unchanged, as DownloadAll marks files wanted without
+	// setting it.
+	f.t.setStorageFileWanted(f.index, prio != PiecePriorityNone)
 	if prio != f.prio {
 		f.prio = prio
 		f.t.updatePiecePriorities(f.BeginPieceIndex(), f.EndPieceIndex(), "File.SetPriority")
@@ -203,6 +212,18 @@ func (f *File) SetPriority(prio PiecePriority) {
 	f.t.cl._mu.internal.Unlock() // Use internal unlock to bypass deferred actions
 }
 
+// Tells storage whether the file is wanted.
+func (t *Torrent) setStorageFileWanted(fileIndex int, wanted bool) {
+	if t.storage != nil && t.storage.SetFileWanted != nil {
+		t.storage.SetFileWanted(fileIndex, wanted)
+	}
+}
+
+// Returns the file's index in Torrent.Files, and the info's files.
+func (f *File) Index() int {
+	return f.index
+}
+
 // Returns the priority per File.SetPriority.
 func (f *File) Priority() (prio PiecePriority) {
 	f.t.cl.rLock()
@@ -1,10 +1,17 @@
 package torrent
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/RoaringBitmap/roaring"
+	"github.com/go-quicktest/qt"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
 )
 
 func TestFileExclusivePieces(t *testing.T) {
@@ -116,3 +123,99 @@ func TestFileBytesLeft(t *testing.T) {
 		name: "ThreePiecesCompletedAll",
 	}.Run(t)
 }
+
+// Adds a torrent with the files to a client with file storage, and returns where the torrent's files
+// are.
+func testFileWantedTorrent(
+	t *testing.T, prealloc storage.FilePreallocation, pieceLength int64, files ...metainfo.FileInfo,
+) (
+	dir string, tt *Torrent,
+) {
+	dir = t.TempDir()
+	cfg := TestingConfig(t)
+	ci := storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: storage.NewMapPieceCompletion(),
+		Preallocation:   prealloc,
+	})
+	t.Cleanup(func() { ci.Close() })
+	cfg.DefaultStorage = ci
+	cl, err := NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	t.Cleanup(func() { cl.Close() })
+	info := metainfo.Info{Name: "t", PieceLength: pieceLength, Files: files}
+	info.Pieces = make([]byte, int((info.TotalLength()+pieceLength-1)/pieceLength)*metainfo.HashSize)
+	infoBytes, err := bencode.Marshal(&info)
+	qt.Assert(t, qt.IsNil(err))
+	tt, _ = cl.AddTorrentOpt(AddTorrentOpts{
+		InfoBytes: infoBytes,
+		InfoHash:  metainfo.HashBytes(infoBytes),
+	})
+	<-tt.GotInfo()
+	return filepath.Join(dir, "t"), tt
+}
+
+func testWritePiece(t *testing.T, tt *Torrent, i int) {
+	_, err := tt.Piece(i).Storage().WriteAt(make([]byte, tt.Piece(i).Info().Length()), 0)
+	qt.Assert(t, qt.IsNil(err))
+}
+
+func fileExists(dir, name string) bool {
+	_, err := os.Stat(filepath.Join(dir, name))
+	return err == nil
+}
+
+func TestFileWantedParts(t *testing.T) {
+	files := []metainfo.FileInfo{
+		{Path: []string{"a"}, Length: 6},
+		{Path: []string{"b"}, Length: 4},
+		{Path: []string{"c"}, Length: 6},
+	}
+	writeAll := func(tt *Torrent) {
+		for i := range tt.NumPieces() {
+			testWritePiece(t, tt, i)
+		}
+	}
+	t.Run("Deselected", func(t *testing.T) {
+		dir, tt := testFileWantedTorrent(t, storage.FilePreallocationSparse, 4, files...)
+		tt.Files()[1].SetPriority(PiecePriorityNone)
+		writeAll(tt)
+		qt.Check(t, qt.IsTrue(fileExists(dir, "a.part")))
+		qt.Check(t, qt.IsFalse(fileExists(dir, "b.part")))
+	})
+	// Torrents read through Readers or downloaded by piece don't set file priorities.
+	t.Run("NoPriorities", func(t *testing.T) {
+		dir, tt := testFileWantedTorrent(t, storage.FilePreallocationSparse, 4, files...)
+		writeAll(tt)
+		qt.Check(t, qt.IsTrue(fileExists(dir, "b.part")))
+	})
+	t.Run("DownloadAll", func(t *testing.T) {
+		dir, tt := testFileWantedTorrent(t, storage.FilePreallocationSparse, 4, files...)
+		tt.DownloadAll()
+		writeAll(tt)
+		qt.Check(t, qt.IsTrue(fileExists(dir, "b.part")))
+	})
+	t.Run("DeselectedAfterDownloadAll", func(t *testing.T) {
+		dir, tt := testFileWantedTorrent(t, storage.FilePreallocationSparse, 4, files...)
+		tt.DownloadAll()
+		tt.Files()[1].SetPriority(PiecePriorityNone)
+		writeAll(tt)
+		qt.Check(t, qt.IsFalse(fileExists(dir, "b.part")))
+	})
+	t.Run("SelectedAfterComplete", func(t *testing.T) {
+		dir, tt := testFileWantedTorrent(t, storage.FilePreallocationSparse, 4, files...)
+		tt.Files()[1].SetPriority(PiecePriorityNone)
+		data := []byte("aaaaaabbbbcccccc")
+		for i := range tt.NumPieces() {
+			ps := tt.Piece(i).Storage()
+			_, err := ps.WriteAt(data[i*4:(i+1)*4], 0)
+			qt.Assert(t, qt.IsNil(err))
+			qt.Assert(t, qt.IsNil(ps.MarkComplete()))
+		}
+		qt.Check(t, qt.IsFalse(fileExists(dir, "b")))
+		tt.Files()[1].SetPriority(PiecePriorityNormal)
+		b, err := os.ReadFile(filepath.Join(dir, "b"))
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.Equals(string(b), "bbbb"))
+	})
+}
@@ -8,14 +8,13 @@ import (
 
 	"github.com/anacrolix/fuse"
 	"github.com/anacrolix/fuse/fs"
-	"github.com/anacrolix/missinggo/v2"
 
 	"github.com/anacrolix/torrent"
 )
 
 type fileHandle struct {
 	fn fileNode
-	tf *torrent.File
+	r  torrent.ReaderAt
 }
 
 var _ interface {
@@ -28,64 +27,47 @@ func (me fileHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse
 	if req.Dir {
 		panic("read on directory")
 	}
-	r := me.tf.NewReader()
-	defer r.Close()
-	pos, err := r.Seek(req.Offset, io.SeekStart)
-	if err != nil {
-		panic(err)
-	}
-	if pos != req.Offset {
-		panic("seek failed")
-	}
-	resp.Data = resp.Data[:req.Size]
-	readDone := make(chan struct{})
-	ctx, cancel := context.WithCancel(ctx)
-	var readErr error
-	go func() {
-		defer close(readDone)
-		me.fn.FS.mu.Lock()
-		me.fn.FS.blockedReads++
-		me.fn.FS.event.Broadcast()
-		me.fn.FS.mu.Unlock()
-		var n int
-		r := missinggo.ContextedReader{r, ctx}
-		// log.Printf("reading %v bytes at %v", len(resp.Data), req.Offset)
-		if true {
-			// A user reported on that on freebsd 12.2, the system requires that reads are
-			// completely filled. Their system only asks for 64KiB at a time. I've seen systems that
-			// can demand up to 16MiB at a time, so this gets tricky. For now, I'll restore the old
-			// behaviour from before 2a7352a, which nobody reported problems with.
-			n, readErr = io.ReadFull(r, resp.Data)
-			if readErr == io.ErrUnexpectedEOF {
-				readErr = nil
-			}
-		} else {
-			n, readErr = r.Read(resp.Data)
-			if readErr == io.EOF {
-				readErr = nil
-			}
-		}
-		resp.Data = resp.Data[:n]
-	}()
+	me.fn.FS.mu.Lock()
+	me.fn.FS.blockedReads++
+	me.fn.FS.event.Broadcast()
+	me.fn.FS.mu.Unlock()
 	defer func() {
-		<-readDone
 		me.fn.FS.mu.Lock()
 		me.fn.FS.blockedReads--
 		me.fn.FS.event.Broadcast()
 		me.fn.FS.mu.Unlock()
 	}()
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-
-	select {
-	case <-readDone:
-		return readErr
-	case <-me.fn.FS.destroyed:
-		return fuse.EIO
-	case <-ctx.Done():
-		return fuse.EINTR
+	go func() {
+		select {
+		case <-me.fn.FS.destroyed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	// A user reported on that on freebsd 12.2, the system requires that reads are completely
+	// filled. Their system only asks for 64KiB at a time. I've seen systems that can demand up to
+	// 16MiB at a time, so this gets tricky. ReadAt fills the buffer unless it reaches the end of the
+	// file, which is the old behaviour from before 2a7352a that nobody reported problems with.
+	n, err := me.r.ReadAtContext(ctx, resp.Data[:req.Size], req.Offset)
+	resp.Data = resp.Data[:n]
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		select {
+		case <-me.fn.FS.destroyed:
+			return fuse.EIO
+		default:
+		}
+		if ctx.Err() != nil {
+			return fuse.EINTR
+		}
 	}
+	return err
 }
 
 func (me fileHandle) Release(context.Context, *fuse.ReleaseRequest) error {
-	return nil
+	return me.r.Close()
 }
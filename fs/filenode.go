@@ -25,5 +25,5 @@ func (fn fileNode) Attr(ctx context.Context, attr *fuse.Attr) error {
 }
 
 func (fn fileNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fusefs.Handle, error) {
-	return fileHandle{fn, fn.f}, nil
+	return fileHandle{fn, fn.f.ReaderAt()}, nil
 }
@@ -0,0 +1,81 @@
+package httpserver
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/internal/httpfile"
+)
+
+// How long webseed clients are asked to wait before retrying data we don't have yet.
+const webseedRetryAfter = 30 * time.Second
+
+func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, f *torrent.File, webseed bool) {
+	etag := httpfile.ETag(f)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", httpfile.ContentType(f.Path()))
+	// Invalid ranges are left to http.ServeContent to reject.
+	ranges, _ := parseRange(r.Header.Get("Range"), f.Length())
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" && ifRange != etag {
+		// The whole file will be sent.
+		ranges = nil
+	}
+	if len(ranges) == 0 {
+		ranges = []httpRange{{0, f.Length()}}
+	}
+	var reader torrent.Reader
+	if webseed {
+		// Webseed clients get what we have. They shouldn't cause us to download anything.
+		if !haveRanges(f, ranges) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(webseedRetryAfter/time.Second)))
+			http.Error(w, "data not available yet", http.StatusServiceUnavailable)
+			return
+		}
+		reader = f.NewPassiveReader()
+	} else {
+		reader = f.NewReader()
+		reader.SetReadaheadFunc(func(rc torrent.ReadaheadContext) int64 {
+			return rangesReadahead(ranges, rc.CurrentPos, h.opts.MaxReadahead)
+		})
+	}
+	defer reader.Close()
+	if h.opts.Responsive {
+		reader.SetResponsive()
+	}
+	// Reads stop waiting for data when the client goes away, and the reader's priorities go with
+	// it.
+	reader.SetContext(r.Context())
+	http.ServeContent(w, r, f.Path(), time.Time{}, reader)
+}
+
+// Readahead for a request is limited to the rest of the range being read, so pieces past what the
+// client asked for aren't prioritized.
+func rangesReadahead(ranges []httpRange, pos int64, max int64) int64 {
+	for _, r := range ranges {
+		if pos >= r.start && pos < r.start+r.length {
+			return min(r.start+r.length-pos, max)
+		}
+	}
+	return 0
+}
+
+// Whether all the data in the ranges of the file is complete.
+func haveRanges(f *torrent.File, ranges []httpRange) bool {
+	t := f.Torrent()
+	pieceLength := t.Info().PieceLength
+	for _, r := range ranges {
+		if r.length == 0 {
+			continue
+		}
+		begin := (f.Offset() + r.start) / pieceLength
+		end := (f.Offset() + r.start + r.length + pieceLength - 1) / pieceLength
+		for i := begin; i < end; i++ {
+			if !t.PieceState(int(i)).Complete {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,215 @@
+// Package httpserver serves torrent data over HTTP. Files are streamed with Range support from
+// torrent.Readers, so data is downloaded as it's requested. Routes are:
+//
+//	/                       lists the Client's torrents
+//	POST /add, magnet=<uri> adds a magnet link, if Options.AddOnDemand, and redirects to it
+//	/<infohash>/<path>      serves a torrent file, or lists a directory in the torrent
+//	/webseed/<infohash>/    serves complete data only, for use as a BEP 19 webseed URL
+//
+// File paths include the torrent name, as in torrent.File.Path, which is also how BEP 19 webseed
+// clients build request paths. This means /<infohash>/ works as a webseed URL too, but requests to
+// it will download data that's missing.
+package httpserver
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// The default most readahead used for a request.
+const DefaultMaxReadahead = 16 << 20
+
+type Options struct {
+	// Add torrents that aren't in the Client when they're requested by infohash, and allow magnet
+	// links to be added with /add. Torrents added for requests are dropped if the requests all end
+	// before the torrent's info arrives.
+	AddOnDemand bool
+	// The most data ahead of a request's reads to prioritize. Readahead is also limited to the end
+	// of the range requested. Defaults to DefaultMaxReadahead.
+	MaxReadahead int64
+	// Serve data as soon as it's received, rather than once pieces are verified. See
+	// torrent.Reader.SetResponsive.
+	Responsive bool
+}
+
+// An http.Handler serving the torrents of a Client. See the package documentation for routes.
+type Handler struct {
+	cl   *torrent.Client
+	opts Options
+
+	mu sync.Mutex
+	// Requests waiting for the info of torrents they added on demand.
+	onDemandWaiters map[metainfo.Hash]int
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+func New(cl *torrent.Client, opts Options) *Handler {
+	if opts.MaxReadahead <= 0 {
+		opts.MaxReadahead = DefaultMaxReadahead
+	}
+	return &Handler{
+		cl:              cl,
+		opts:            opts,
+		onDemandWaiters: make(map[metainfo.Hash]int),
+	}
+}
+
+const webseedPrefix = "webseed/"
+
+// Returns the path of the BEP 19 webseed URL for a torrent, relative to where the Handler is
+// served.
+func WebseedPath(infoHash metainfo.Hash) string {
+	return webseedPrefix + infoHash.HexString() + "/"
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(r.URL.Path, "/")
+	// Adding changes state, so it isn't done for GET, which browsers and crawlers follow freely.
+	if p == "add" {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, "POST")
+			return
+		}
+	} else if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, "GET, HEAD")
+		return
+	}
+	switch {
+	case p == "":
+		h.serveTorrentList(w)
+	case p == "add":
+		h.serveAdd(w, r)
+	case strings.HasPrefix(p, webseedPrefix):
+		h.serveTorrentPath(w, r, strings.TrimPrefix(p, webseedPrefix), true)
+	default:
+		h.serveTorrentPath(w, r, p, false)
+	}
+}
+
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
+
+func (h *Handler) serveAdd(w http.ResponseWriter, r *http.Request) {
+	if !h.opts.AddOnDemand {
+		http.Error(w, "adding torrents is disabled", http.StatusForbidden)
+		return
+	}
+	uri := r.PostFormValue("magnet")
+	if uri == "" {
+		http.Error(w, "missing magnet parameter", http.StatusBadRequest)
+		return
+	}
+	t, err := h.cl.AddMagnet(uri)
+	if err != nil {
+		http.Error(w, "adding magnet: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	localRedirect(w, t.InfoHash().HexString()+"/", http.StatusSeeOther)
+}
+
+// Serves p, which is an infohash followed by the path of a file or directory in the torrent.
+func (h *Handler) serveTorrentPath(w http.ResponseWriter, r *http.Request, p string, webseed bool) {
+	ihHex, filePath, slash := strings.Cut(p, "/")
+	var ih metainfo.Hash
+	if err := ih.FromHexString(ihHex); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !slash {
+		localRedirect(w, ihHex+"/", http.StatusMovedPermanently)
+		return
+	}
+	t, err := h.torrent(r, ih, webseed)
+	if err != nil {
+		if errors.Is(err, errTorrentNotFound) {
+			http.NotFound(w, r)
+		}
+		// Otherwise the request was cancelled.
+		return
+	}
+	filePath = strings.TrimSuffix(filePath, "/")
+	for _, f := range t.Files() {
+		if f.Path() == filePath {
+			h.serveFile(w, r, f, webseed)
+			return
+		}
+	}
+	entries := dirEntries(t, filePath)
+	if len(entries) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		localRedirect(w, url.PathEscape(lastPathComponent(r.URL.Path))+"/", http.StatusMovedPermanently)
+		return
+	}
+	serveDirListing(w, t, filePath, entries)
+}
+
+var errTorrentNotFound = errors.New("torrent not found")
+
+// Gets the torrent for the infohash, adding it if that's enabled, and waits for its info.
+func (h *Handler) torrent(r *http.Request, ih metainfo.Hash, webseed bool) (*torrent.Torrent, error) {
+	h.mu.Lock()
+	t, ok := h.cl.Torrent(ih)
+	if !ok {
+		if webseed || !h.opts.AddOnDemand {
+			h.mu.Unlock()
+			return nil, errTorrentNotFound
+		}
+		t, _ = h.cl.AddTorrentInfoHash(ih)
+		h.onDemandWaiters[ih] = 0
+	}
+	if _, ok := h.onDemandWaiters[ih]; ok {
+		h.onDemandWaiters[ih]++
+		defer h.endOnDemandWait(t)
+	}
+	h.mu.Unlock()
+	if webseed && t.Info() == nil {
+		// Webseed clients already have the info, and won't wait for us to get it.
+		return nil, errTorrentNotFound
+	}
+	select {
+	case <-t.GotInfo():
+		return t, nil
+	case <-t.Closed():
+		return nil, errTorrentNotFound
+	case <-r.Context().Done():
+		return nil, r.Context().Err()
+	}
+}
+
+// Redirects relative to the request path, so the Handler works behind http.StripPrefix.
+func localRedirect(w http.ResponseWriter, location string, code int) {
+	w.Header().Set("Location", location)
+	w.WriteHeader(code)
+}
+
+func lastPathComponent(p string) string {
+	return p[strings.LastIndexByte(p, '/')+1:]
+}
+
+// Drops a torrent added on demand if the last request waiting for it ends before its info arrives,
+// so requests for infohashes that can't be found don't leave torrents in the Client.
+func (h *Handler) endOnDemandWait(t *torrent.Torrent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ih := t.InfoHash()
+	h.onDemandWaiters[ih]--
+	if h.onDemandWaiters[ih] != 0 {
+		return
+	}
+	delete(h.onDemandWaiters, ih)
+	if t.Info() == nil {
+		t.Drop()
+	}
+}
@@ -0,0 +1,196 @@
+package httpserver
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+var videoData = func() []byte {
+	b := make([]byte, 100<<10)
+	rand.New(rand.NewSource(1)).Read(b)
+	return b
+}()
+
+// Creates a torrent of a "movie" directory, and a seeder client with its data.
+func newSeeder(t *testing.T) (*torrent.Client, *torrent.Torrent, *metainfo.MetaInfo) {
+	dataDir := t.TempDir()
+	root := filepath.Join(dataDir, "movie")
+	qt.Assert(t, qt.IsNil(os.MkdirAll(filepath.Join(root, "sub"), 0o755)))
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(root, "video.mp4"), videoData, 0o644)))
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(root, "sub", "notes & things.txt"), []byte("notes\n"), 0o644)))
+	info := metainfo.Info{PieceLength: 16 << 10}
+	qt.Assert(t, qt.IsNil(info.BuildFromFilePath(root)))
+	mi := &metainfo.MetaInfo{InfoBytes: bencode.MustMarshal(&info)}
+	cfg := torrent.TestingConfig(t)
+	cfg.Seed = true
+	cfg.DataDir = dataDir
+	// Allow whole chunks of the piece length to be requested.
+	cfg.MaxAllocPeerRequestDataPerConn = 16 << 10
+	cl, err := torrent.NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	t.Cleanup(func() { cl.Close() })
+	tor, err := cl.AddTorrent(mi)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(tor.VerifyData()))
+	<-tor.Complete().On()
+	return cl, tor, mi
+}
+
+func get(t *testing.T, url string, header http.Header) (*http.Response, []byte) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	qt.Assert(t, qt.IsNil(err))
+	if header != nil {
+		req.Header = header
+	}
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	qt.Assert(t, qt.IsNil(err))
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	qt.Assert(t, qt.IsNil(err))
+	return resp, b
+}
+
+func TestServeFileRange(t *testing.T) {
+	cl, tor, _ := newSeeder(t)
+	srv := httptest.NewServer(New(cl, Options{}))
+	defer srv.Close()
+	fileURL := srv.URL + "/" + tor.InfoHash().HexString() + "/movie/video.mp4"
+	resp, b := get(t, fileURL, http.Header{"Range": {"bytes=20000-40000"}})
+	qt.Check(t, qt.Equals(resp.StatusCode, http.StatusPartialContent))
+	qt.Check(t, qt.Equals(resp.Header.Get("Content-Type"), "video/mp4"))
+	qt.Check(t, qt.DeepEquals(b, videoData[20000:40001]))
+	etag := resp.Header.Get("ETag")
+	qt.Assert(t, qt.Not(qt.Equals(etag, "")))
+	resp, b = get(t, fileURL, http.Header{"Range": {"bytes=-10"}, "If-Range": {etag}})
+	qt.Check(t, qt.Equals(resp.StatusCode, http.StatusPartialContent))
+	qt.Check(t, qt.DeepEquals(b, videoData[len(videoData)-10:]))
+	resp, b = get(t, fileURL, http.Header{"Range": {"bytes=-10"}, "If-Range": {`"stale"`}})
+	qt.Check(t, qt.Equals(resp.StatusCode, http.StatusOK))
+	qt.Check(t, qt.DeepEquals(b, videoData))
+}
+
+func TestDirListings(t *testing.T) {
+	cl, tor, _ := newSeeder(t)
+	srv := httptest.NewServer(New(cl, Options{}))
+	defer srv.Close()
+	ih := tor.InfoHash().HexString()
+	_, b := get(t, srv.URL+"/", nil)
+	qt.Check(t, qt.StringContains(string(b), `<a href="`+ih+`/">movie</a>`))
+	resp, _ := get(t, srv.URL+"/"+ih, nil)
+	qt.Check(t, qt.Equals(resp.StatusCode, http.StatusMovedPermanently))
+	qt.Check(t, qt.Equals(resp.Header.Get("Location"), ih+"/"))
+	_, b = get(t, srv.URL+"/"+ih+"/", nil)
+	qt.Check(t, qt.StringContains(string(b), `<a href="movie/">movie/</a>`))
+	resp, _ = get(t, srv.URL+"/"+ih+"/movie", nil)
+	qt.Check(t, qt.Equals(resp.Header.Get("Location"), "movie/"))
+	_, b = get(t, srv.URL+"/"+ih+"/movie/", nil)
+	qt.Check(t, qt.StringContains(string(b), `<a href="sub/">sub/</a>`))
+	qt.Check(t, qt.StringContains(string(b), `<a href="video.mp4">video.mp4</a>`))
+	_, b = get(t, srv.URL+"/"+ih+"/movie/sub/", nil)
+	qt.Check(t, qt.StringContains(string(b), `<a href="notes%20&amp;%20things.txt">notes &amp; things.txt</a>`))
+	resp, b = get(t, srv.URL+"/"+ih+"/movie/sub/notes%20&%20things.txt", nil)
+	qt.Check(t, qt.Equals(resp.Header.Get("Content-Type"), "text/plain; charset=utf-8"))
+	qt.Check(t, qt.Equals(string(b), "notes\n"))
+	resp, _ = get(t, srv.URL+"/"+ih+"/movie/missing", nil)
+	qt.Check(t, qt.Equals(resp.StatusCode, http.StatusNotFound))
+}
+
+func TestAddOnDemand(t *testing.T) {
+	seeder, seederTorrent, mi := newSeeder(t)
+	cl, err := torrent.NewClient(torrent.TestingConfig(t))
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	srv := httptest.NewServer(New(cl, Options{}))
+	ih := seederTorrent.InfoHash()
+	resp, _ := get(t, srv.URL+"/"+ih.HexString()+"/", nil)
+	qt.Check(t, qt.Equals(resp.StatusCode, http.StatusNotFound))
+	srv.Close()
+
+	srv = httptest.NewServer(New(cl, Options{AddOnDemand: true}))
+	defer srv.Close()
+	m := mi.Magnet(&ih, nil)
+	m.Params = url.Values{"x.pe": {seeder.ListenAddrs()[0].String()}}
+	// Adding changes state, so it's not done for GET.
+	resp, _ = get(t, srv.URL+"/add?"+url.Values{"magnet": {m.String()}}.Encode(), nil)
+	qt.Check(t, qt.Equals(resp.StatusCode, http.StatusMethodNotAllowed))
+	qt.Check(t, qt.Equals(resp.Header.Get("Allow"), "POST"))
+	qt.Check(t, qt.HasLen(cl.Torrents(), 0))
+	resp, err = http.PostForm(srv.URL+"/add", url.Values{"magnet": {m.String()}})
+	qt.Assert(t, qt.IsNil(err))
+	resp.Body.Close()
+	// The redirect was followed to the torrent's listing.
+	qt.Check(t, qt.Equals(resp.Request.URL.Path, "/"+ih.HexString()+"/"))
+	resp, b := get(t, srv.URL+"/"+ih.HexString()+"/movie/video.mp4", http.Header{"Range": {"bytes=50000-"}})
+	qt.Check(t, qt.Equals(resp.StatusCode, http.StatusPartialContent))
+	qt.Check(t, qt.DeepEquals(b, videoData[50000:]))
+}
+
+// Torrents added on demand are dropped if their info doesn't arrive before the requests for them
+// end.
+func TestAddOnDemandDropsTorrentWithoutInfo(t *testing.T) {
+	cl, err := torrent.NewClient(torrent.TestingConfig(t))
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	srv := httptest.NewServer(New(cl, Options{AddOnDemand: true}))
+	defer srv.Close()
+	ih := metainfo.Hash{1}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/"+ih.HexString()+"/", nil)
+	qt.Assert(t, qt.IsNil(err))
+	_, err = http.DefaultClient.Do(req)
+	qt.Check(t, qt.ErrorIs(err, context.DeadlineExceeded))
+	// The handler sees the request end after the client does.
+	for range 100 {
+		if _, ok := cl.Torrent(ih); !ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("torrent wasn't dropped")
+}
+
+func TestWebseed(t *testing.T) {
+	seeder, seederTorrent, mi := newSeeder(t)
+	srv := httptest.NewServer(New(seeder, Options{}))
+	defer srv.Close()
+
+	cfg := torrent.TestingConfig(t)
+	cfg.DisableTCP = true
+	cfg.DisableUTP = true
+	cl, err := torrent.NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	tor, err := cl.AddTorrent(mi)
+	qt.Assert(t, qt.IsNil(err))
+
+	// The leecher serves nothing it doesn't have to webseed clients.
+	leecherSrv := httptest.NewServer(New(cl, Options{}))
+	defer leecherSrv.Close()
+	resp, _ := get(t, leecherSrv.URL+"/"+WebseedPath(tor.InfoHash())+"movie/video.mp4", nil)
+	qt.Check(t, qt.Equals(resp.StatusCode, http.StatusServiceUnavailable))
+	qt.Check(t, qt.Equals(resp.Header.Get("Retry-After"), "30"))
+
+	tor.AddWebSeeds([]string{srv.URL + "/" + WebseedPath(seederTorrent.InfoHash())})
+	tor.DownloadAll()
+	<-tor.Complete().On()
+	r := tor.Files()[0].NewReader()
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(b, []byte("notes\n")))
+}
@@ -0,0 +1,115 @@
+package httpserver
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/anacrolix/torrent"
+)
+
+type dirEntry struct {
+	name  string
+	isDir bool
+	// For files.
+	length int64
+}
+
+// Returns the entries of a directory in the torrent, where dir is a path as in File.Path, without
+// a trailing slash. The empty path is the parent of the torrent name.
+func dirEntries(t *torrent.Torrent, dir string) (entries []dirEntry) {
+	seenDirs := make(map[string]struct{})
+	for _, f := range t.Files() {
+		if strings.Contains(f.FileInfo().Attr, "p") {
+			// BEP 47 padding files aren't really there.
+			continue
+		}
+		rest := f.Path()
+		if dir != "" {
+			var ok bool
+			rest, ok = strings.CutPrefix(rest, dir+"/")
+			if !ok {
+				continue
+			}
+		}
+		name, _, isDir := strings.Cut(rest, "/")
+		if isDir {
+			if _, ok := seenDirs[name]; ok {
+				continue
+			}
+			seenDirs[name] = struct{}{}
+		}
+		entries = append(entries, dirEntry{
+			name:   name,
+			isDir:  isDir,
+			length: f.Length(),
+		})
+	}
+	slices.SortFunc(entries, func(a, b dirEntry) int {
+		return cmp.Compare(a.name, b.name)
+	})
+	return
+}
+
+func writeListingHeader(w http.ResponseWriter, title string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n"+
+		"<title>%s</title>\n<pre>\n", html.EscapeString(title))
+}
+
+func writeListingLink(w io.Writer, href, text, note string) {
+	fmt.Fprintf(w, "<a href=\"%s\">%s</a>", html.EscapeString(href), html.EscapeString(text))
+	if note != "" {
+		fmt.Fprintf(w, "  %s", html.EscapeString(note))
+	}
+	fmt.Fprintln(w)
+}
+
+func serveDirListing(w http.ResponseWriter, t *torrent.Torrent, dir string, entries []dirEntry) {
+	title := dir
+	if title == "" {
+		title = t.InfoHash().HexString()
+	}
+	writeListingHeader(w, title)
+	for _, e := range entries {
+		if e.isDir {
+			writeListingLink(w, url.PathEscape(e.name)+"/", e.name+"/", "")
+		} else {
+			writeListingLink(w, url.PathEscape(e.name), e.name, humanize.IBytes(uint64(e.length)))
+		}
+	}
+	fmt.Fprintln(w, "</pre>")
+}
+
+func (h *Handler) serveTorrentList(w http.ResponseWriter) {
+	writeListingHeader(w, "torrents")
+	type listed struct {
+		ih, name, note string
+	}
+	var torrents []listed
+	for _, t := range h.cl.Torrents() {
+		l := listed{ih: t.InfoHash().HexString()}
+		if info := t.Info(); info != nil {
+			l.name = t.Name()
+			l.note = humanize.IBytes(uint64(info.TotalLength()))
+		} else {
+			l.name = l.ih
+			l.note = "awaiting info"
+		}
+		torrents = append(torrents, l)
+	}
+	slices.SortFunc(torrents, func(a, b listed) int {
+		return cmp.Compare(a.name, b.name)
+	})
+	for _, l := range torrents {
+		writeListingLink(w, l.ih+"/", l.name, l.note)
+	}
+	fmt.Fprintln(w, "</pre>")
+}
@@ -0,0 +1,67 @@
+package httpserver
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+type httpRange struct {
+	start, length int64
+}
+
+var errInvalidRange = errors.New("invalid range")
+
+// Parses a Range header per RFC 9110 for a resource of the given size. This mirrors what
+// http.ServeContent accepts, which doesn't expose its parsing. A missing header gives no ranges.
+func parseRange(s string, size int64) ([]httpRange, error) {
+	if s == "" {
+		return nil, nil
+	}
+	const b = "bytes="
+	if !strings.HasPrefix(s, b) {
+		return nil, errInvalidRange
+	}
+	var ranges []httpRange
+	for ra := range strings.SplitSeq(s[len(b):], ",") {
+		ra = strings.TrimSpace(ra)
+		if ra == "" {
+			continue
+		}
+		startStr, endStr, ok := strings.Cut(ra, "-")
+		if !ok {
+			return nil, errInvalidRange
+		}
+		startStr, endStr = strings.TrimSpace(startStr), strings.TrimSpace(endStr)
+		var r httpRange
+		if startStr == "" {
+			// A suffix range, the last n bytes.
+			n, err := strconv.ParseInt(endStr, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errInvalidRange
+			}
+			n = min(n, size)
+			r = httpRange{size - n, n}
+		} else {
+			start, err := strconv.ParseInt(startStr, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errInvalidRange
+			}
+			if start >= size {
+				// Unsatisfiable, but others might not be.
+				continue
+			}
+			end := size - 1
+			if endStr != "" {
+				end, err = strconv.ParseInt(endStr, 10, 64)
+				if err != nil || end < start {
+					return nil, errInvalidRange
+				}
+				end = min(end, size-1)
+			}
+			r = httpRange{start, end - start + 1}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
@@ -0,0 +1,27 @@
+// Package httpfile has helpers for serving torrent files over HTTP, shared by the HTTP and WebDAV
+// servers.
+package httpfile
+
+import (
+	"mime"
+	"path"
+	"strconv"
+
+	"github.com/anacrolix/torrent"
+)
+
+// Torrent data never changes, so the infohash and file index make a strong validator for If-Range
+// and conditional requests.
+func ETag(f *torrent.File) string {
+	return strconv.Quote(f.Torrent().InfoHash().HexString() + "-" + strconv.Itoa(f.Index()))
+}
+
+// Returns the content type for a file name by its extension. Serving the type explicitly stops
+// http.ServeContent sniffing it from the start of the file, which would download it even for range
+// requests elsewhere.
+func ContentType(name string) string {
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
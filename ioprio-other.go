@@ -0,0 +1,6 @@
+//go:build !linux
+
+package torrent
+
+// I/O priority isn't supported on this platform.
+func lowerIoPriority() (restore func(), err error) { return func() {}, nil }
@@ -0,0 +1,38 @@
+package torrent
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+)
+
+// Locks the calling goroutine to its thread, and gives the thread idle I/O priority, so its disk
+// reads only proceed when the disk is otherwise idle. The returned func restores the thread's
+// priority and unlocks it, and must be called from the same goroutine.
+func lowerIoPriority() (restore func(), err error) {
+	runtime.LockOSThread()
+	// A who of 0 with IOPRIO_WHO_PROCESS is the calling thread.
+	prev, _, errno := unix.Syscall(unix.SYS_IOPRIO_GET, ioprioWhoProcess, 0, 0)
+	if errno != 0 {
+		runtime.UnlockOSThread()
+		return func() {}, errno
+	}
+	_, _, errno = unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0, ioprioClassIdle<<ioprioClassShift)
+	if errno != 0 {
+		runtime.UnlockOSThread()
+		return func() {}, errno
+	}
+	return func() {
+		_, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0, prev)
+		if errno == 0 {
+			runtime.UnlockOSThread()
+		}
+		// Otherwise the thread stays locked, and is discarded when the goroutine exits.
+	}, nil
+}
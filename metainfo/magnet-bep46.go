@@ -0,0 +1,94 @@
+package metainfo
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// BEP 46 mutable torrent magnet link components.
+type MutableMagnet struct {
+	// ed25519 public key of the publisher.
+	PublicKey   [32]byte
+	Salt        []byte     // "s" value, if not empty
+	Trackers    []string   // "tr" values
+	DisplayName string     // "dn" value, if not empty
+	Params      url.Values // All other values
+}
+
+const btpkPrefix = "urn:btpk:"
+
+func (m MutableMagnet) String() string {
+	vs := make(url.Values, len(m.Params)+len(m.Trackers)+2)
+	for k, v := range m.Params {
+		vs[k] = append([]string(nil), v...)
+	}
+	for _, tr := range m.Trackers {
+		vs.Add("tr", tr)
+	}
+	if m.DisplayName != "" {
+		vs.Add("dn", m.DisplayName)
+	}
+	if len(m.Salt) != 0 {
+		vs.Add("s", hex.EncodeToString(m.Salt))
+	}
+	u := url.URL{
+		Scheme:   "magnet",
+		RawQuery: "xs=" + btpkPrefix + hex.EncodeToString(m.PublicKey[:]),
+	}
+	if len(vs) != 0 {
+		u.RawQuery += "&" + vs.Encode()
+	}
+	return u.String()
+}
+
+// Parses BEP 46 magnet links, which refer to a public key instead of an infohash.
+func ParseMutableMagnetUri(uri string) (m MutableMagnet, err error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		err = fmt.Errorf("error parsing uri: %w", err)
+		return
+	}
+	if u.Scheme != "magnet" {
+		err = fmt.Errorf("unexpected scheme %q", u.Scheme)
+		return
+	}
+	q := u.Query()
+	gotKey := false
+	for _, xs := range q["xs"] {
+		encoded, found := strings.CutPrefix(xs, btpkPrefix)
+		if gotKey || !found {
+			lazyAddParam(&m.Params, "xs", xs)
+			continue
+		}
+		var n int
+		n, err = hex.Decode(m.PublicKey[:], []byte(encoded))
+		if err == nil && n != len(m.PublicKey) {
+			err = fmt.Errorf("expected %v bytes, got %v", len(m.PublicKey), n)
+		}
+		if err != nil {
+			err = fmt.Errorf("error parsing public key %q: %w", xs, err)
+			return
+		}
+		gotKey = true
+	}
+	if !gotKey {
+		err = errors.New("missing public key")
+		return
+	}
+	q.Del("xs")
+	if s := popFirstValue(q, "s"); s.Ok {
+		m.Salt, err = hex.DecodeString(s.Value)
+		if err != nil {
+			err = fmt.Errorf("error parsing salt: %w", err)
+			return
+		}
+	}
+	m.DisplayName = popFirstValue(q, "dn").UnwrapOrZeroValue()
+	m.Trackers = q["tr"]
+	q.Del("tr")
+	copyParams(&m.Params, q)
+	return
+}
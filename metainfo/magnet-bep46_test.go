@@ -0,0 +1,27 @@
+package metainfo
+
+import (
+	"testing"
+
+	qt "github.com/go-quicktest/qt"
+)
+
+func TestParseMutableMagnet(t *testing.T) {
+	const uri = "magnet:?xs=urn:btpk:8543d3e6115f0f98c944077a4493dcd543e49c739fd998550a1f614ab36ed63e&s=6e" +
+		"&dn=dataset&tr=http%3A%2F%2Ftracker.example%2Fannounce&x.pe=1.2.3.4%3A5"
+	m, err := ParseMutableMagnetUri(uri)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(m.PublicKey[0], 0x85))
+	qt.Check(t, qt.DeepEquals(m.Salt, []byte("n")))
+	qt.Check(t, qt.Equals(m.DisplayName, "dataset"))
+	qt.Check(t, qt.DeepEquals(m.Trackers, []string{"http://tracker.example/announce"}))
+	qt.Check(t, qt.DeepEquals(m.Params["x.pe"], []string{"1.2.3.4:5"}))
+	m2, err := ParseMutableMagnetUri(m.String())
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(m2, m))
+
+	_, err = ParseMutableMagnetUri("magnet:?xt=urn:btih:" + "0123456789abcdef0123456789abcdef01234567")
+	qt.Check(t, qt.IsNotNil(err))
+	_, err = ParseMutableMagnetUri("magnet:?xs=urn:btpk:abcd")
+	qt.Check(t, qt.IsNotNil(err))
+}
@@ -0,0 +1,236 @@
+package torrent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/bep44"
+	"github.com/anacrolix/dht/v2/exts/getput"
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// How often mutable torrents are checked for updates by default.
+const DefaultMutableTorrentPollInterval = 30 * time.Minute
+
+// The value stored in the DHT for a BEP 46 mutable torrent.
+type mutableTorrentValue struct {
+	InfoHash string `bencode:"ih"`
+}
+
+type AddMutableTorrentOpts struct {
+	Magnet metainfo.MutableMagnet
+	// How often to check the DHT for a newer infohash. Defaults to
+	// DefaultMutableTorrentPollInterval.
+	PollInterval time.Duration
+	// Keep torrents for earlier infohashes when a newer one is found, instead of dropping them.
+	KeepPrevious bool
+	// Called when a newer infohash is found and its Torrent added. prev is nil the first time.
+	OnUpdate func(prev, cur *Torrent)
+}
+
+// Follows a BEP 46 mutable torrent, adding the Torrent for the latest infohash published under its
+// public key.
+type MutableTorrent struct {
+	cl   *Client
+	opts AddMutableTorrentOpts
+
+	mu  sync.Mutex
+	t   *Torrent
+	seq int64
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// Adds a BEP 46 magnet link (magnet:?xs=urn:btpk:...). The Torrent is added once the infohash is
+// resolved from the DHT.
+func (cl *Client) AddMutableMagnet(uri string) (*MutableTorrent, error) {
+	m, err := metainfo.ParseMutableMagnetUri(uri)
+	if err != nil {
+		return nil, err
+	}
+	return cl.AddMutableTorrent(AddMutableTorrentOpts{Magnet: m})
+}
+
+func (cl *Client) AddMutableTorrent(opts AddMutableTorrentOpts) (*MutableTorrent, error) {
+	if len(cl.anacrolixDhtServers()) == 0 {
+		return nil, errors.New("mutable torrents require an anacrolix DHT server")
+	}
+	if opts.PollInterval == 0 {
+		opts.PollInterval = DefaultMutableTorrentPollInterval
+	}
+	mt := &MutableTorrent{
+		cl:     cl,
+		opts:   opts,
+		seq:    math.MinInt64,
+		closed: make(chan struct{}),
+	}
+	go mt.run()
+	return mt, nil
+}
+
+func (cl *Client) anacrolixDhtServers() (ret []*dht.Server) {
+	for _, s := range cl.DhtServers() {
+		if w, ok := s.(AnacrolixDhtServerWrapper); ok {
+			ret = append(ret, w.Server)
+		}
+	}
+	return
+}
+
+// Returns the Torrent for the latest known infohash, or nil if none has been resolved yet.
+func (me *MutableTorrent) Torrent() *Torrent {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.t
+}
+
+// Returns the sequence number of the current infohash.
+func (me *MutableTorrent) Seq() int64 {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.seq
+}
+
+// Stops following updates. The current Torrent is left in the Client.
+func (me *MutableTorrent) Close() {
+	me.closeOnce.Do(func() {
+		close(me.closed)
+	})
+}
+
+func (me *MutableTorrent) run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-me.closed:
+		case <-me.cl.Closed():
+		}
+		cancel()
+	}()
+	for {
+		err := me.update(ctx)
+		if err != nil && ctx.Err() == nil {
+			me.cl.logger.Levelf(log.Debug, "error updating mutable torrent %x: %v", me.opts.Magnet.PublicKey, err)
+		}
+		me.mu.Lock()
+		resolved := me.t != nil
+		me.mu.Unlock()
+		interval := me.opts.PollInterval
+		if !resolved {
+			// Keep trying a little more eagerly until we have something to download.
+			interval = min(interval, time.Minute)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Gets the latest item from the DHT, and switches to its infohash if it's newer.
+func (me *MutableTorrent) update(ctx context.Context) error {
+	m := me.opts.Magnet
+	target := bep44.MakeMutableTarget(m.PublicKey, m.Salt)
+	seq := me.Seq()
+	var (
+		latest getput.GetResult
+		found  bool
+		errs   []error
+	)
+	for _, s := range me.cl.anacrolixDhtServers() {
+		var seqArg *int64
+		if seq != math.MinInt64 {
+			seqArg = &seq
+		}
+		res, _, err := getput.Get(ctx, target, s, seqArg, m.Salt)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if res.Mutable && res.Seq > seq && (!found || res.Seq > latest.Seq) {
+			latest = res
+			found = true
+		}
+	}
+	if !found {
+		return errors.Join(errs...)
+	}
+	var v mutableTorrentValue
+	err := bencode.Unmarshal(latest.V, &v)
+	if err != nil {
+		return fmt.Errorf("decoding item value: %w", err)
+	}
+	if len(v.InfoHash) != len(metainfo.Hash{}) {
+		return fmt.Errorf("item has bad infohash length %v", len(v.InfoHash))
+	}
+	var ih metainfo.Hash
+	copy(ih[:], v.InfoHash)
+	me.switchTo(ih, latest.Seq)
+	return nil
+}
+
+func (me *MutableTorrent) switchTo(ih metainfo.Hash, seq int64) {
+	m := me.opts.Magnet
+	spec := &TorrentSpec{
+		AddTorrentOpts: AddTorrentOpts{InfoHash: ih},
+		Trackers:       [][]string{m.Trackers},
+		DisplayName:    m.DisplayName,
+	}
+	t, _, err := me.cl.AddTorrentSpec(spec)
+	if err != nil {
+		me.cl.logger.Levelf(log.Warning, "error adding mutable torrent infohash %v: %v", ih, err)
+		return
+	}
+	me.mu.Lock()
+	prev := me.t
+	me.t = t
+	me.seq = seq
+	me.mu.Unlock()
+	if prev != nil && prev != t && !me.opts.KeepPrevious {
+		prev.Drop()
+	}
+	if me.opts.OnUpdate != nil {
+		me.opts.OnUpdate(prev, t)
+	}
+}
+
+// Publishes infoHash as the latest torrent for the public key of key and salt, as described in BEP
+// 46. The sequence number is one more than the highest already in the DHT.
+func (cl *Client) PublishMutableTorrent(
+	ctx context.Context, key ed25519.PrivateKey, salt []byte, infoHash metainfo.Hash,
+) error {
+	servers := cl.anacrolixDhtServers()
+	if len(servers) == 0 {
+		return errors.New("publishing mutable torrents requires an anacrolix DHT server")
+	}
+	var pubKey [32]byte
+	copy(pubKey[:], key.Public().(ed25519.PublicKey))
+	target := bep44.MakeMutableTarget(pubKey, salt)
+	var errs []error
+	for _, s := range servers {
+		_, err := getput.Put(ctx, target, s, salt, func(seq int64) bep44.Put {
+			put := bep44.Put{
+				V:    mutableTorrentValue{InfoHash: string(infoHash[:])},
+				K:    &pubKey,
+				Salt: salt,
+				Seq:  seq + 1,
+			}
+			put.Sign(key)
+			return put
+		})
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
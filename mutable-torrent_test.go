@@ -0,0 +1,91 @@
+package torrent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Creates a DHT server on localhost, bootstrapping from the given addresses.
+func newLocalhostDhtServer(t *testing.T, starting ...net.Addr) *dht.Server {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	qt.Assert(t, qt.IsNil(err))
+	cfg := dht.NewDefaultServerConfig()
+	cfg.Conn = pc
+	cfg.NoSecurity = true
+	cfg.StartingNodes = func() (addrs []dht.Addr, _ error) {
+		for _, a := range starting {
+			addrs = append(addrs, dht.NewAddr(a))
+		}
+		return
+	}
+	s, err := dht.NewServer(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestMutableTorrentPublishAndFollow(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	publisher, err := NewClient(TestingConfig(t))
+	qt.Assert(t, qt.IsNil(err))
+	defer publisher.Close()
+	follower, err := NewClient(TestingConfig(t))
+	qt.Assert(t, qt.IsNil(err))
+	defer follower.Close()
+	// Items aren't stored by the node that puts them, so we need a third node to hold them.
+	bootstrap := newLocalhostDhtServer(t)
+	ps := newLocalhostDhtServer(t, bootstrap.Addr())
+	fs := newLocalhostDhtServer(t, bootstrap.Addr())
+	for _, s := range []*dht.Server{ps, fs} {
+		qt.Assert(t, qt.IsNil(bootstrap.Ping(s.Addr().(*net.UDPAddr)).ToError()))
+		qt.Assert(t, qt.IsNil(s.Ping(bootstrap.Addr().(*net.UDPAddr)).ToError()))
+	}
+	publisher.AddDhtServer(AnacrolixDhtServerWrapper{ps})
+	follower.AddDhtServer(AnacrolixDhtServerWrapper{fs})
+
+	_, key, err := ed25519.GenerateKey(nil)
+	qt.Assert(t, qt.IsNil(err))
+	salt := []byte("dataset")
+	first := metainfo.Hash{1}
+	qt.Assert(t, qt.IsNil(publisher.PublishMutableTorrent(ctx, key, salt, first)))
+
+	var m metainfo.MutableMagnet
+	copy(m.PublicKey[:], key.Public().(ed25519.PublicKey))
+	m.Salt = salt
+	updates := make(chan *Torrent, 2)
+	mt, err := follower.AddMutableTorrent(AddMutableTorrentOpts{
+		Magnet:       m,
+		PollInterval: 500 * time.Millisecond,
+		OnUpdate: func(prev, cur *Torrent) {
+			updates <- cur
+		},
+	})
+	qt.Assert(t, qt.IsNil(err))
+	defer mt.Close()
+	waitUpdate := func(what string) *Torrent {
+		select {
+		case t := <-updates:
+			return t
+		case <-ctx.Done():
+			t.Fatalf("waiting for %v: %v", what, ctx.Err())
+			panic("unreachable")
+		}
+	}
+	qt.Check(t, qt.Equals(waitUpdate("first").InfoHash(), first))
+
+	second := metainfo.Hash{2}
+	qt.Assert(t, qt.IsNil(publisher.PublishMutableTorrent(ctx, key, salt, second)))
+	qt.Check(t, qt.Equals(waitUpdate("second").InfoHash(), second))
+	qt.Check(t, qt.Equals(mt.Seq(), 2))
+	// The torrent for the first infohash was dropped.
+	qt.Check(t, qt.HasLen(follower.Torrents(), 1))
+}
@@ -2,6 +2,7 @@ package torrent
 
 import (
 	"bytes"
+	"encoding/binary"
 	"io"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/anacrolix/sync"
 
 	pp "github.com/anacrolix/torrent/peer_protocol"
+	"github.com/anacrolix/torrent/storage"
 )
 
 func (pc *PeerConn) initMessageWriter() {
@@ -31,7 +33,8 @@ func (pc *PeerConn) initMessageWriter() {
 			defer pc.locker().RUnlock()
 			return pc.useful()
 		},
-		writeBuffer: new(peerConnMsgWriterBuffer),
+		writeBuffer:    new(peerConnMsgWriterBuffer),
+		writeFileChunk: pc.writeFileChunk,
 	}
 }
 
@@ -44,6 +47,7 @@ func (pc *PeerConn) messageWriterRunner() {
 	defer pc.locker().Unlock()
 	defer pc.close()
 	defer pc.locker().Lock()
+	defer pc.closeZeroCopyFile()
 	pc.messageWriter.run(pc.t.cl.config.KeepAliveTimeout)
 }
 
@@ -51,9 +55,22 @@ type peerConnMsgWriterBuffer struct {
 	// The number of bytes in the buffer that are part of a piece message. When
 	// the whole buffer is written, we can count this many bytes.
 	pieceDataBytes int
+	// Chunks sent from files, in the order they occur in the buffer.
+	fileChunks     []peerConnMsgWriterFileChunk
+	fileChunkBytes int
 	bytes.Buffer
 }
 
+// The payload of a piece message that is sent from a file. It follows the message header, which
+// ends at offset in the buffer.
+type peerConnMsgWriterFileChunk struct {
+	offset  int
+	section storage.FileSection
+	length  int
+	// Where the chunk is in the torrent, to read it from storage if the file can't be used.
+	torrentOffset int64
+}
+
 type peerConnMsgWriter struct {
 	// Must not be called with the local mutex held, as it will call back into the write method.
 	fillWriteBuffer func()
@@ -61,6 +78,8 @@ type peerConnMsgWriter struct {
 	logger          log.Logger
 	w               io.Writer
 	keepAlive       func() bool
+	// Writes a chunk from a file to w. Not called with the local mutex held.
+	writeFileChunk func(peerConnMsgWriterFileChunk) error
 
 	mu        sync.Mutex
 	writeCond chansync.BroadcastCond
@@ -109,12 +128,27 @@ func (cn *peerConnMsgWriter) run(keepAliveTimeout time.Duration) {
 		}
 		var err error
 		startedWriting := time.Now()
-		startingBufLen := frontBuf.Len()
-		for frontBuf.Len() != 0 {
+		startingBufLen := frontBuf.Len() + frontBuf.fileChunkBytes
+		// Bytes written from the buffer, to find where file chunks go.
+		bufWritten := 0
+		for frontBuf.Len() != 0 || len(frontBuf.fileChunks) != 0 {
 			next := frontBuf.Bytes()
+			if len(frontBuf.fileChunks) != 0 {
+				fc := frontBuf.fileChunks[0]
+				if fc.offset == bufWritten {
+					err = cn.writeFileChunk(fc)
+					if err != nil {
+						break
+					}
+					frontBuf.fileChunks = frontBuf.fileChunks[1:]
+					continue
+				}
+				next = next[:fc.offset-bufWritten]
+			}
 			var n int
 			n, err = cn.w.Write(next)
 			frontBuf.Next(n)
+			bufWritten += n
 			if err == nil && n != len(next) {
 				panic("expected full write")
 			}
@@ -135,6 +169,8 @@ func (cn *peerConnMsgWriter) run(keepAliveTimeout time.Duration) {
 		cn.totalDataBytesWritten += int64(frontBuf.pieceDataBytes)
 		cn.mu.Unlock()
 		frontBuf.pieceDataBytes = 0
+		frontBuf.fileChunks = frontBuf.fileChunks[:0]
+		frontBuf.fileChunkBytes = 0
 		lastWrite = time.Now()
 		keepAliveTimer.Reset(keepAliveTimeout)
 	}
@@ -163,6 +199,24 @@ func (cn *peerConnMsgWriter) write(msg pp.Message) bool {
 	return !cn.writeBufferFull()
 }
 
+// Buffers a piece message with the payload to be sent from a file.
+func (cn *peerConnMsgWriter) writeFileChunkMsg(r Request, fc peerConnMsgWriterFileChunk) bool {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	var header [13]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(9+fc.length))
+	header[4] = byte(pp.Piece)
+	binary.BigEndian.PutUint32(header[5:9], uint32(r.Index))
+	binary.BigEndian.PutUint32(header[9:], uint32(r.Begin))
+	cn.writeBuffer.Write(header[:])
+	fc.offset = cn.writeBuffer.Len()
+	cn.writeBuffer.fileChunks = append(cn.writeBuffer.fileChunks, fc)
+	cn.writeBuffer.fileChunkBytes += fc.length
+	cn.writeBuffer.pieceDataBytes += fc.length
+	cn.writeCond.Broadcast()
+	return !cn.writeBufferFull()
+}
+
 func (cn *peerConnMsgWriter) writeBufferFull() bool {
-	return cn.writeBuffer.Len() >= writeBufferHighWaterLen
+	return cn.writeBuffer.Len()+cn.writeBuffer.fileChunkBytes >= writeBufferHighWaterLen
 }
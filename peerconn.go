@@ -10,6 +10,7 @@ import (
 	"math/rand"
 	"net"
 	"net/netip"
+	"os"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -86,6 +87,9 @@ type PeerConn struct {
 	r io.Reader
 
 	messageWriter peerConnMsgWriter
+	// The file last used to send a chunk without copying. Only used by the message writer.
+	zeroCopyFile     *os.File
+	zeroCopyFileName string
 
 	// The peer's extension map, as sent in their extended handshake.
 	PeerExtensionIDs map[pp.ExtensionName]pp.ExtensionNumber
@@ -114,7 +118,7 @@ type PeerConn struct {
 	// Requests from the peer that haven't yet been read from storage for upload.
 	unreadPeerRequests map[Request]struct{}
 	// Peer request data that's ready to be uploaded.
-	readyPeerRequests map[Request][]byte
+	readyPeerRequests map[Request]peerRequestData
 	// Total peer request data buffered has decreased, so the server can read more.
 	peerRequestDataAllocDecreased chansync.BroadcastCond
 	// A routine is handling buffering peer request data.
@@ -762,7 +766,7 @@ func (me *PeerConn) deleteReadyPeerRequest(r Request) {
 		return
 	}
 	delete(me.readyPeerRequests, r)
-	if len(v) > 0 {
+	if len(v.b) > 0 || v.file.Ok {
 		me.peerRequestDataAllocDecreased.Broadcast()
 	}
 }
@@ -781,7 +785,7 @@ func (c *PeerConn) servePeerRequest(r Request) {
 		return
 	}
 	c.locker().Unlock()
-	b, err := c.readPeerRequestData(r)
+	data, err := c.readPeerRequestData(r)
 	c.locker().Lock()
 	if err != nil {
 		c.peerRequestDataReadFailed(err, r)
@@ -793,7 +797,7 @@ func (c *PeerConn) servePeerRequest(r Request) {
 	}
 	MustDelete(c.unreadPeerRequests, r)
 	MakeMapIfNil(&c.readyPeerRequests)
-	c.readyPeerRequests[r] = b
+	c.readyPeerRequests[r] = data
 	c.tickleWriter()
 }
 
@@ -845,7 +849,16 @@ func (c *PeerConn) useBestReject(r Request) {
 	}
 }
 
-func (c *PeerConn) readPeerRequestData(r Request) ([]byte, error) {
+func (c *PeerConn) readPeerRequestData(r Request) (peerRequestData, error) {
+	if c.t.cl.config.VerifyOnRead {
+		err := c.t.verifyPieceForRead(pieceIndex(r.Index))
+		if err != nil {
+			return peerRequestData{}, err
+		}
+	}
+	if section, ok := c.peerRequestFileSection(r); ok {
+		return peerRequestData{file: Some(section)}, nil
+	}
 	b := make([]byte, r.Length)
 	p := c.t.info.Piece(int(r.Index))
 	n, err := c.t.readAt(b, p.Offset()+int64(r.Begin))
@@ -858,7 +871,7 @@ func (c *PeerConn) readPeerRequestData(r Request) ([]byte, error) {
 			panic("expected error")
 		}
 	}
-	return b, err
+	return peerRequestData{b: b}, err
 }
 
 func (c *PeerConn) logProtocolBehaviour(level log.Level, format string, arg ...interface{}) {
@@ -1242,15 +1255,18 @@ func (c *PeerConn) tickleWriter() {
 }
 
 func (c *PeerConn) sendChunk(r Request, msg func(pp.Message) bool) (more bool) {
-	b := MapMustGet(c.readyPeerRequests, r)
-	panicif.NotEq(len(b), r.Length.Int())
+	data := MapMustGet(c.readyPeerRequests, r)
 	c.deleteReadyPeerRequest(r)
 	c.lastChunkSent = time.Now()
+	if data.file.Ok {
+		return c.sendFileChunk(r, data.file.Value)
+	}
+	panicif.NotEq(len(data.b), r.Length.Int())
 	return msg(pp.Message{
 		Type:  pp.Piece,
 		Index: r.Index,
 		Begin: r.Begin,
-		Piece: b,
+		Piece: data.b,
 	})
 }
 
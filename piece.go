@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"iter"
 	"sync"
+	"sync/atomic"
 
 	"github.com/RoaringBitmap/roaring"
 	"github.com/anacrolix/chansync"
@@ -60,10 +61,15 @@ type Piece struct {
 	race byte
 	// Currently being hashed.
 	hashing bool
+	// The current hash can fail early if storage reports missing data. Not set when there's newly
+	// written data, so peers aren't blamed for storage quirks.
+	hashCanSkipMissing bool
 	// The piece state may have changed, and is being synchronized with storage.
 	marking bool
 	// The Completion.Ok field cached from the storage layer.
 	storageCompletionOk bool
+	// Unix nanos when the piece was last verified for reading with ClientConfig.VerifyOnRead.
+	readVerified atomic.Int64
 }
 
 func (p *Piece) String() string {
@@ -281,7 +287,7 @@ func (p *Piece) SetPriority(prio PiecePriority) {
 	p.t.updatePiecePriority(p.index, "Piece.SetPriority")
 }
 
-// This is priority based only on piece, file and reader priorities.
+// This is priority based only on piece, file and reader priorities, and piece deadlines.
 func (p *Piece) purePriority() (ret PiecePriority) {
 	for _, f := range p.files() {
 		ret.Raise(f.prio)
@@ -295,6 +301,9 @@ func (p *Piece) purePriority() (ret PiecePriority) {
 	if p.t.readerReadaheadPieces().Contains(bitmap.BitIndex(p.index)) {
 		ret.Raise(PiecePriorityReadahead)
 	}
+	if _, ok := p.t.pieceDeadlines[p.index]; ok {
+		ret.Raise(PiecePriorityNow)
+	}
 	ret.Raise(p.priority)
 	return
 }
@@ -0,0 +1,261 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The number of sequential read streams a ReaderAt tracks for readahead.
+const maxReaderAtStreams = 8
+
+// How long a stream's readahead stays prioritized after its last read.
+const readerAtStreamStaleAfter = time.Minute
+
+// Concurrent random access to Torrent data, for FUSE, WebDAV and HTTP range servers and the like.
+// Reads block until the data is available. The pieces for in-flight reads, and the readahead for
+// reads that continue where earlier ones left off, are prioritized as for Reader. Readahead is
+// shared between callers, so sequential reads split across goroutines or handles are still
+// recognized, and stays prioritized between reads until the stream goes stale or the ReaderAt is
+// closed. Safe for concurrent use. There are Torrent and File constructors for this.
+type ReaderAt interface {
+	// Reads fill b unless they reach the end of the data, or there's an error.
+	io.ReaderAt
+	// Like ReadAt, but stops waiting for data when ctx is done.
+	ReadAtContext(ctx context.Context, b []byte, off int64) (n int, err error)
+	// Sets the readahead for reads, as for Reader.SetReadaheadFunc. ContiguousReadStartPos is where
+	// the reads that a read continues from began.
+	SetReadaheadFunc(ReadaheadFunc)
+	// Don't wait for pieces to complete and be verified, as for Reader.SetResponsive.
+	SetResponsive()
+	// Cancels in-flight reads and stops prioritizing readahead. Later reads return fs.ErrClosed.
+	io.Closer
+}
+
+type readerAt struct {
+	t *Torrent
+	// The extent of the data within the torrent, as for reader.
+	offset, length int64
+
+	closed      context.Context
+	closeCancel context.CancelFunc
+	responsive  atomic.Bool
+
+	mu            sync.Mutex
+	readaheadFunc ReadaheadFunc
+	// Recent sequential reads, most recently used first.
+	streams []*readerAtStream
+}
+
+// A run of contiguous reads.
+type readerAtStream struct {
+	// Where the first read began.
+	start int64
+	// Where the last read ends.
+	end int64
+	// Keeps the readahead from end prioritized between reads, until the stream is dropped.
+	readahead *reader
+	lastRead  time.Time
+	// Drops the stream when it goes stale.
+	staleTimer *time.Timer
+}
+
+var _ ReaderAt = (*readerAt)(nil)
+
+func (t *Torrent) newReaderAt(offset, length int64) ReaderAt {
+	r := &readerAt{
+		t:             t,
+		offset:        offset,
+		length:        length,
+		readaheadFunc: defaultReadaheadFunc,
+	}
+	r.closed, r.closeCancel = context.WithCancel(context.Background())
+	return r
+}
+
+func (r *readerAt) SetReadaheadFunc(f ReadaheadFunc) {
+	r.mu.Lock()
+	r.readaheadFunc = f
+	r.mu.Unlock()
+}
+
+func (r *readerAt) SetResponsive() {
+	r.responsive.Store(true)
+	r.t.cl.event.Broadcast()
+}
+
+func (r *readerAt) Close() error {
+	r.closeCancel()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.t.cl.lock()
+	defer r.t.cl.unlock()
+	for _, s := range r.streams {
+		r.dropStream(s)
+	}
+	r.streams = nil
+	return nil
+}
+
+func (r *readerAt) ReadAt(b []byte, off int64) (n int, err error) {
+	return r.ReadAtContext(context.Background(), b, off)
+}
+
+func (r *readerAt) ReadAtContext(ctx context.Context, b []byte, off int64) (n int, err error) {
+	if r.closed.Err() != nil {
+		return 0, fs.ErrClosed
+	}
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(r.closed, cancel)()
+	read := r.newRead(off, int64(len(b)))
+	defer r.endRead(read)
+	for n < len(b) && err == nil {
+		var m int
+		m, err = read.readContext(ctx, b[n:])
+		n += m
+	}
+	if err != nil && r.closed.Err() != nil {
+		err = fs.ErrClosed
+	}
+	return
+}
+
+// Records a read at off, returning the stream it continues, and any streams that were merged into
+// it or evicted. Concurrent sequential reads can arrive out of order, so streams that the read
+// joins up are merged.
+func (r *readerAt) continueStream(off, size int64) (stream *readerAtStream, dropped []*readerAtStream) {
+	start, end := off, off+size
+	r.streams = slices.DeleteFunc(r.streams, func(s *readerAtStream) bool {
+		if s.start > end || s.end < start {
+			return false
+		}
+		start = min(start, s.start)
+		end = max(end, s.end)
+		if stream == nil {
+			stream = s
+		} else {
+			dropped = append(dropped, s)
+		}
+		return true
+	})
+	if stream == nil {
+		stream = &readerAtStream{}
+		if len(r.streams) == maxReaderAtStreams {
+			dropped = append(dropped, r.streams[len(r.streams)-1])
+			r.streams = r.streams[:len(r.streams)-1]
+		}
+	}
+	stream.start, stream.end = start, end
+	r.streams = slices.Insert(r.streams, 0, stream)
+	return
+}
+
+// Creates a reader for a single ReadAt call. Its pieces are prioritized until endRead. The stream
+// it continues keeps its readahead prioritized after that.
+func (r *readerAt) newRead(off, size int64) *reader {
+	r.mu.Lock()
+	stream, dropped := r.continueStream(off, size)
+	start := stream.start
+	readaheadFunc := r.readaheadFunc
+	r.t.cl.lock()
+	for _, s := range dropped {
+		r.dropStream(s)
+	}
+	// Close may already have dropped the streams.
+	if r.closed.Err() == nil {
+		r.updateStreamReadahead(stream)
+	}
+	r.t.cl.unlock()
+	r.mu.Unlock()
+	read := &reader{
+		mu:                     r.t.cl.locker(),
+		t:                      r.t,
+		offset:                 r.offset,
+		length:                 r.length,
+		readaheadFunc:          readaheadFunc,
+		pos:                    off,
+		contiguousReadStartPos: start,
+		reading:                true,
+		responsive:             r.responsive.Load(),
+	}
+	r.t.addReader(read)
+	return read
+}
+
+// Moves the stream's readahead to its end. Must hold r.mu and the client lock.
+func (r *readerAt) updateStreamReadahead(s *readerAtStream) {
+	s.lastRead = time.Now()
+	if s.readahead == nil {
+		s.readahead = &reader{
+			mu:      r.t.cl.locker(),
+			t:       r.t,
+			offset:  r.offset,
+			length:  r.length,
+			reading: true,
+		}
+		if r.t.readers == nil {
+			r.t.readers = make(map[*reader]struct{})
+		}
+		r.t.readers[s.readahead] = struct{}{}
+		s.staleTimer = time.AfterFunc(readerAtStreamStaleAfter, func() { r.dropIfStale(s) })
+	} else {
+		s.staleTimer.Reset(readerAtStreamStaleAfter)
+	}
+	s.readahead.readaheadFunc = r.readaheadFunc
+	s.readahead.pos = min(s.end, r.length)
+	s.readahead.contiguousReadStartPos = s.start
+	s.readahead.posChanged()
+}
+
+func (r *readerAt) dropIfStale(s *readerAtStream) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// The stream may have been read from since the timer fired.
+	if time.Since(s.lastRead) < readerAtStreamStaleAfter {
+		return
+	}
+	i := slices.Index(r.streams, s)
+	if i == -1 {
+		return
+	}
+	r.streams = slices.Delete(r.streams, i, i+1)
+	r.t.cl.lock()
+	r.dropStream(s)
+	r.t.cl.unlock()
+}
+
+// Stops prioritizing a stream's readahead. Must hold the client lock.
+func (r *readerAt) dropStream(s *readerAtStream) {
+	if s.readahead == nil {
+		return
+	}
+	s.staleTimer.Stop()
+	r.deleteReader(s.readahead)
+	s.readahead = nil
+}
+
+// Stops prioritizing a read's pieces. Unlike Reader.Close, only the read's pieces are updated.
+func (r *readerAt) endRead(read *reader) {
+	r.t.cl.lock()
+	r.deleteReader(read)
+	r.t.cl.unlock()
+	read.clearStorageReader()
+}
+
+// Removes a reader and updates the priorities of its pieces. Must hold the client lock.
+func (r *readerAt) deleteReader(read *reader) {
+	t := r.t
+	delete(t.readers, read)
+	from := read.pieces
+	read.pieces = pieceRange{}
+	t.readerPosChanged(from, read.pieces)
+}
@@ -0,0 +1,164 @@
+package torrent
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestReaderAtConcurrentReads(t *testing.T) {
+	data := make([]byte, 300<<10)
+	rand.New(rand.NewSource(1)).Read(data)
+	dataDir := t.TempDir()
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(dataDir, "data"), data, 0o644)))
+	info := metainfo.Info{PieceLength: 16 << 10}
+	qt.Assert(t, qt.IsNil(info.BuildFromFilePath(filepath.Join(dataDir, "data"))))
+	mi := &metainfo.MetaInfo{InfoBytes: bencode.MustMarshal(&info)}
+
+	cfg := TestingConfig(t)
+	cfg.DataDir = dataDir
+	cfg.Seed = true
+	cfg.MaxAllocPeerRequestDataPerConn = 16 << 10
+	seeder, err := NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer seeder.Close()
+	seederTorrent, err := seeder.AddTorrent(mi)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(seederTorrent.VerifyData()))
+
+	leecher, err := NewClient(TestingConfig(t))
+	qt.Assert(t, qt.IsNil(err))
+	defer leecher.Close()
+	leecherTorrent, err := leecher.AddTorrent(mi)
+	qt.Assert(t, qt.IsNil(err))
+	leecherTorrent.AddClientPeer(seeder)
+	r := leecherTorrent.Files()[0].ReaderAt()
+	defer r.Close()
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(i)))
+			for range 4 {
+				off := rng.Int63n(int64(len(data)))
+				b := make([]byte, rng.Intn(40<<10)+1)
+				n, err := r.ReadAt(b, off)
+				want := data[off:min(off+int64(len(b)), int64(len(data)))]
+				if n < len(b) {
+					qt.Check(t, qt.Equals(err, io.EOF))
+				} else if err != nil {
+					qt.Check(t, qt.Equals(err, io.EOF))
+				}
+				qt.Check(t, qt.DeepEquals(b[:n], want))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestReaderAtContext(t *testing.T) {
+	cl, err := NewClient(TestingConfig(t))
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	tt, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	qt.Assert(t, qt.IsNil(err))
+	r := tt.Files()[0].ReaderAt()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err = r.ReadAtContext(ctx, make([]byte, 1), 1)
+	qt.Check(t, qt.ErrorIs(err, context.DeadlineExceeded))
+	// Closing cancels reads that are waiting for data.
+	go func() {
+		time.Sleep(time.Millisecond)
+		r.Close()
+	}()
+	_, err = r.ReadAt(make([]byte, 1), 1)
+	qt.Check(t, qt.ErrorIs(err, fs.ErrClosed))
+	_, err = r.ReadAt(make([]byte, 1), 1)
+	qt.Check(t, qt.ErrorIs(err, fs.ErrClosed))
+	// Only the reads' own pieces were prioritized.
+	qt.Check(t, qt.HasLen(tt.readers, 0))
+	qt.Check(t, qt.Equals(tt.PieceState(0).Priority, PiecePriorityNone))
+}
+
+func TestReaderAtSharedReadahead(t *testing.T) {
+	r := &readerAt{}
+	start := func(off, size int64) int64 {
+		stream, _ := r.continueStream(off, size)
+		return stream.start
+	}
+	qt.Check(t, qt.Equals(start(100, 10), int64(100)))
+	// Concurrent reads continuing the stream, in any order.
+	qt.Check(t, qt.Equals(start(120, 10), int64(120)))
+	qt.Check(t, qt.Equals(start(110, 10), int64(100)))
+	qt.Check(t, qt.Equals(start(130, 10), int64(100)))
+	qt.Check(t, qt.HasLen(r.streams, 1))
+	qt.Check(t, qt.Equals(start(0, 10), int64(0)))
+	for i := range maxReaderAtStreams {
+		start(int64(1000*(i+1)), 10)
+	}
+	qt.Check(t, qt.HasLen(r.streams, maxReaderAtStreams))
+	// The least recently used stream was dropped.
+	qt.Check(t, qt.Equals(start(10, 10), int64(10)))
+}
+
+// A stream's readahead stays prioritized between reads, until it goes stale or the ReaderAt is
+// closed.
+func TestReaderAtReadaheadBetweenReads(t *testing.T) {
+	const pieceLen = 16 << 10
+	dataDir := t.TempDir()
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(dataDir, "data"), make([]byte, 10*pieceLen), 0o644)))
+	info := metainfo.Info{PieceLength: pieceLen}
+	qt.Assert(t, qt.IsNil(info.BuildFromFilePath(filepath.Join(dataDir, "data"))))
+	cl, err := NewClient(TestingConfig(t))
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	tt, err := cl.AddTorrent(&metainfo.MetaInfo{InfoBytes: bencode.MustMarshal(&info)})
+	qt.Assert(t, qt.IsNil(err))
+	r := tt.Files()[0].ReaderAt()
+	defer r.Close()
+	// There are no peers, so the reads time out, leaving the stream's readahead.
+	read := func(off int64) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		_, err := r.ReadAtContext(ctx, make([]byte, pieceLen), off)
+		qt.Check(t, qt.ErrorIs(err, context.DeadlineExceeded))
+	}
+	read(0)
+	read(pieceLen)
+	// The readahead is as long as the stream, from its end.
+	qt.Check(t, qt.HasLen(tt.readers, 1))
+	qt.Check(t, qt.Equals(tt.PieceState(0).Priority, PiecePriorityNone))
+	qt.Check(t, qt.Not(qt.Equals(tt.PieceState(2).Priority, PiecePriorityNone)))
+	qt.Check(t, qt.Not(qt.Equals(tt.PieceState(3).Priority, PiecePriorityNone)))
+	qt.Check(t, qt.Equals(tt.PieceState(4).Priority, PiecePriorityNone))
+
+	ra := r.(*readerAt)
+	stream := ra.streams[0]
+	ra.mu.Lock()
+	stream.lastRead = time.Now().Add(-readerAtStreamStaleAfter)
+	ra.mu.Unlock()
+	ra.dropIfStale(stream)
+	qt.Check(t, qt.HasLen(tt.readers, 0))
+	qt.Check(t, qt.Equals(tt.PieceState(2).Priority, PiecePriorityNone))
+
+	read(2 * pieceLen)
+	qt.Check(t, qt.HasLen(tt.readers, 1))
+	qt.Check(t, qt.IsNil(r.Close()))
+	qt.Check(t, qt.HasLen(tt.readers, 0))
+	qt.Check(t, qt.Equals(tt.PieceState(3).Priority, PiecePriorityNone))
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"log/slog"
 	"sync"
+	"time"
 
 	"github.com/anacrolix/log"
 	"github.com/anacrolix/missinggo/v2"
@@ -37,6 +38,11 @@ type Reader interface {
 	// the underlying chunks become available. May be deprecated, although BitTorrent v2 will mean
 	// we can support this without piece hashing.
 	SetResponsive()
+	// Set the rate in bytes per second that data is consumed at, as when playing media. While
+	// positive, pieces in the readahead window get deadlines for when playback from the current
+	// position reaches them, and are time-critical as with Torrent.SetPieceDeadline. Missed reader
+	// deadlines aren't reported to Callbacks.PieceDeadlineMissed.
+	SetPlaybackRate(bytesPerSecond int64)
 }
 
 // Piece range by piece index, [begin, end).
@@ -83,6 +89,11 @@ type reader struct {
 	responsive bool
 	// Passive readers avoid triggering piece priority updates while they consume existing data.
 	passive bool
+
+	// See SetPlaybackRate.
+	playbackRate int64
+	// When the reader was last at pos. Playback is expected to continue from there.
+	posTime time.Time
 }
 
 func (r *reader) SetContext(ctx context.Context) {
@@ -110,6 +121,24 @@ func (r *reader) SetReadahead(readahead int64) {
 	r.mu.Unlock()
 }
 
+func (r *reader) SetPlaybackRate(bytesPerSecond int64) {
+	r.mu.Lock()
+	r.playbackRate = bytesPerSecond
+	r.posTime = time.Now()
+	r.t.schedulePieceDeadlineCheck()
+	r.mu.Unlock()
+}
+
+// Returns when playback reaches the piece, if it's in the readahead window and there's a playback
+// rate.
+func (r *reader) pieceDeadline(i pieceIndex) (time.Time, bool) {
+	if r.playbackRate <= 0 || i < r.pieces.begin || i >= r.pieces.end {
+		return time.Time{}, false
+	}
+	ahead := max(r.t.piece(i).torrentBeginOffset()-r.torrentOffset(r.pos), 0)
+	return r.posTime.Add(time.Duration(float64(ahead) / float64(r.playbackRate) * float64(time.Second))), true
+}
+
 func (r *reader) SetReadaheadFunc(f ReadaheadFunc) {
 	r.mu.Lock()
 	r.readaheadFunc = f
@@ -204,6 +233,7 @@ func (r *reader) readContext(ctx context.Context, b []byte) (n int, err error) {
 
 	r.mu.Lock()
 	r.pos += int64(n)
+	r.posTime = time.Now()
 	r.posChanged()
 	r.mu.Unlock()
 	if r.pos >= r.length {
@@ -412,6 +442,9 @@ func (r *reader) posChanged() {
 	r.pieces = to
 	// log.Printf("reader pos changed %v->%v", from, to)
 	r.t.readerPosChanged(from, to)
+	if r.playbackRate > 0 {
+		r.t.schedulePieceDeadlineCheck()
+	}
 }
 
 func (r *reader) Seek(off int64, whence int) (newPos int64, err error) {
@@ -431,6 +464,7 @@ func (r *reader) Seek(off int64, whence int) (newPos int64, err error) {
 	if newPos != r.pos {
 		r.reading = false
 		r.pos = newPos
+		r.posTime = time.Now()
 		r.contiguousReadStartPos = newPos
 		r.posChanged()
 	}
@@ -87,6 +87,9 @@ type desiredPeerRequests struct {
 	requestIndexes []RequestIndex
 	peer           *PeerConn
 	pieceStates    []g.Option[requestStrategy.PieceRequestOrderState]
+	// Deadlines of time-critical pieces, zero for others. nil if there are no time-critical
+	// pieces.
+	pieceDeadlines []time.Time
 }
 
 func (p *desiredPeerRequests) lessByValue(leftRequest, rightRequest RequestIndex) bool {
@@ -124,6 +127,13 @@ func (p *desiredPeerRequests) lessByValue(leftRequest, rightRequest RequestIndex
 		}
 		return leftPriority
 	}()
+	if p.pieceDeadlines != nil {
+		// Time-critical pieces first, earliest deadline first.
+		leftDeadline := p.pieceDeadlines[leftPieceIndex]
+		rightDeadline := p.pieceDeadlines[rightPieceIndex]
+		ml = ml.Bool(leftDeadline.IsZero(), rightDeadline.IsZero())
+		ml = ml.CmpInt64(leftDeadline.Sub(rightDeadline).Nanoseconds())
+	}
 	if ml.Ok() {
 		return ml.MustLess()
 	}
@@ -183,6 +193,14 @@ func (p *desiredPeerRequests) lessByValue(leftRequest, rightRequest RequestIndex
 	return ml.MustLess()
 }
 
+// Returns the deadline for the request's piece, or zero if it isn't time-critical.
+func (p *desiredPeerRequests) pieceDeadline(r RequestIndex) time.Time {
+	if p.pieceDeadlines == nil {
+		return time.Time{}
+	}
+	return p.pieceDeadlines[p.peer.t.pieceIndexOfRequestIndex(r)]
+}
+
 type desiredRequestState struct {
 	Requests   desiredPeerRequests
 	Interested bool
@@ -221,6 +239,14 @@ func (p *PeerConn) getDesiredRequestState() (desired desiredRequestState) {
 		requestIndexes: t.requestIndexes,
 	}
 	clear(requestHeap.pieceStates)
+	if t.haveTimeCriticalPieces() {
+		if len(t.requestPieceDeadlines) != t.numPieces() {
+			g.MakeSliceWithLength(&t.requestPieceDeadlines, t.numPieces())
+		} else {
+			clear(t.requestPieceDeadlines)
+		}
+		requestHeap.pieceDeadlines = t.requestPieceDeadlines
+	}
 	t.logPieceRequestOrder()
 	// Caller-provided allocation for roaring bitmap iteration.
 	var it typedRoaring.Iterator[RequestIndex]
@@ -232,6 +258,14 @@ func (p *PeerConn) getDesiredRequestState() (desired desiredRequestState) {
 			if !p.peerHasPiece(pieceIndex) {
 				return true
 			}
+			if requestHeap.pieceDeadlines != nil {
+				if deadline, ok := t.pieceDeadline(pieceIndex); ok {
+					if !t.peerMayRequestTimeCritical(p, pieceIndex, deadline) {
+						return true
+					}
+					requestHeap.pieceDeadlines[pieceIndex] = deadline
+				}
+			}
 			requestHeap.pieceStates[pieceIndex].Set(pieceExtra)
 			allowedFast := p.peerAllowedFast.Contains(pieceIndex)
 			t.iterUndirtiedRequestIndexesInPiece(&it, pieceIndex, func(r requestStrategy.RequestIndex) {
@@ -388,6 +422,8 @@ func (p *PeerConn) applyRequestState(next desiredRequestState) {
 				// Endgame: allow duplicate requests to multiple peers for the
 				// last few pieces so completion isn't bottlenecked by one slow peer.
 				// Don't cancel the existing request — just send a duplicate.
+			} else if deadline := next.Requests.pieceDeadline(req); !deadline.IsZero() && t.requestAtRisk(req, deadline) {
+				// Likewise for time-critical pieces that might otherwise miss their deadlines.
 			} else {
 				// don't steal on cancel - because this is triggered by t.cancelRequest below
 				// which means that the cancelled can immediately try to steal back a request
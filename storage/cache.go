@@ -0,0 +1,486 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	g "github.com/anacrolix/generics"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// The default memory budget for a Cache.
+const DefaultCacheCapacity = 64 << 20
+
+type NewCacheOpts struct {
+	// The most memory to use for cached piece data, dirty or clean. Defaults to
+	// DefaultCacheCapacity. Pieces larger than this bypass the cache.
+	Capacity int64
+}
+
+// Wraps another storage, buffering writes in memory per piece and caching whole complete pieces for
+// reads. Buffered writes are coalesced and written to the underlying storage when the piece is
+// marked complete, when the torrent storage is flushed or closed, or when the memory budget is
+// exceeded. Memory is allocated a piece at a time, so the budget should be a good multiple of the
+// piece length.
+type Cache struct {
+	inner ClientImpl
+	opts  NewCacheOpts
+
+	mu sync.Mutex
+	// Entries by torrent and piece. Protected by mu, as are the fields of entries that aren't data.
+	entries     map[*cacheTorrent]map[int]*cacheEntry
+	cachedBytes int64
+	tick        uint64
+
+	dirtyBytes atomic.Int64
+	readHits   atomic.Int64
+	readMisses atomic.Int64
+}
+
+var _ ClientImplCloser = (*Cache)(nil)
+
+func NewCache(inner ClientImpl, opts NewCacheOpts) *Cache {
+	if opts.Capacity <= 0 {
+		opts.Capacity = DefaultCacheCapacity
+	}
+	return &Cache{
+		inner:   inner,
+		opts:    opts,
+		entries: make(map[*cacheTorrent]map[int]*cacheEntry),
+	}
+}
+
+// Closes the underlying storage if it's a ClientImplCloser. Torrents should be closed first to
+// write out buffered data.
+func (c *Cache) Close() error {
+	if closer, ok := c.inner.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+type CacheStats struct {
+	// Reads served from memory, and reads that went to the underlying storage.
+	ReadHits   int64
+	ReadMisses int64
+	// Piece data held in memory, and how much of it hasn't been written to the underlying storage.
+	CachedBytes int64
+	DirtyBytes  int64
+}
+
+// The fraction of reads served from memory.
+func (me CacheStats) HitRate() float64 {
+	total := me.ReadHits + me.ReadMisses
+	if total == 0 {
+		return 0
+	}
+	return float64(me.ReadHits) / float64(total)
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	cachedBytes := c.cachedBytes
+	c.mu.Unlock()
+	return CacheStats{
+		ReadHits:    c.readHits.Load(),
+		ReadMisses:  c.readMisses.Load(),
+		CachedBytes: cachedBytes,
+		DirtyBytes:  c.dirtyBytes.Load(),
+	}
+}
+
+func (c *Cache) OpenTorrent(ctx context.Context, info *metainfo.Info, infoHash metainfo.Hash) (TorrentImpl, error) {
+	inner, err := c.inner.OpenTorrent(ctx, info, infoHash)
+	if err != nil {
+		return inner, err
+	}
+	t := &cacheTorrent{
+		c:     c,
+		inner: Torrent{inner},
+	}
+	ret := inner
+	ret.Piece = t.Piece
+	ret.PieceWithHash = t.PieceWithHash
+	ret.Flush = t.Flush
+	ret.Close = t.Close
+	return ret, nil
+}
+
+type cacheKey struct {
+	t     *cacheTorrent
+	piece int
+}
+
+type cacheEntry struct {
+	key cacheKey
+	// Protects data and the extents. Acquired before Cache.mu when both are held.
+	mu      sync.Mutex
+	data    []byte
+	valid   extents
+	dirty   extents
+	inner   Piece
+	removed bool
+	// Protected by Cache.mu.
+	lastUsed uint64
+}
+
+type cacheTorrent struct {
+	c     *Cache
+	inner Torrent
+}
+
+func (t *cacheTorrent) Piece(p metainfo.Piece) PieceImpl {
+	return t.PieceWithHash(p, g.None[[]byte]())
+}
+
+func (t *cacheTorrent) PieceWithHash(p metainfo.Piece, pieceHash g.Option[[]byte]) PieceImpl {
+	inner := t.inner.PieceWithHash(p, pieceHash)
+	if p.Length() > t.c.opts.Capacity {
+		return inner
+	}
+	return &cachePiece{
+		t:     t,
+		key:   cacheKey{t, p.Index()},
+		inner: inner,
+	}
+}
+
+// Writes out and drops the torrent's entries.
+func (t *cacheTorrent) flushEntries() (err error) {
+	for _, e := range t.c.torrentEntries(t) {
+		e.mu.Lock()
+		err = e.flush(t.c)
+		if err == nil {
+			t.c.remove(e)
+		}
+		e.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (t *cacheTorrent) Flush() error {
+	err := t.flushEntries()
+	if err != nil {
+		return err
+	}
+	if t.inner.Flush != nil {
+		return t.inner.Flush()
+	}
+	return nil
+}
+
+func (t *cacheTorrent) Close() error {
+	err := t.flushEntries()
+	if err != nil {
+		return err
+	}
+	if t.inner.Close != nil {
+		return t.inner.Close()
+	}
+	return nil
+}
+
+func (c *Cache) torrentEntries(t *cacheTorrent) (ret []*cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Collect(maps.Values(c.entries[t]))
+}
+
+// Returns the entry for the key, creating it if create is set. The entry is marked as recently
+// used.
+func (c *Cache) entry(key cacheKey, inner Piece, create bool) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key.t][key.piece]
+	if !ok {
+		if !create {
+			return nil
+		}
+		e = &cacheEntry{
+			key:   key,
+			data:  make([]byte, inner.mip.Length()),
+			inner: inner,
+		}
+		if c.entries[key.t] == nil {
+			c.entries[key.t] = make(map[int]*cacheEntry)
+		}
+		c.entries[key.t][key.piece] = e
+		c.cachedBytes += int64(len(e.data))
+	}
+	c.tick++
+	e.lastUsed = c.tick
+	return e
+}
+
+// Drops an entry. The entry must be locked.
+func (c *Cache) remove(e *cacheEntry) {
+	if e.removed {
+		return
+	}
+	e.removed = true
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	torrentEntries := c.entries[e.key.t]
+	delete(torrentEntries, e.key.piece)
+	if len(torrentEntries) == 0 {
+		delete(c.entries, e.key.t)
+	}
+	c.cachedBytes -= int64(len(e.data))
+}
+
+// Writes out and drops least recently used entries, preferring clean ones, until the cache is
+// within its budget.
+func (c *Cache) evict() error {
+	for {
+		c.mu.Lock()
+		if c.cachedBytes <= c.opts.Capacity {
+			c.mu.Unlock()
+			return nil
+		}
+		var victim, dirtyVictim *cacheEntry
+		for e := range c.allEntries() {
+			// Reading the dirty extents without the entry lock is racy, but only affects which
+			// entry is chosen.
+			if e.dirtyLen() == 0 {
+				if victim == nil || e.lastUsed < victim.lastUsed {
+					victim = e
+				}
+			} else if dirtyVictim == nil || e.lastUsed < dirtyVictim.lastUsed {
+				dirtyVictim = e
+			}
+		}
+		c.mu.Unlock()
+		if victim == nil {
+			victim = dirtyVictim
+		}
+		victim.mu.Lock()
+		err := victim.flush(c)
+		if err == nil {
+			c.remove(victim)
+		}
+		victim.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Must hold mu.
+func (c *Cache) allEntries() iter.Seq[*cacheEntry] {
+	return func(yield func(*cacheEntry) bool) {
+		for _, torrentEntries := range c.entries {
+			for _, e := range torrentEntries {
+				if !yield(e) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *cacheEntry) dirtyLen() int64 {
+	return e.dirty.len.Load()
+}
+
+// Writes dirty data to the underlying storage. The entry must be locked.
+func (e *cacheEntry) flush(c *Cache) error {
+	for _, ext := range e.dirty.list {
+		_, err := e.inner.WriteAt(e.data[ext.start:ext.end], ext.start)
+		if err != nil {
+			return err
+		}
+	}
+	c.dirtyBytes.Add(-e.dirty.len.Load())
+	e.dirty.clear()
+	return nil
+}
+
+type cachePiece struct {
+	t     *cacheTorrent
+	key   cacheKey
+	inner Piece
+}
+
+func (p *cachePiece) c() *Cache {
+	return p.t.c
+}
+
+// Returns the locked entry for the piece, or nil if there isn't one and create is false.
+func (p *cachePiece) lockEntry(create bool) *cacheEntry {
+	for {
+		e := p.c().entry(p.key, p.inner, create)
+		if e == nil {
+			return nil
+		}
+		e.mu.Lock()
+		if !e.removed {
+			return e
+		}
+		e.mu.Unlock()
+	}
+}
+
+func (p *cachePiece) WriteAt(b []byte, off int64) (n int, err error) {
+	if length := p.inner.mip.Length(); off < 0 || off+int64(len(b)) > length {
+		return 0, fmt.Errorf("write of %v bytes at %v is outside piece of length %v", len(b), off, length)
+	}
+	e := p.lockEntry(true)
+	n = copy(e.data[off:], b)
+	e.valid.add(off, off+int64(n))
+	p.c().dirtyBytes.Add(e.dirty.add(off, off+int64(n)))
+	e.mu.Unlock()
+	err = p.c().evict()
+	return
+}
+
+func (p *cachePiece) ReadAt(b []byte, off int64) (n int, err error) {
+	length := p.inner.mip.Length()
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %v", off)
+	}
+	if off >= length {
+		return 0, io.EOF
+	}
+	end := min(off+int64(len(b)), length)
+	if e := p.lockEntry(false); e != nil {
+		if e.valid.contains(off, end) {
+			n = copy(b, e.data[off:end])
+			e.mu.Unlock()
+			p.c().readHits.Add(1)
+			if n < len(b) {
+				err = io.EOF
+			}
+			return
+		}
+		// Make sure the underlying storage has everything we know about.
+		err = e.flush(p.c())
+		e.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+	p.c().readMisses.Add(1)
+	if !p.inner.Completion().Complete {
+		return p.inner.ReadAt(b, off)
+	}
+	// Complete pieces are likely to be read again while seeding, so read and keep all of it.
+	e := p.lockEntry(true)
+	err = e.flush(p.c())
+	if err == nil {
+		_, err = io.ReadFull(io.NewSectionReader(p.inner, 0, int64(len(e.data))), e.data)
+	}
+	if err != nil {
+		p.c().remove(e)
+		e.mu.Unlock()
+		return p.inner.ReadAt(b, off)
+	}
+	e.valid.add(0, int64(len(e.data)))
+	n = copy(b, e.data[off:end])
+	e.mu.Unlock()
+	if n < len(b) {
+		err = io.EOF
+	}
+	if evictErr := p.c().evict(); err == nil {
+		err = evictErr
+	}
+	return
+}
+
+func (p *cachePiece) MarkComplete() error {
+	if e := p.lockEntry(false); e != nil {
+		err := e.flush(p.c())
+		e.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return p.inner.MarkComplete()
+}
+
+func (p *cachePiece) MarkNotComplete() error {
+	if e := p.lockEntry(false); e != nil {
+		// The data may still be wanted by the underlying storage, even if it's bad.
+		err := e.flush(p.c())
+		if err == nil {
+			p.c().remove(e)
+		}
+		e.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return p.inner.MarkNotComplete()
+}
+
+func (p *cachePiece) Completion() Completion {
+	return p.inner.Completion()
+}
+
+// A sorted list of non-overlapping, non-adjacent byte ranges.
+type extents struct {
+	list []extent
+	// The total length of the ranges. Atomic so it can be inspected without a lock.
+	len atomic.Int64
+}
+
+type extent struct {
+	start, end int64
+}
+
+// Adds a range, returning how many bytes weren't already included.
+func (me *extents) add(start, end int64) (added int64) {
+	if start >= end {
+		return
+	}
+	merged := extent{start, end}
+	var ret []extent
+	var covered int64
+	inserted := false
+	for _, e := range me.list {
+		switch {
+		case e.end < merged.start:
+			ret = append(ret, e)
+		case e.start > merged.end:
+			if !inserted {
+				ret = append(ret, merged)
+				inserted = true
+			}
+			ret = append(ret, e)
+		default:
+			covered += min(e.end, end) - max(e.start, start)
+			merged.start = min(merged.start, e.start)
+			merged.end = max(merged.end, e.end)
+		}
+	}
+	if !inserted {
+		ret = append(ret, merged)
+	}
+	me.list = ret
+	added = end - start - max(covered, 0)
+	me.len.Add(added)
+	return
+}
+
+func (me *extents) contains(start, end int64) bool {
+	for _, e := range me.list {
+		if e.start <= start && e.end >= end {
+			return true
+		}
+	}
+	return start >= end
+}
+
+func (me *extents) clear() {
+	me.list = nil
+	me.len.Store(0)
+}
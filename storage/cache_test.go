@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Counts I/O that reaches the wrapped storage.
+type countingClient struct {
+	ClientImpl
+	reads, writes atomic.Int64
+}
+
+func (me *countingClient) OpenTorrent(ctx context.Context, info *metainfo.Info, infoHash metainfo.Hash) (TorrentImpl, error) {
+	t, err := me.ClientImpl.OpenTorrent(ctx, info, infoHash)
+	piece := t.Piece
+	t.Piece = func(p metainfo.Piece) PieceImpl {
+		return countingPiece{piece(p), me}
+	}
+	t.PieceWithHash = nil
+	return t, err
+}
+
+type countingPiece struct {
+	PieceImpl
+	cl *countingClient
+}
+
+func (me countingPiece) ReadAt(b []byte, off int64) (int, error) {
+	me.cl.reads.Add(1)
+	return me.PieceImpl.ReadAt(b, off)
+}
+
+func (me countingPiece) WriteAt(b []byte, off int64) (int, error) {
+	me.cl.writes.Add(1)
+	return me.PieceImpl.WriteAt(b, off)
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	inner := &countingClient{ClientImpl: NewFileOpts(NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: NewMapPieceCompletion(),
+	})}
+	const pieceLen = 4 << 10
+	cache := NewCache(inner, NewCacheOpts{Capacity: 2 * pieceLen})
+	info := &metainfo.Info{
+		Name:        "a",
+		Length:      3 * pieceLen,
+		PieceLength: pieceLen,
+		Pieces:      make([]byte, 3*metainfo.HashSize),
+	}
+	ts, err := NewClient(cache).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	data := bytes.Repeat([]byte("abcdefgh"), 3*pieceLen/8)
+	read := func(i int) []byte {
+		var buf bytes.Buffer
+		_, err := io.Copy(&buf, io.NewSectionReader(ts.Piece(info.Piece(i)), 0, pieceLen))
+		qt.Assert(t, qt.IsNil(err))
+		return buf.Bytes()
+	}
+
+	// Chunks are coalesced into a single write when the piece completes.
+	p0 := ts.Piece(info.Piece(0))
+	for off := 0; off < pieceLen; off += 1 << 10 {
+		_, err = p0.WriteAt(data[off:off+1<<10], int64(off))
+		qt.Assert(t, qt.IsNil(err))
+	}
+	qt.Check(t, qt.Equals(inner.writes.Load(), 0))
+	qt.Check(t, qt.Equals(cache.Stats().DirtyBytes, pieceLen))
+	qt.Check(t, qt.IsTrue(bytes.Equal(read(0), data[:pieceLen])))
+	qt.Check(t, qt.Equals(inner.reads.Load(), 0))
+	qt.Assert(t, qt.IsNil(p0.MarkComplete()))
+	qt.Check(t, qt.Equals(inner.writes.Load(), 1))
+	qt.Check(t, qt.Equals(cache.Stats().DirtyBytes, 0))
+
+	// Exceeding the budget drops the least recently used piece, preferring clean ones.
+	for i := 1; i < 3; i++ {
+		_, err = ts.Piece(info.Piece(i)).WriteAt(data[i*pieceLen:(i+1)*pieceLen], 0)
+		qt.Assert(t, qt.IsNil(err))
+	}
+	qt.Check(t, qt.Equals(inner.writes.Load(), 1))
+	qt.Check(t, qt.Equals(cache.Stats().CachedBytes, 2*pieceLen))
+	qt.Assert(t, qt.IsNil(ts.Flush()))
+	qt.Check(t, qt.Equals(inner.writes.Load(), 3))
+	b, err := os.ReadFile(filepath.Join(dir, "a.part"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.IsTrue(bytes.Equal(b, data)))
+
+	// Complete pieces are read once and then served from memory.
+	reads := inner.reads.Load()
+	before := cache.Stats()
+	qt.Check(t, qt.IsTrue(bytes.Equal(read(0), data[:pieceLen])))
+	qt.Check(t, qt.IsTrue(bytes.Equal(read(0), data[:pieceLen])))
+	qt.Check(t, qt.Equals(inner.reads.Load()-reads, 1))
+	stats := cache.Stats()
+	qt.Check(t, qt.Equals(stats.ReadMisses-before.ReadMisses, 1))
+	qt.Check(t, qt.IsTrue(stats.ReadHits > before.ReadHits))
+	// Reads past the end of a cached piece fail without touching its data.
+	n, err := ts.Piece(info.Piece(0)).PieceImpl.ReadAt(make([]byte, 1), pieceLen+1)
+	qt.Check(t, qt.Equals(n, 0))
+	qt.Check(t, qt.Equals(err, io.EOF))
+	// Writes and reads outside the piece fail instead of panicking.
+	pi := ts.Piece(info.Piece(0)).PieceImpl
+	_, err = pi.WriteAt(make([]byte, 1), -1)
+	qt.Check(t, qt.IsNotNil(err))
+	_, err = pi.WriteAt(make([]byte, 2), pieceLen-1)
+	qt.Check(t, qt.IsNotNil(err))
+	_, err = pi.ReadAt(make([]byte, 1), -1)
+	qt.Check(t, qt.IsNotNil(err))
+	qt.Assert(t, qt.IsNil(ts.Close()))
+	qt.Check(t, qt.Equals(cache.Stats().CachedBytes, 0))
+}
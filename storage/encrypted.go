@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	g "github.com/anacrolix/generics"
+	"golang.org/x/crypto/chacha20"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Returns the 32 byte key to encrypt a torrent's data with. The same key can be used for every
+// torrent.
+type EncryptionKeyFunc func(ctx context.Context, infoHash metainfo.Hash) ([]byte, error)
+
+type NewEncryptedOpts struct {
+	Key EncryptionKeyFunc
+}
+
+type encryptedClient struct {
+	inner ClientImpl
+	opts  NewEncryptedOpts
+}
+
+// Wraps another storage so piece data is encrypted with XChaCha20 before it's stored. The cipher is
+// seeked to the piece offset, so the ciphertext has the same layout as the plaintext and pieces
+// remain randomly accessible. The nonce is the infohash and the piece index, so a key can be reused
+// across torrents. There's no authentication, as pieces are verified by their hashes, which are
+// computed over the decrypted data. Rewriting a piece, such as after it fails its hash check,
+// reuses its keystream.
+func NewEncrypted(inner ClientImpl, opts NewEncryptedOpts) ClientImplCloser {
+	return &encryptedClient{inner, opts}
+}
+
+func (me *encryptedClient) Close() error {
+	if closer, ok := me.inner.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (me *encryptedClient) OpenTorrent(ctx context.Context, info *metainfo.Info, infoHash metainfo.Hash) (_ TorrentImpl, err error) {
+	key, err := me.opts.Key(ctx, infoHash)
+	if err != nil {
+		err = fmt.Errorf("getting key: %w", err)
+		return
+	}
+	if len(key) != chacha20.KeySize {
+		err = fmt.Errorf("key is %v bytes, expected %v", len(key), chacha20.KeySize)
+		return
+	}
+	inner, err := me.inner.OpenTorrent(ctx, info, infoHash)
+	if err != nil {
+		return
+	}
+	t := &encryptedTorrent{
+		inner:    Torrent{inner},
+		key:      key,
+		infoHash: infoHash,
+	}
+	ret := inner
+	ret.Piece = t.Piece
+	ret.PieceWithHash = t.PieceWithHash
+	return ret, nil
+}
+
+type encryptedTorrent struct {
+	inner    Torrent
+	key      []byte
+	infoHash metainfo.Hash
+}
+
+func (t *encryptedTorrent) Piece(p metainfo.Piece) PieceImpl {
+	return t.PieceWithHash(p, g.None[[]byte]())
+}
+
+func (t *encryptedTorrent) PieceWithHash(p metainfo.Piece, pieceHash g.Option[[]byte]) PieceImpl {
+	var nonce [chacha20.NonceSizeX]byte
+	n := copy(nonce[:], t.infoHash[:])
+	binary.BigEndian.PutUint32(nonce[n:], uint32(p.Index()))
+	ep := encryptedPiece{
+		inner: t.inner.PieceWithHash(p, pieceHash),
+		key:   t.key,
+		nonce: nonce,
+	}
+	// The inner piece's optional interfaces would see ciphertext, so only those that we can
+	// decrypt through are exposed. Notably SelfHashing isn't.
+	if _, ok := ep.inner.PieceImpl.(PieceReaderer); ok {
+		return encryptedPieceReaderer{ep}
+	}
+	return ep
+}
+
+type encryptedPiece struct {
+	inner Piece
+	key   []byte
+	nonce [chacha20.NonceSizeX]byte
+}
+
+// XORs the keystream for the piece at off into b.
+func (p encryptedPiece) xorKeyStream(b []byte, off int64) {
+	c, err := chacha20.NewUnauthenticatedCipher(p.key, p.nonce[:])
+	if err != nil {
+		// The key and nonce sizes are checked on open.
+		panic(err)
+	}
+	const blockSize = 64
+	c.SetCounter(uint32(off / blockSize))
+	if skip := off % blockSize; skip != 0 {
+		var discard [blockSize]byte
+		c.XORKeyStream(discard[:skip], discard[:skip])
+	}
+	c.XORKeyStream(b, b)
+}
+
+func (p encryptedPiece) ReadAt(b []byte, off int64) (n int, err error) {
+	n, err = p.inner.ReadAt(b, off)
+	p.xorKeyStream(b[:n], off)
+	return
+}
+
+func (p encryptedPiece) WriteAt(b []byte, off int64) (n int, err error) {
+	ct := make([]byte, len(b))
+	copy(ct, b)
+	p.xorKeyStream(ct, off)
+	return p.inner.WriteAt(ct, off)
+}
+
+func (p encryptedPiece) WriteTo(w io.Writer) (int64, error) {
+	return p.inner.WriteTo(&decryptingWriter{p: p, w: w})
+}
+
+func (p encryptedPiece) MarkComplete() error {
+	return p.inner.MarkComplete()
+}
+
+func (p encryptedPiece) MarkNotComplete() error {
+	return p.inner.MarkNotComplete()
+}
+
+func (p encryptedPiece) Completion() Completion {
+	return p.inner.Completion()
+}
+
+// Decrypts a piece written sequentially from its start.
+type decryptingWriter struct {
+	p   encryptedPiece
+	w   io.Writer
+	off int64
+	buf []byte
+}
+
+func (me *decryptingWriter) Write(b []byte) (n int, err error) {
+	me.buf = append(me.buf[:0], b...)
+	me.p.xorKeyStream(me.buf, me.off)
+	n, err = me.w.Write(me.buf)
+	me.off += int64(n)
+	return
+}
+
+type encryptedPieceReaderer struct {
+	encryptedPiece
+}
+
+func (p encryptedPieceReaderer) NewReader() (PieceReader, error) {
+	r, err := p.inner.PieceImpl.(PieceReaderer).NewReader()
+	if err != nil {
+		return nil, err
+	}
+	return encryptedPieceReader{r, p.encryptedPiece}, nil
+}
+
+type encryptedPieceReader struct {
+	PieceReader
+	p encryptedPiece
+}
+
+func (r encryptedPieceReader) ReadAt(b []byte, off int64) (n int, err error) {
+	n, err = r.PieceReader.ReadAt(b, off)
+	r.p.xorKeyStream(b[:n], off)
+	return
+}
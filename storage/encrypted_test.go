@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	key := bytes.Repeat([]byte{1}, 32)
+	ci := NewEncrypted(NewFileOpts(NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: NewMapPieceCompletion(),
+	}), NewEncryptedOpts{
+		Key: func(ctx context.Context, infoHash metainfo.Hash) ([]byte, error) {
+			return key, nil
+		},
+	})
+	defer ci.Close()
+	data := bytes.Repeat([]byte("plaintext"), 100)
+	info := &metainfo.Info{
+		Name:        "a",
+		Length:      int64(len(data)),
+		PieceLength: 512,
+	}
+	for off := 0; off < len(data); off += int(info.PieceLength) {
+		h := sha1.Sum(data[off:min(off+int(info.PieceLength), len(data))])
+		info.Pieces = append(info.Pieces, h[:]...)
+	}
+	ts, err := NewClient(ci).OpenTorrent(context.Background(), info, metainfo.HashBytes([]byte("a")))
+	qt.Assert(t, qt.IsNil(err))
+	for i := range info.NumPieces() {
+		mp := info.Piece(i)
+		p := ts.Piece(mp)
+		pieceData := data[mp.Offset() : mp.Offset()+mp.Length()]
+		// Unaligned writes, so the keystream is seeked into the middle of blocks.
+		for off := int64(0); off < mp.Length(); off += 100 {
+			_, err = p.WriteAt(pieceData[off:min(off+100, mp.Length())], off)
+			qt.Assert(t, qt.IsNil(err))
+		}
+		// Pieces hash correctly through the wrapper.
+		h := sha1.New()
+		_, err = p.WriteTo(h)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.IsTrue(bytes.Equal(h.Sum(nil), mp.V1Hash().Unwrap().Bytes())))
+		qt.Assert(t, qt.IsNil(p.MarkComplete()))
+		b := make([]byte, 77)
+		n, err := p.ReadAt(b, 33)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.IsTrue(bytes.Equal(b[:n], pieceData[33:110])))
+	}
+	// What's on disk isn't the plaintext.
+	b, err := os.ReadFile(filepath.Join(dir, "a"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.HasLen(b, len(data)))
+	qt.Check(t, qt.IsFalse(bytes.Contains(b, []byte("plaintext"))))
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, io.NewSectionReader(ts.Piece(info.Piece(1)), 0, info.Piece(1).Length()))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.IsTrue(bytes.Equal(buf.Bytes(), data[512:])))
+
+	// A bad key is rejected.
+	_, err = NewEncrypted(ci, NewEncryptedOpts{
+		Key: func(context.Context, metainfo.Hash) ([]byte, error) { return key[:16], nil },
+	}).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Check(t, qt.IsNotNil(err))
+}
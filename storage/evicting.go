@@ -0,0 +1,337 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+
+	g "github.com/anacrolix/generics"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+type NewEvictingOpts struct {
+	// The most bytes of complete piece data to keep, across all torrents opened with the storage.
+	Capacity int64
+	// Defaults to slog.Default.
+	Logger *slog.Logger
+}
+
+// Wraps another storage, such as file or mmap storage, to keep the complete pieces of all its
+// torrents within a byte budget. When a piece completes and the budget is exceeded, the least
+// recently read complete pieces are evicted. Pieces being read, and pieces that the torrent's readers
+// are using, are kept. Evicting uses PieceEvicter if the inner storage implements it, and otherwise
+// just marks the piece not complete. Reads from evicted pieces fail until the piece is written
+// again, so the client notices and downloads it again.
+type Evicting struct {
+	inner   ClientImpl
+	opts    NewEvictingOpts
+	capFunc func() (int64, bool)
+
+	mu sync.Mutex
+	// Complete pieces. Protected by mu, as are the fields of evictingPiece.
+	complete map[evictingKey]*evictingPiece
+	// Complete pieces, most recently used at the front.
+	lru  list.List
+	used int64
+}
+
+var _ ClientImplCloser = (*Evicting)(nil)
+
+func NewEvicting(inner ClientImpl, opts NewEvictingOpts) *Evicting {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	e := &Evicting{
+		inner:    inner,
+		opts:     opts,
+		complete: make(map[evictingKey]*evictingPiece),
+	}
+	e.capFunc = func() (int64, bool) {
+		return e.opts.Capacity, true
+	}
+	return e
+}
+
+// Closes the underlying storage if it's a ClientImplCloser.
+func (e *Evicting) Close() error {
+	if closer, ok := e.inner.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Returns the bytes of complete piece data currently stored.
+func (e *Evicting) Used() int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.used
+}
+
+func (e *Evicting) OpenTorrent(ctx context.Context, info *metainfo.Info, infoHash metainfo.Hash) (TorrentImpl, error) {
+	inner, err := e.inner.OpenTorrent(ctx, info, infoHash)
+	if err != nil {
+		return inner, err
+	}
+	t := &evictingTorrent{
+		e:          e,
+		inner:      Torrent{inner},
+		info:       info,
+		evicted:    make(map[int]struct{}),
+		pieceLocks: make([]sync.RWMutex, info.NumPieces()),
+	}
+	// Account for what's already stored.
+	for i := range info.NumPieces() {
+		p := info.Piece(i)
+		if t.inner.PieceWithHash(p, g.None[[]byte]()).Completion().Complete {
+			e.mu.Lock()
+			e.addComplete(evictingKey{t, i}, p.Length())
+			e.mu.Unlock()
+		}
+	}
+	e.evict()
+	ret := inner
+	ret.Piece = t.Piece
+	ret.PieceWithHash = t.PieceWithHash
+	ret.Close = t.Close
+	ret.Capacity = &e.capFunc
+	ret.SetReaderPieces = t.setReaderPieces
+	return ret, nil
+}
+
+type evictingKey struct {
+	t     *evictingTorrent
+	piece int
+}
+
+type evictingPiece struct {
+	key    evictingKey
+	length int64
+	// The piece's element in Evicting.lru.
+	elem *list.Element
+	// Reads in progress.
+	readers int
+}
+
+type evictingTorrent struct {
+	e     *Evicting
+	inner Torrent
+	info  *metainfo.Info
+	// These are protected by Evicting.mu.
+	readerPieces []int
+	evicted      map[int]struct{}
+	closed       bool
+	// Held for writing while a piece is evicted, and for reading while it's written, so a piece
+	// that's rewritten isn't evicted underneath the write.
+	pieceLocks []sync.RWMutex
+}
+
+func (t *evictingTorrent) Piece(p metainfo.Piece) PieceImpl {
+	return t.PieceWithHash(p, g.None[[]byte]())
+}
+
+func (t *evictingTorrent) PieceWithHash(p metainfo.Piece, pieceHash g.Option[[]byte]) PieceImpl {
+	return &evictingPieceImpl{
+		t:     t,
+		key:   evictingKey{t, p.Index()},
+		inner: t.inner.PieceWithHash(p, pieceHash),
+	}
+}
+
+func (t *evictingTorrent) setReaderPieces(pieces []int) {
+	t.e.mu.Lock()
+	t.readerPieces = pieces
+	t.e.mu.Unlock()
+	if t.inner.SetReaderPieces != nil {
+		t.inner.SetReaderPieces(pieces)
+	}
+}
+
+func (t *evictingTorrent) Close() error {
+	t.e.mu.Lock()
+	t.closed = true
+	for k := range t.e.complete {
+		if k.t == t {
+			t.e.removeComplete(k)
+		}
+	}
+	t.e.mu.Unlock()
+	if t.inner.Close != nil {
+		return t.inner.Close()
+	}
+	return nil
+}
+
+// Must hold mu.
+func (e *Evicting) addComplete(key evictingKey, length int64) {
+	if key.t.closed {
+		return
+	}
+	delete(key.t.evicted, key.piece)
+	if _, ok := e.complete[key]; ok {
+		return
+	}
+	p := &evictingPiece{
+		key:    key,
+		length: length,
+	}
+	p.elem = e.lru.PushFront(p)
+	e.complete[key] = p
+	e.used += length
+}
+
+// Must hold mu.
+func (e *Evicting) removeComplete(key evictingKey) {
+	p, ok := e.complete[key]
+	if !ok {
+		return
+	}
+	delete(e.complete, key)
+	e.lru.Remove(p.elem)
+	e.used -= p.length
+}
+
+// Evicts least recently used pieces that aren't in use until within the budget, or there's nothing
+// left that can be evicted.
+func (e *Evicting) evict() {
+	for {
+		e.mu.Lock()
+		if e.used <= e.opts.Capacity {
+			e.mu.Unlock()
+			return
+		}
+		var victim *evictingPiece
+		for elem := e.lru.Back(); elem != nil; elem = elem.Prev() {
+			p := elem.Value.(*evictingPiece)
+			if p.readers != 0 {
+				continue
+			}
+			if _, found := slices.BinarySearch(p.key.t.readerPieces, p.key.piece); found {
+				continue
+			}
+			victim = p
+			break
+		}
+		if victim == nil {
+			e.mu.Unlock()
+			return
+		}
+		victimKey := victim.key
+		e.removeComplete(victimKey)
+		victimKey.t.evicted[victimKey.piece] = struct{}{}
+		e.mu.Unlock()
+		err := victimKey.t.evictInner(victimKey.piece)
+		if err != nil {
+			e.opts.Logger.Error("evicting piece", "piece", victimKey.piece, "err", err)
+		}
+	}
+}
+
+func (t *evictingTorrent) evictInner(piece int) error {
+	t.pieceLocks[piece].Lock()
+	defer t.pieceLocks[piece].Unlock()
+	// The piece may have been written or completed again since it was chosen.
+	t.e.mu.Lock()
+	_, evicted := t.evicted[piece]
+	t.e.mu.Unlock()
+	if !evicted {
+		return nil
+	}
+	p := t.inner.PieceWithHash(t.info.Piece(piece), g.None[[]byte]())
+	if evicter, ok := p.PieceImpl.(PieceEvicter); ok {
+		return evicter.Evict()
+	}
+	return p.MarkNotComplete()
+}
+
+var errPieceEvicted = errors.New("piece evicted")
+
+type evictingPieceImpl struct {
+	t     *evictingTorrent
+	key   evictingKey
+	inner Piece
+}
+
+func (p *evictingPieceImpl) e() *Evicting {
+	return p.t.e
+}
+
+// Marks the start of a read, returning false if the piece was evicted.
+func (p *evictingPieceImpl) beginRead() bool {
+	e := p.e()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := p.t.evicted[p.key.piece]; ok {
+		return false
+	}
+	if cp, ok := e.complete[p.key]; ok {
+		e.lru.MoveToFront(cp.elem)
+		cp.readers++
+	}
+	return true
+}
+
+func (p *evictingPieceImpl) endRead() {
+	e := p.e()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if cp, ok := e.complete[p.key]; ok && cp.readers > 0 {
+		cp.readers--
+	}
+}
+
+func (p *evictingPieceImpl) ReadAt(b []byte, off int64) (int, error) {
+	if !p.beginRead() {
+		return 0, errPieceEvicted
+	}
+	defer p.endRead()
+	return p.inner.ReadAt(b, off)
+}
+
+func (p *evictingPieceImpl) WriteTo(w io.Writer) (int64, error) {
+	if !p.beginRead() {
+		return 0, errPieceEvicted
+	}
+	defer p.endRead()
+	return p.inner.WriteTo(w)
+}
+
+func (p *evictingPieceImpl) WriteAt(b []byte, off int64) (int, error) {
+	pieceLock := &p.t.pieceLocks[p.key.piece]
+	pieceLock.RLock()
+	defer pieceLock.RUnlock()
+	e := p.e()
+	e.mu.Lock()
+	delete(p.t.evicted, p.key.piece)
+	e.mu.Unlock()
+	return p.inner.WriteAt(b, off)
+}
+
+func (p *evictingPieceImpl) MarkComplete() error {
+	err := p.inner.MarkComplete()
+	if err != nil {
+		return err
+	}
+	e := p.e()
+	e.mu.Lock()
+	e.addComplete(p.key, p.inner.mip.Length())
+	e.mu.Unlock()
+	e.evict()
+	return nil
+}
+
+func (p *evictingPieceImpl) MarkNotComplete() error {
+	e := p.e()
+	e.mu.Lock()
+	e.removeComplete(p.key)
+	e.mu.Unlock()
+	return p.inner.MarkNotComplete()
+}
+
+func (p *evictingPieceImpl) Completion() Completion {
+	return p.inner.Completion()
+}
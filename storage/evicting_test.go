@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestEvicting(t *testing.T) {
+	const pieceLen = 1 << 14
+	ev := NewEvicting(NewFileOpts(NewFileClientOpts{
+		ClientBaseDir:   t.TempDir(),
+		PieceCompletion: NewMapPieceCompletion(),
+	}), NewEvictingOpts{Capacity: 2 * pieceLen})
+	defer ev.Close()
+	info := &metainfo.Info{
+		Name:        "a",
+		Length:      5 * pieceLen,
+		PieceLength: pieceLen,
+		Pieces:      make([]byte, 5*metainfo.HashSize),
+	}
+	ts, err := NewClient(ev).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	cap, capped := (*ts.Capacity)()
+	qt.Check(t, qt.IsTrue(capped))
+	qt.Check(t, qt.Equals(cap, 2*pieceLen))
+	piece := func(i int) Piece {
+		return ts.Piece(info.Piece(i))
+	}
+	complete := func(i int) {
+		_, err := piece(i).WriteAt(bytes.Repeat([]byte{byte(i)}, pieceLen), 0)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.IsNil(piece(i).MarkComplete()))
+	}
+	readable := func(i int) bool {
+		b := make([]byte, pieceLen)
+		_, err := piece(i).ReadAt(b, 0)
+		return err == nil && bytes.Equal(b, bytes.Repeat([]byte{byte(i)}, pieceLen))
+	}
+	complete(0)
+	complete(1)
+	// Reading piece 0 makes piece 1 the least recently used.
+	qt.Check(t, qt.IsTrue(readable(0)))
+	complete(2)
+	qt.Check(t, qt.Equals(ev.Used(), 2*pieceLen))
+	qt.Check(t, qt.IsFalse(piece(1).Completion().Complete))
+	qt.Check(t, qt.IsFalse(readable(1)))
+	qt.Check(t, qt.IsTrue(readable(0)))
+	qt.Check(t, qt.IsTrue(readable(2)))
+
+	// Pieces in use by readers are kept, even if they're the least recently used.
+	ts.SetReaderPieces([]int{2})
+	complete(3)
+	qt.Check(t, qt.IsTrue(piece(2).Completion().Complete))
+	qt.Check(t, qt.IsFalse(piece(0).Completion().Complete))
+
+	// Evicted pieces can be downloaded again.
+	complete(1)
+	qt.Check(t, qt.IsTrue(readable(1)))
+	qt.Check(t, qt.Equals(ev.Used(), 2*pieceLen))
+}
+
+func TestEvictingPassesReaderPieces(t *testing.T) {
+	inner := &recordingTier{ClientImpl: NewMMap(t.TempDir()), fileWanted: make(map[int]bool)}
+	ev := NewEvicting(inner, NewEvictingOpts{Capacity: 1})
+	info := &metainfo.Info{
+		Name:        "a",
+		Length:      2,
+		PieceLength: 1,
+		Pieces:      make([]byte, 2*metainfo.HashSize),
+	}
+	ts, err := NewClient(ev).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	defer ts.Close()
+	ts.SetReaderPieces([]int{1})
+	qt.Check(t, qt.DeepEquals(inner.readerPieces, []int{1}))
+}
+
+// A piece that's written again after it's chosen for eviction isn't evicted.
+func TestEvictingRewriteBeforeEvict(t *testing.T) {
+	ev := NewEvicting(NewFileOpts(NewFileClientOpts{
+		ClientBaseDir:   t.TempDir(),
+		PieceCompletion: NewMapPieceCompletion(),
+	}), NewEvictingOpts{Capacity: 2})
+	info := &metainfo.Info{
+		Name:        "a",
+		Length:      2,
+		PieceLength: 1,
+		Pieces:      make([]byte, 2*metainfo.HashSize),
+	}
+	ts, err := NewClient(ev).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	defer ts.Close()
+	p := ts.Piece(info.Piece(0))
+	qt.Assert(t, qt.IsNil(p.MarkComplete()))
+	var et *evictingTorrent
+	ev.mu.Lock()
+	for k := range ev.complete {
+		et = k.t
+	}
+	// As evict does once it has chosen the piece.
+	ev.removeComplete(evictingKey{et, 0})
+	et.evicted[0] = struct{}{}
+	ev.mu.Unlock()
+	_, err = p.WriteAt([]byte{1}, 0)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(et.evictInner(0)))
+	b := make([]byte, 1)
+	_, err = p.ReadAt(b, 0)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(b, []byte{1}))
+}
@@ -30,8 +30,20 @@ type NewFileClientOpts struct {
 	// If part files are enabled, this will default to inferring completion from file names at
 	// startup, and keep the rest in memory.
 	PieceCompletion PieceCompletion
-	UsePartFiles    g.Option[bool]
-	Logger          *slog.Logger
+	// Incomplete files have a ".part" suffix. This also keeps the bytes of unwanted files that share
+	// pieces with wanted files in a hidden parts file in the torrent directory. Defaults to true.
+	UsePartFiles g.Option[bool]
+	Logger       *slog.Logger
+	// How disk space is allocated for files. The default is sparse.
+	Preallocation FilePreallocation
+	// Use absolute paths returned by FilePathMaker as-is where this returns true, instead of
+	// requiring files to be within the torrent's directory. Other paths, such as those derived from
+	// the untrusted info, are still confined to it. See LocatedFiles.IsLocatedPath.
+	AllowAbsoluteFilePath func(filePath string) bool
+	// Only record pieces as complete once their data is synced to disk, so that pieces aren't
+	// complete without their data after a crash. Syncs are shared by pieces completed together.
+	// Pieces whose completion was interrupted by a crash are verified when the torrent is opened.
+	DurableCompletion bool
 }
 
 // The specific part-files option or the default.
@@ -47,8 +59,8 @@ func NewFileOpts(opts NewFileClientOpts) ClientImplCloser {
 	if opts.FilePathMaker == nil {
 		opts.FilePathMaker = func(opts FilePathMakerOpts) string {
 			var parts []string
-			if opts.Info.BestName() != metainfo.NoName {
-				parts = append(parts, opts.Info.BestName())
+			if opts.BestName() != metainfo.NoName {
+				parts = append(parts, opts.BestName())
 			}
 			return filepath.Join(append(parts, opts.File.BestPath()...)...)
 		}
@@ -83,16 +95,17 @@ func (fs *fileClientImpl) OpenTorrent(
 	logger := log.ContextLogger(ctx).Slogger()
 	logger.DebugContext(ctx, "opened file torrent storage", slog.String("dir", dir))
 	metainfoFileInfos := info.UpvertedFiles()
+	renames, err := loadFileRenames(fileRenamesPath(fs.opts.ClientBaseDir, infoHash))
+	if err != nil {
+		err = fmt.Errorf("loading file renames: %w", err)
+		return
+	}
+	filePaths, err := fs.filePaths(dir, info, metainfoFileInfos, renames)
+	if err != nil {
+		return
+	}
 	files := make([]fileExtra, len(metainfoFileInfos))
-	for i, fileInfo := range metainfoFileInfos {
-		filePath := filepath.Join(dir, fs.opts.FilePathMaker(FilePathMakerOpts{
-			Info: info,
-			File: &fileInfo,
-		}))
-		if !isSubFilepath(dir, filePath) {
-			err = fmt.Errorf("file %v: path %q is not sub path of %q", i, filePath, dir)
-			return
-		}
+	for i, filePath := range filePaths {
 		files[i].safeOsPath = filePath
 		if metainfoFileInfos[i].Length == 0 {
 			err = CreateNativeZeroLengthFile(filePath)
@@ -103,24 +116,86 @@ func (fs *fileClientImpl) OpenTorrent(
 		}
 	}
 	t := &fileTorrentImpl{
-		info,
-		files,
-		metainfoFileInfos,
-		info.FileSegmentsIndex(),
-		infoHash,
-		defaultFileIo(),
-		fs,
+		info:              info,
+		baseDir:           fs.opts.ClientBaseDir,
+		dir:               dir,
+		renames:           renames,
+		files:             files,
+		metainfoFileInfos: metainfoFileInfos,
+		segmentLocater:    info.FileSegmentsIndex(),
+		infoHash:          infoHash,
+		io:                defaultFileIo(),
+		client:            fs,
 	}
+	t.completionSyncer.fts = t
 	if t.partFiles() {
+		t.partsPath = partsFilePath(dir, infoHash)
+		t.partsSlots = partsSlots(info, metainfoFileInfos)
 		err = t.setCompletionFromPartFiles()
 		if err != nil {
 			err = fmt.Errorf("setting completion from part files: %w", err)
 			return
 		}
 	}
+	if fs.opts.DurableCompletion {
+		err = t.verifyJournaledPieces()
+		if err != nil {
+			err = fmt.Errorf("verifying journaled pieces: %w", err)
+			return
+		}
+	}
+	if fs.opts.Preallocation == FilePreallocationFull {
+		for i := range t.files {
+			err = t.preallocate(t.file(i))
+			if err != nil {
+				err = fmt.Errorf("preallocating %q: %w", t.files[i].safeOsPath, err)
+				return
+			}
+		}
+	}
 	return TorrentImpl{
-		Piece: t.Piece,
-		Close: t.Close,
-		Flush: t.Flush,
+		Piece:         t.Piece,
+		Close:         t.Close,
+		Flush:         t.Flush,
+		Mover:         t,
+		Renamer:       t,
+		SetFileWanted: t.setFileWanted,
 	}, nil
 }
+
+// Returns the safe OS path for each file, for a torrent stored in dir. Renames are applied to the
+// name and files passed to the FilePathMaker.
+func (fs *fileClientImpl) filePaths(
+	dir string,
+	info *metainfo.Info,
+	fileInfos []metainfo.FileInfo,
+	renames fileRenames,
+) (ret []string, err error) {
+	ret = make([]string, len(fileInfos))
+	for i := range fileInfos {
+		fi := fileInfos[i]
+		if path, ok := renames.filePath(i); ok {
+			fi.Path = path
+			fi.PathUtf8 = nil
+		}
+		filePath := fs.opts.FilePathMaker(FilePathMakerOpts{
+			Info:      info,
+			File:      &fi,
+			FileIndex: i,
+			Name:      renames.Name,
+		})
+		if fs.opts.AllowAbsoluteFilePath != nil &&
+			filepath.IsAbs(filePath) &&
+			fs.opts.AllowAbsoluteFilePath(filepath.Clean(filePath)) {
+			ret[i] = filepath.Clean(filePath)
+			continue
+		}
+		filePath = filepath.Join(dir, filePath)
+		if !isSubFilepath(dir, filePath) {
+			err = fmt.Errorf("file %v: path %q is not sub path of %q", i, filePath, dir)
+			return
+		}
+		ret[i] = filePath
+	}
+	return
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/segments"
+)
+
+// With NewFileClientOpts.DurableCompletion, pieces are only recorded as complete after their data
+// is synced, so a crash can't leave a piece marked complete without its data on disk. Pieces
+// completed at the same time share syncs: while one batch of files is synced, the next batch
+// collects. Each batch's pieces are noted in a journal in the torrent directory until their
+// completion is recorded, and pieces left in the journal by a crash are verified when the torrent
+// is next opened, rather than downloaded again.
+
+func completionJournalPath(dir string, infoHash metainfo.Hash) string {
+	return filepath.Join(dir, "."+infoHash.HexString()+".completing")
+}
+
+type fileCompletionSyncer struct {
+	fts *fileTorrentImpl
+
+	mu sync.Mutex
+	// The batch that pieces being completed join. It's synced when the one before it is done.
+	next    *fileSyncBatch
+	syncing bool
+	// Pieces in batches that aren't done. The journal is cleared when there are none.
+	pending     int
+	journalPath string
+}
+
+type fileSyncBatch struct {
+	// The extent to flush for each file index. Names are resolved when the batch is synced, since
+	// files may be promoted meanwhile.
+	extents map[int]segments.Extent
+	pieces  []int
+	done    chan struct{}
+	err     error
+}
+
+// Syncs the piece's data along with any other pieces being completed, and then records it as
+// complete. Must hold ioMu for reading, so that file names don't change meanwhile.
+func (s *fileCompletionSyncer) complete(p *filePieceImpl) error {
+	s.mu.Lock()
+	if s.next == nil {
+		s.next = &fileSyncBatch{
+			extents: make(map[int]segments.Extent),
+			done:    make(chan struct{}),
+		}
+	}
+	b := s.next
+	for fileIndex, extent := range p.fileExtents() {
+		if cur, ok := b.extents[fileIndex]; ok {
+			start := min(cur.Start, extent.Start)
+			extent = segments.Extent{Start: start, Length: max(cur.End(), extent.End()) - start}
+		}
+		b.extents[fileIndex] = extent
+	}
+	b.pieces = append(b.pieces, p.p.Index())
+	s.pending++
+	s.journalPath = completionJournalPath(s.fts.dir, s.fts.infoHash)
+	if !s.syncing {
+		s.syncing = true
+		go s.run()
+	}
+	s.mu.Unlock()
+	<-b.done
+	return b.err
+}
+
+func (s *fileCompletionSyncer) run() {
+	for {
+		s.mu.Lock()
+		b := s.next
+		s.next = nil
+		if b == nil {
+			s.syncing = false
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+		b.err = s.commit(b)
+		s.mu.Lock()
+		s.pending -= len(b.pieces)
+		if s.pending == 0 {
+			err := os.Remove(s.journalPath)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				s.fts.logger().Warn("error removing completion journal", "err", err)
+			}
+		}
+		s.mu.Unlock()
+		close(b.done)
+	}
+}
+
+func (s *fileCompletionSyncer) commit(b *fileSyncBatch) error {
+	err := s.journal(b.pieces)
+	if err != nil {
+		return fmt.Errorf("writing completion journal: %w", err)
+	}
+	for fileIndex, extent := range b.extents {
+		f := s.fts.file(fileIndex)
+		err = s.fts.flushFileExtent(f, extent)
+		if err != nil {
+			return fmt.Errorf("flushing %q: %w", f.safeOsPath, err)
+		}
+	}
+	for _, piece := range b.pieces {
+		err = s.fts.setPieceCompletion(piece, true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Notes pieces whose completion is about to be recorded.
+func (s *fileCompletionSyncer) journal(pieces []int) error {
+	f, err := os.OpenFile(s.journalPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, filePerm)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, piece := range pieces {
+		fmt.Fprintln(&buf, piece)
+	}
+	_, err = f.Write(buf.Bytes())
+	return errors.Join(err, f.Close())
+}
+
+// Verifies pieces left in the completion journal by a crash. Pieces with good data are synced and
+// recorded as complete, and the rest are recorded as not complete.
+func (fts *fileTorrentImpl) verifyJournaledPieces() error {
+	journalPath := completionJournalPath(fts.dir, fts.infoHash)
+	pieces, err := readCompletionJournal(journalPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading completion journal: %w", err)
+	}
+	for piece := range pieces {
+		if piece < 0 || piece >= fts.info.NumPieces() {
+			continue
+		}
+		good, err := fts.verifyPiece(piece)
+		if err != nil {
+			return fmt.Errorf("verifying piece %v: %w", piece, err)
+		}
+		fts.logger().Info("verified piece left in completion journal", "piece", piece, "good", good)
+		if good {
+			p := fts.Piece(fts.info.Piece(piece)).(*filePieceImpl)
+			err = p.flush()
+			if err != nil {
+				return err
+			}
+		}
+		err = fts.setPieceCompletion(piece, good)
+		if err != nil {
+			return err
+		}
+	}
+	return os.Remove(journalPath)
+}
+
+func readCompletionJournal(name string) (map[int]struct{}, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ret := make(map[int]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		piece, err := strconv.Atoi(scanner.Text())
+		if err != nil {
+			// A crash can leave a partial last line.
+			continue
+		}
+		ret[piece] = struct{}{}
+	}
+	return ret, scanner.Err()
+}
+
+// Checks the piece's data against its v1 hash. Pieces without one can't be verified here.
+func (fts *fileTorrentImpl) verifyPiece(index int) (bool, error) {
+	p := fts.info.Piece(index)
+	hash := p.V1Hash()
+	if !hash.Ok {
+		return false, nil
+	}
+	h := sha1.New()
+	_, err := io.Copy(h, io.NewSectionReader(fileTorrentImplIO{fts}, p.Offset(), p.Length()))
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return metainfo.Hash(h.Sum(nil)) == hash.Value, nil
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha1"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	g "github.com/anacrolix/generics"
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func durableCompletionTestInfo(data []byte, pieceLength int64) *metainfo.Info {
+	info := &metainfo.Info{
+		Name:        "t",
+		PieceLength: pieceLength,
+		Length:      int64(len(data)),
+	}
+	for off := int64(0); off < int64(len(data)); off += pieceLength {
+		h := sha1.Sum(data[off:min(off+pieceLength, int64(len(data)))])
+		info.Pieces = append(info.Pieces, h[:]...)
+	}
+	return info
+}
+
+func TestDurableCompletion(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("abcdefghijklmnopqrstuvwxyz")
+	info := durableCompletionTestInfo(data, 4)
+	pc := NewMapPieceCompletion()
+	ts, err := NewClient(NewFileOpts(NewFileClientOpts{
+		ClientBaseDir:     dir,
+		PieceCompletion:   pc,
+		UsePartFiles:      g.Some(false),
+		DurableCompletion: true,
+	})).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	defer ts.Close()
+	var wg sync.WaitGroup
+	for i := range info.NumPieces() {
+		p := ts.Piece(info.Piece(i))
+		_, err = p.WriteAt(data[i*4:min(i*4+4, len(data))], 0)
+		qt.Assert(t, qt.IsNil(err))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			qt.Check(t, qt.IsNil(p.MarkComplete()))
+		}()
+	}
+	wg.Wait()
+	for i := range info.NumPieces() {
+		qt.Check(t, qt.IsTrue(ts.Piece(info.Piece(i)).Completion().Complete))
+	}
+	// The journal is removed once completions are recorded.
+	_, err = os.Stat(completionJournalPath(dir, metainfo.Hash{}))
+	qt.Check(t, qt.ErrorIs(err, os.ErrNotExist))
+}
+
+// Pieces left in the journal are verified when the torrent is opened.
+func TestDurableCompletionVerifiesJournal(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("abcdefghijklmnop")
+	info := durableCompletionTestInfo(data, 4)
+	corrupt := append([]byte(nil), data...)
+	corrupt[5] = 'X'
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(dir, "t"), corrupt, 0o644)))
+	qt.Assert(t, qt.IsNil(os.WriteFile(completionJournalPath(dir, metainfo.Hash{}), []byte("0\n1\n2"), 0o644)))
+	pc := NewMapPieceCompletion()
+	for i := range 2 {
+		qt.Assert(t, qt.IsNil(pc.Set(metainfo.PieceKey{Index: i}, true)))
+	}
+	ts, err := NewClient(NewFileOpts(NewFileClientOpts{
+		ClientBaseDir:     dir,
+		PieceCompletion:   pc,
+		UsePartFiles:      g.Some(false),
+		DurableCompletion: true,
+	})).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	defer ts.Close()
+	complete := func(i int) bool {
+		return ts.Piece(info.Piece(i)).Completion().Complete
+	}
+	qt.Check(t, qt.IsTrue(complete(0)))
+	qt.Check(t, qt.IsFalse(complete(1)))
+	// Not recorded as complete before the crash, but its data was written.
+	qt.Check(t, qt.IsTrue(complete(2)))
+	qt.Check(t, qt.IsFalse(complete(3)))
+	_, err = os.Stat(completionJournalPath(dir, metainfo.Hash{}))
+	qt.Check(t, qt.ErrorIs(err, os.ErrNotExist))
+}
+
+// With part files, data is synced under whichever name it's at: a part file, a promoted file, or
+// the parts file for unwanted files.
+func TestDurableCompletionPartFiles(t *testing.T) {
+	for _, impl := range []struct {
+		name   string
+		fileIo func() fileIo
+	}{
+		{"classic", func() fileIo { return classicFileIo{} }},
+		{"mmap", func() fileIo { return &mmapFileIo{} }},
+	} {
+		t.Run(impl.name, func(t *testing.T) {
+			oldFileIo := defaultFileIo
+			defaultFileIo = impl.fileIo
+			defer func() { defaultFileIo = oldFileIo }()
+			testDurableCompletionPartFiles(t)
+		})
+	}
+}
+
+func testDurableCompletionPartFiles(t *testing.T) {
+	dir := t.TempDir()
+	info := &metainfo.Info{
+		Name:        "t",
+		PieceLength: 4,
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a"}, Length: 6},
+			{Path: []string{"b"}, Length: 4},
+			{Path: []string{"c"}, Length: 6},
+		},
+		Pieces: make([]byte, 4*metainfo.HashSize),
+	}
+	data := []byte("abcdefghijklmnop")
+	ts, err := NewClient(NewFileOpts(NewFileClientOpts{
+		ClientBaseDir:     dir,
+		PieceCompletion:   NewMapPieceCompletion(),
+		DurableCompletion: true,
+	})).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	defer ts.Close()
+	ts.SetFileWanted(1, false)
+	for i := range 4 {
+		p := ts.Piece(info.Piece(i))
+		_, err = p.WriteAt(data[i*4:i*4+4], 0)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.IsNil(p.MarkComplete()), qt.Commentf("piece %v", i))
+	}
+	_, err = os.Stat(filepath.Join(dir, "t", "a"))
+	qt.Assert(t, qt.IsNil(err))
+	// Completing pieces again, as when data is verified, syncs the promoted files.
+	for i := range 4 {
+		p := ts.Piece(info.Piece(i))
+		qt.Check(t, qt.IsNil(p.MarkComplete()), qt.Commentf("piece %v", i))
+		qt.Check(t, qt.IsTrue(p.Completion().Complete), qt.Commentf("piece %v", i))
+	}
+}
@@ -36,6 +36,10 @@ func (c classicFileReader) writeToN(w io.Writer, n int64) (written int64, err er
 	return c.File.WriteTo(&lw)
 }
 
+func (c classicFileReader) seekHole(offset int64) (int64, error) {
+	return seekHole(c.File, offset)
+}
+
 func (c classicFileReader) seekDataOrEof(offset int64) (ret int64, err error) {
 	ret, err = seekData(c.File, offset)
 	if err == io.EOF {
@@ -33,6 +33,8 @@ func init() {
 		defaultFileIo = func() fileIo {
 			return classicFileIo{}
 		}
+	case "io_uring":
+		defaultFileIo = newUringFileIo
 	default:
 		panic(s)
 	}
@@ -260,6 +262,10 @@ func (me *mmapFileHandle) Read(p []byte) (n int, err error) {
 	return
 }
 
+func (me *mmapFileHandle) seekHole(offset int64) (int64, error) {
+	return seekHole(me.shared.f.f, offset)
+}
+
 func (me *mmapFileHandle) seekDataOrEof(offset int64) (ret int64, err error) {
 	// This should be fine as it's an atomic operation, on a shared file handle, so nobody will be
 	// relying non-atomic operations on the file. TODO: Does this require msync first so we don't
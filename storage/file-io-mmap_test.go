@@ -24,6 +24,7 @@ func TestFileIoImplementationsSeekDataDetection(t *testing.T) {
 	}{
 		{"classic", classicFileIo{}},
 		{"mmap", &mmapFileIo{}},
+		{"io_uring", newUringFileIo()},
 	}
 
 	for _, impl := range implementations {
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package storage
+
+// io_uring is Linux only.
+func newUringFileIo() fileIo {
+	return classicFileIo{}
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+var (
+	sharedUringOnce sync.Once
+	sharedUring     *uring
+)
+
+// Returns file I/O through io_uring, or classic file I/O if io_uring isn't available, such as on
+// older kernels or where it's disabled by seccomp.
+func newUringFileIo() fileIo {
+	sharedUringOnce.Do(func() {
+		r, err := newUring()
+		if err == nil {
+			err = r.nop()
+		}
+		if err != nil {
+			slog.Debug("io_uring unavailable, using classic file io", "err", err)
+			return
+		}
+		sharedUring = r
+	})
+	if sharedUring == nil {
+		return classicFileIo{}
+	}
+	return uringFileIo{sharedUring}
+}
+
+// File I/O through a shared io_uring. Concurrent reads and writes are submitted to the kernel
+// together, and flushes are a write-back of the range linked with a data sync. If the ring fails,
+// I/O falls back to classic file I/O.
+type uringFileIo struct {
+	r *uring
+}
+
+func (me uringFileIo) openForSharedRead(name string) (sharedFileIf, error) {
+	return classicFileIo{}.openForSharedRead(name)
+}
+
+func (me uringFileIo) openForRead(name string) (fileReader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &uringFileReader{classicFileReader: classicFileReader{f}, r: me.r}, nil
+}
+
+func (me uringFileIo) openForWrite(name string, size int64) (fileWriter, error) {
+	f, err := openFileExtra(name, os.O_WRONLY)
+	if err != nil {
+		return nil, err
+	}
+	return uringFileWriter{f, me.r}, nil
+}
+
+func (me uringFileIo) flush(name string, offset, nbytes int64) error {
+	f, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = me.r.syncRange(f, offset, nbytes)
+	if errors.Is(err, errUringFailed) {
+		return f.Sync()
+	}
+	return err
+}
+
+type uringFileWriter struct {
+	f *os.File
+	r *uring
+}
+
+func (me uringFileWriter) WriteAt(b []byte, off int64) (int, error) {
+	n, err := me.r.rw(true, me.f, b, off)
+	if errors.Is(err, errUringFailed) {
+		// The ring may have written some of it, but it's the same data.
+		return me.f.WriteAt(b, off)
+	}
+	return n, err
+}
+
+func (me uringFileWriter) Close() error {
+	return me.f.Close()
+}
+
+// Seeking uses the file, and reads go through the ring from the position found.
+type uringFileReader struct {
+	classicFileReader
+	r   *uring
+	pos int64
+}
+
+func (me *uringFileReader) seekDataOrEof(offset int64) (ret int64, err error) {
+	ret, err = me.classicFileReader.seekDataOrEof(offset)
+	if err == nil {
+		me.pos = ret
+	}
+	return
+}
+
+func (me *uringFileReader) Read(b []byte) (n int, err error) {
+	n, err = me.ReadAt(b, me.pos)
+	me.pos += int64(n)
+	if n != 0 && err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+func (me *uringFileReader) ReadAt(b []byte, off int64) (n int, err error) {
+	n, err = me.r.rw(false, me.File, b, off)
+	if errors.Is(err, errUringFailed) {
+		return me.File.ReadAt(b, off)
+	}
+	if err == nil && n < len(b) {
+		err = io.EOF
+	}
+	return
+}
+
+func (me *uringFileReader) writeToN(w io.Writer, n int64) (written int64, err error) {
+	written, err = io.CopyN(w, me, n)
+	if err == io.EOF {
+		err = nil
+	}
+	return
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+)
+
+// Concurrent writes larger than the ring's registered buffers, then a flush and reads back.
+func TestUringFileIoConcurrentWriteFlushRead(t *testing.T) {
+	fio := newUringFileIo()
+	if _, ok := fio.(uringFileIo); !ok {
+		t.Skip("io_uring unavailable")
+	}
+	name := filepath.Join(t.TempDir(), "data")
+	const chunk = 3<<16 + 17
+	const chunks = 16
+	data := make([]byte, chunk*chunks)
+	rand.Read(data)
+	w, err := fio.openForWrite(name, int64(len(data)))
+	qt.Assert(t, qt.IsNil(err))
+	var wg sync.WaitGroup
+	for i := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := w.WriteAt(data[i*chunk:(i+1)*chunk], int64(i*chunk))
+			qt.Check(t, qt.IsNil(err))
+			qt.Check(t, qt.Equals(n, chunk))
+		}()
+	}
+	wg.Wait()
+	qt.Assert(t, qt.IsNil(w.Close()))
+	qt.Assert(t, qt.IsNil(fio.flush(name, 0, int64(len(data)))))
+	r, err := fio.openForRead(name)
+	qt.Assert(t, qt.IsNil(err))
+	defer r.Close()
+	off, err := r.seekDataOrEof(chunk)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.Equals(off, chunk))
+	var buf bytes.Buffer
+	n, err := r.writeToN(&buf, int64(len(data)))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.Equals(n, int64(len(data)-chunk)))
+	qt.Assert(t, qt.IsTrue(bytes.Equal(buf.Bytes(), data[chunk:])))
+	_, err = r.Read(make([]byte, 1))
+	qt.Assert(t, qt.Equals(err, io.EOF))
+}
+
+func BenchmarkFileIoWrite(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		fio  fileIo
+	}{
+		{"Classic", classicFileIo{}},
+		{"Uring", newUringFileIo()},
+	} {
+		for _, size := range []int{1 << 14, 1 << 20} {
+			b.Run(fmt.Sprintf("%v/%v", bc.name, size), func(b *testing.B) {
+				w, err := bc.fio.openForWrite(filepath.Join(b.TempDir(), "data"), 0)
+				qt.Assert(b, qt.IsNil(err))
+				defer w.Close()
+				// Concurrent writes of pieces or chunks, as the client does.
+				var off atomic.Int64
+				data := make([]byte, size)
+				b.SetBytes(int64(size))
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						_, err := w.WriteAt(data, off.Add(int64(size))-int64(size))
+						if err != nil {
+							b.Error(err)
+						}
+					}
+				})
+			})
+		}
+	}
+}
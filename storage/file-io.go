@@ -12,6 +12,8 @@ type fileWriter interface {
 type fileReader interface {
 	// Seeks to the next data in the file. If there is no more data, seeks to the end of the file.
 	seekDataOrEof(offset int64) (ret int64, err error)
+	// Returns the offset of the next hole at or after offset. The end of the file is a hole.
+	seekHole(offset int64) (ret int64, err error)
 	writeToN(w io.Writer, n int64) (written int64, err error)
 	io.ReadCloser
 }
@@ -0,0 +1,398 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anacrolix/torrent/merkle"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+type LocateFilesOpts struct {
+	// Directories searched recursively for files with the same lengths as the torrent's files.
+	Dirs []string
+	// Also locate files that can't be verified by hashing, such as v1 files smaller than a piece
+	// whose neighbours aren't found. These are matched by length alone. Storage using located files
+	// writes to them in place, so a wrong match corrupts whatever data it was.
+	AllowUnverified bool
+	Logger          *slog.Logger
+}
+
+// Existing files found for a torrent's files, such as the same data added from another torrent.
+type LocatedFiles struct {
+	info *metainfo.Info
+	// Indexed like Info.UpvertedFiles. Empty where nothing was found. Each path is located for at
+	// most one file.
+	Paths []string
+	// Whether each located file was checked against its pieces root, the v1 piece hashes of the
+	// pieces it contains entirely, or the v1 pieces it shares with its located neighbours. Unverified
+	// files are only located with LocateFilesOpts.AllowUnverified, and will be checked by the client
+	// once the torrent is added.
+	Verified []bool
+}
+
+// Searches the directories for files matching the info's files. Candidates must have the right
+// length, and are then hashed to verify them. Unverified candidates are only used if
+// opts.AllowUnverified is set.
+func LocateFiles(ctx context.Context, info *metainfo.Info, opts LocateFilesOpts) (ret LocatedFiles, err error) {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	fileInfos := info.UpvertedFiles()
+	ret = LocatedFiles{
+		info:     info,
+		Paths:    make([]string, len(fileInfos)),
+		Verified: make([]bool, len(fileInfos)),
+	}
+	wantLengths := make(map[int64]struct{})
+	for _, fi := range fileInfos {
+		if fi.Length != 0 {
+			wantLengths[fi.Length] = struct{}{}
+		}
+	}
+	candidates := make(map[int64][]string)
+	for _, dir := range opts.Dirs {
+		err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				opts.Logger.Debug("error walking for files", "path", path, "err", err)
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			if _, ok := wantLengths[fi.Size()]; ok {
+				candidates[fi.Size()] = append(candidates[fi.Size()], path)
+			}
+			return ctx.Err()
+		})
+		if err != nil {
+			return
+		}
+	}
+	// Paths already located for a file, by absolute path, so that the same data isn't shared by
+	// several of the torrent's files.
+	assigned := make(map[string]struct{})
+	locatedKey := func(path string) string {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return filepath.Clean(path)
+		}
+		return abs
+	}
+	isAssigned := func(path string) bool {
+		_, ok := assigned[locatedKey(path)]
+		return ok
+	}
+	assign := func(i int, path string, verified bool) {
+		ret.Paths[i] = path
+		ret.Verified[i] = verified
+		assigned[locatedKey(path)] = struct{}{}
+	}
+	// Candidates that matched as far as they could be checked on their own.
+	unverified := make([][]string, len(fileInfos))
+	for i := range fileInfos {
+		fi := &fileInfos[i]
+		if fi.Length == 0 || strings.Contains(fi.Attr, "p") {
+			continue
+		}
+		for _, path := range candidates[fi.Length] {
+			if isAssigned(path) {
+				continue
+			}
+			var verified, ok bool
+			verified, ok, err = verifyLocatedFile(ctx, info, fi, path)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				opts.Logger.Debug("error verifying located file", "path", path, "err", err)
+				err = nil
+				continue
+			}
+			if !ok {
+				continue
+			}
+			if verified {
+				assign(i, path, true)
+				break
+			}
+			unverified[i] = append(unverified[i], path)
+		}
+	}
+	// Files with no pieces of their own are checked with the pieces they share with neighbours that
+	// were located. Earlier files verified this way can be the neighbours of later ones.
+	for i, paths := range unverified {
+		if ret.Paths[i] != "" {
+			continue
+		}
+		for _, path := range paths {
+			if isAssigned(path) {
+				continue
+			}
+			var verified, ok bool
+			verified, ok, err = verifyLocatedBoundaryPieces(ctx, info, fileInfos, ret.Paths, i, path)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				opts.Logger.Debug("error verifying located file", "path", path, "err", err)
+				err = nil
+				continue
+			}
+			if verified && ok {
+				assign(i, path, true)
+				break
+			}
+		}
+	}
+	if !opts.AllowUnverified {
+		return
+	}
+	for i, paths := range unverified {
+		if ret.Paths[i] != "" {
+			continue
+		}
+		for _, path := range paths {
+			if !isAssigned(path) {
+				assign(i, path, false)
+				break
+			}
+		}
+	}
+	return
+}
+
+// Returns whether the file could be verified, and whether it matched, which is assumed if it
+// couldn't be verified.
+func verifyLocatedFile(
+	ctx context.Context,
+	info *metainfo.Info,
+	fi *metainfo.FileInfo,
+	path string,
+) (verified, ok bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if fi.PiecesRoot.Ok {
+		h := merkle.NewHash()
+		_, err = io.Copy(h, contextReader{ctx, f})
+		if err != nil {
+			return
+		}
+		return true, bytes.Equal(h.Sum(nil), fi.PiecesRoot.Value[:]), nil
+	}
+	if info.HasV2() || !info.HasV1() {
+		return false, true, nil
+	}
+	// Check the v1 pieces that lie entirely within the file.
+	pieceLength := info.PieceLength
+	totalLength := info.TotalLength()
+	fileEnd := fi.TorrentOffset + fi.Length
+	buf := make([]byte, pieceLength)
+	for i := (fi.TorrentOffset + pieceLength - 1) / pieceLength; i*pieceLength < fileEnd; i++ {
+		pieceOffset := i * pieceLength
+		pieceEnd := min(pieceOffset+pieceLength, totalLength)
+		if pieceEnd > fileEnd {
+			break
+		}
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		b := buf[:pieceEnd-pieceOffset]
+		_, err = f.ReadAt(b, pieceOffset-fi.TorrentOffset)
+		if err != nil {
+			return
+		}
+		sum := sha1.Sum(b)
+		if metainfo.Hash(sum) != info.Piece(int(i)).V1Hash().Value {
+			return true, false, nil
+		}
+		verified = true
+	}
+	return verified, true, nil
+}
+
+// Checks the v1 pieces that overlap the file at path against their hashes, reading the rest of each
+// piece from the paths located for the neighbouring files. Pieces that extend into files that
+// weren't located are skipped. Returns whether any piece was checked, and whether all the checked
+// pieces matched.
+func verifyLocatedBoundaryPieces(
+	ctx context.Context,
+	info *metainfo.Info,
+	fileInfos []metainfo.FileInfo,
+	located []string,
+	fileIndex int,
+	path string,
+) (verified, ok bool, err error) {
+	if info.HasV2() || !info.HasV1() {
+		return false, true, nil
+	}
+	pieceLength := info.PieceLength
+	totalLength := info.TotalLength()
+	fi := &fileInfos[fileIndex]
+	fileEnd := fi.TorrentOffset + fi.Length
+	buf := make([]byte, pieceLength)
+pieces:
+	for i := fi.TorrentOffset / pieceLength; i*pieceLength < fileEnd; i++ {
+		pieceOffset := i * pieceLength
+		pieceEnd := min(pieceOffset+pieceLength, totalLength)
+		b := buf[:pieceEnd-pieceOffset]
+		for j := range fileInfos {
+			other := &fileInfos[j]
+			start := max(other.TorrentOffset, pieceOffset)
+			end := min(other.TorrentOffset+other.Length, pieceEnd)
+			if start >= end {
+				continue
+			}
+			dst := b[start-pieceOffset : end-pieceOffset]
+			var otherPath string
+			switch {
+			case j == fileIndex:
+				otherPath = path
+			case strings.Contains(other.Attr, "p"):
+				clear(dst)
+				continue
+			case located[j] != "":
+				otherPath = located[j]
+			default:
+				continue pieces
+			}
+			if err = ctx.Err(); err != nil {
+				return
+			}
+			err = readFileAt(otherPath, dst, start-other.TorrentOffset)
+			if err != nil {
+				return
+			}
+		}
+		if metainfo.Hash(sha1.Sum(b)) != info.Piece(int(i)).V1Hash().Value {
+			return true, false, nil
+		}
+		verified = true
+	}
+	return verified, true, nil
+}
+
+func readFileAt(path string, b []byte, off int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.ReadAt(b, off)
+	return err
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (me contextReader) Read(b []byte) (int, error) {
+	if err := me.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return me.r.Read(b)
+}
+
+// Returns a FilePathMaker that uses the absolute paths of located files, and fallback for the rest.
+// The file storage must be opened with NewFileClientOpts.AllowAbsoluteFilePath set to
+// IsLocatedPath for the located paths to be used in place, and should have part files disabled, or
+// pieces that span into missing neighbouring files are written to part files that hide the located
+// data. The data is shared with wherever it was found: those pieces are written into the located
+// files before they're hash checked. Located files are matched by index, so they stay where they
+// were found when the torrent's files are renamed or its storage is moved.
+func (me LocatedFiles) FilePathMaker(fallback FilePathMaker) FilePathMaker {
+	fileInfos := me.info.UpvertedFiles()
+	return func(opts FilePathMakerOpts) string {
+		i := opts.FileIndex
+		if i >= 0 && i < len(me.Paths) && me.Paths[i] != "" && opts.File.Length == fileInfos[i].Length {
+			if abs, err := filepath.Abs(me.Paths[i]); err == nil {
+				return abs
+			}
+		}
+		return fallback(opts)
+	}
+}
+
+// Whether path is the absolute path of a located file, as returned by FilePathMaker. For
+// NewFileClientOpts.AllowAbsoluteFilePath.
+func (me LocatedFiles) IsLocatedPath(path string) bool {
+	for _, located := range me.Paths {
+		if located == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(located); err == nil && abs == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
+
+type LinkMode int
+
+const (
+	LinkHard LinkMode = iota
+	LinkSymbolic
+)
+
+// Links the located files to where file storage for dir would look for them, using the FilePathMaker
+// the storage will be opened with. Existing links to the located files are left alone. As with
+// FilePathMaker, the storage should have part files disabled, and pieces spanning into missing
+// files will write to the located files through the links.
+func (me LocatedFiles) Link(dir string, fpm FilePathMaker, mode LinkMode) error {
+	fileInfos := me.info.UpvertedFiles()
+	for i, path := range me.Paths {
+		if path == "" {
+			continue
+		}
+		target := filepath.Join(dir, fpm(FilePathMakerOpts{
+			Info:      me.info,
+			File:      &fileInfos[i],
+			FileIndex: i,
+		}))
+		if !isSubFilepath(dir, target) {
+			return fmt.Errorf("file %v: path %q is not sub path of %q", i, target, dir)
+		}
+		if existing, err := os.Stat(target); err == nil {
+			source, err := os.Stat(path)
+			if err == nil && os.SameFile(existing, source) {
+				continue
+			}
+			return fmt.Errorf("file %v: %w", i, fs.ErrExist)
+		}
+		err := os.MkdirAll(filepath.Dir(target), dirPerm)
+		if err != nil {
+			return err
+		}
+		switch mode {
+		case LinkHard:
+			err = os.Link(path, target)
+		case LinkSymbolic:
+			path, err = filepath.Abs(path)
+			if err == nil {
+				err = os.Symlink(path, target)
+			}
+		default:
+			err = fmt.Errorf("unknown link mode %v", mode)
+		}
+		if err != nil {
+			return fmt.Errorf("linking file %v: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha1"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestLocateFiles(t *testing.T) {
+	data := []byte("abcdefghijklmnop")
+	info := &metainfo.Info{
+		Name:        "torrent",
+		PieceLength: 4,
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a"}, Length: 8},
+			{Path: []string{"b"}, Length: 2},
+			{Path: []string{"c"}, Length: 6},
+		},
+	}
+	for off := 0; off < len(data); off += 4 {
+		sum := sha1.Sum(data[off : off+4])
+		info.Pieces = append(info.Pieces, sum[:]...)
+	}
+	elsewhere := t.TempDir()
+	writeFile := func(name string, b []byte) {
+		path := filepath.Join(elsewhere, name)
+		qt.Assert(t, qt.IsNil(os.MkdirAll(filepath.Dir(path), dirPerm)))
+		qt.Assert(t, qt.IsNil(os.WriteFile(path, b, filePerm)))
+	}
+	writeFile("decoy", []byte("abcdefgX"))
+	writeFile("x/renamed-a", data[:8])
+	writeFile("y/b", data[8:10])
+
+	// b is smaller than a piece, and the piece it shares with c can't be checked without c.
+	located, err := LocateFiles(context.Background(), info, LocateFilesOpts{Dirs: []string{elsewhere}})
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(located.Paths, []string{filepath.Join(elsewhere, "x", "renamed-a"), "", ""}))
+	qt.Check(t, qt.DeepEquals(located.Verified, []bool{true, false, false}))
+
+	located, err = LocateFiles(context.Background(), info, LocateFilesOpts{
+		Dirs:            []string{elsewhere},
+		AllowUnverified: true,
+	})
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(located.Paths, []string{
+		filepath.Join(elsewhere, "x", "renamed-a"),
+		filepath.Join(elsewhere, "y", "b"),
+		"",
+	}))
+	qt.Check(t, qt.DeepEquals(located.Verified, []bool{true, false, false}))
+
+	fallback := func(opts FilePathMakerOpts) string {
+		return filepath.Join(append([]string{opts.BestName()}, opts.File.BestPath()...)...)
+	}
+	checkStorage := func(base string, opts NewFileClientOpts) {
+		opts.ClientBaseDir = base
+		opts.UsePartFiles.Set(false)
+		opts.PieceCompletion = NewMapPieceCompletion()
+		ts, err := NewClient(NewFileOpts(opts)).OpenTorrent(context.Background(), info, metainfo.Hash{})
+		qt.Assert(t, qt.IsNil(err))
+		defer ts.Close()
+		b := make([]byte, 4)
+		for i, want := range []string{"abcd", "efgh"} {
+			_, err = ts.Piece(info.Piece(i)).ReadAt(b, 0)
+			qt.Check(t, qt.IsNil(err))
+			qt.Check(t, qt.Equals(string(b), want))
+		}
+		// The boundary piece writes through to the located file.
+		_, err = ts.Piece(info.Piece(2)).WriteAt(data[8:12], 0)
+		qt.Assert(t, qt.IsNil(err))
+		_, err = os.Stat(filepath.Join(base, "torrent", "c"))
+		qt.Check(t, qt.IsNil(err))
+	}
+
+	linked := t.TempDir()
+	qt.Assert(t, qt.IsNil(located.Link(linked, fallback, LinkHard)))
+	// Linking again is a no-op.
+	qt.Assert(t, qt.IsNil(located.Link(linked, fallback, LinkHard)))
+	checkStorage(linked, NewFileClientOpts{FilePathMaker: fallback})
+
+	direct := t.TempDir()
+	checkStorage(direct, NewFileClientOpts{
+		FilePathMaker:         located.FilePathMaker(fallback),
+		AllowAbsoluteFilePath: located.IsLocatedPath,
+	})
+	_, err = os.Stat(filepath.Join(direct, "torrent", "a"))
+	qt.Check(t, qt.ErrorIs(err, os.ErrNotExist))
+}
+
+// Files smaller than a piece are verified with the pieces they share with located neighbours.
+func TestLocateFilesBoundaryPieces(t *testing.T) {
+	data := []byte("abcdefghijklmnop")
+	info := &metainfo.Info{
+		Name:        "torrent",
+		PieceLength: 4,
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a"}, Length: 8},
+			{Path: []string{"b"}, Length: 2},
+			{Path: []string{"c"}, Length: 6},
+		},
+	}
+	for off := 0; off < len(data); off += 4 {
+		sum := sha1.Sum(data[off : off+4])
+		info.Pieces = append(info.Pieces, sum[:]...)
+	}
+	elsewhere := t.TempDir()
+	for name, b := range map[string][]byte{
+		"a":      data[:8],
+		"b-good": data[8:10],
+		"b-bad":  []byte("XX"),
+		"c":      data[10:],
+	} {
+		qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(elsewhere, name), b, filePerm)))
+	}
+	for _, allowUnverified := range []bool{false, true} {
+		located, err := LocateFiles(context.Background(), info, LocateFilesOpts{
+			Dirs:            []string{elsewhere},
+			AllowUnverified: allowUnverified,
+		})
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.DeepEquals(located.Paths, []string{
+			filepath.Join(elsewhere, "a"),
+			filepath.Join(elsewhere, "b-good"),
+			filepath.Join(elsewhere, "c"),
+		}))
+		qt.Check(t, qt.DeepEquals(located.Verified, []bool{true, true, true}))
+	}
+}
+
+// A path is only located for one of the torrent's files, even if it matches several.
+func TestLocateFilesAssignsPathOnce(t *testing.T) {
+	info := &metainfo.Info{
+		Name:        "torrent",
+		PieceLength: 4,
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a"}, Length: 4},
+			{Path: []string{"b"}, Length: 4},
+		},
+	}
+	for range 2 {
+		sum := sha1.Sum([]byte("abcd"))
+		info.Pieces = append(info.Pieces, sum[:]...)
+	}
+	elsewhere := t.TempDir()
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(elsewhere, "found"), []byte("abcd"), filePerm)))
+	// Overlapping directories find the same file twice.
+	located, err := LocateFiles(context.Background(), info, LocateFilesOpts{
+		Dirs:            []string{elsewhere, elsewhere},
+		AllowUnverified: true,
+	})
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(located.Paths, []string{filepath.Join(elsewhere, "found"), ""}))
+}
+
+func TestLocatedFilePathMakerConfinesFallback(t *testing.T) {
+	elsewhere := t.TempDir()
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(elsewhere, "a"), []byte("abcd"), filePerm)))
+	outside := t.TempDir()
+	for _, name := range []string{filepath.Join(outside, "abs"), "../escape"} {
+		info := &metainfo.Info{
+			Name:        name,
+			PieceLength: 4,
+			Files: []metainfo.FileInfo{
+				{Path: []string{"a"}, Length: 4},
+				{Path: []string{"b"}, Length: 4},
+			},
+		}
+		for _, piece := range []string{"abcd", "efgh"} {
+			sum := sha1.Sum([]byte(piece))
+			info.Pieces = append(info.Pieces, sum[:]...)
+		}
+		located, err := LocateFiles(context.Background(), info, LocateFilesOpts{Dirs: []string{elsewhere}})
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.IsTrue(located.IsLocatedPath(filepath.Join(elsewhere, "a"))))
+		base := t.TempDir()
+		opts := NewFileClientOpts{
+			ClientBaseDir: base,
+			FilePathMaker: located.FilePathMaker(func(opts FilePathMakerOpts) string {
+				return filepath.Join(append([]string{opts.BestName()}, opts.File.BestPath()...)...)
+			}),
+			AllowAbsoluteFilePath: located.IsLocatedPath,
+			PieceCompletion:       NewMapPieceCompletion(),
+		}
+		opts.UsePartFiles.Set(false)
+		ts, err := NewClient(NewFileOpts(opts)).OpenTorrent(context.Background(), info, metainfo.Hash{})
+		if name == "../escape" {
+			// The fallback path escapes the torrent directory.
+			qt.Check(t, qt.ErrorMatches(err, `.*is not sub path of.*`))
+			continue
+		}
+		qt.Assert(t, qt.IsNil(err))
+		// The absolute fallback path is treated as relative to the torrent directory.
+		_, err = ts.Piece(info.Piece(1)).WriteAt([]byte("efgh"), 0)
+		qt.Check(t, qt.IsNil(err))
+		qt.Check(t, qt.IsNil(ts.Close()))
+		_, err = os.Stat(filepath.Join(outside, "abs", "b"))
+		qt.Check(t, qt.ErrorIs(err, os.ErrNotExist))
+		_, err = os.Stat(filepath.Join(base, outside, "abs", "b"))
+		qt.Check(t, qt.IsNil(err))
+	}
+}
+
+// Located files stay where they were found when the torrent's files are renamed, or its storage is
+// moved.
+func TestLocatedFilesRenameAndMove(t *testing.T) {
+	elsewhere := t.TempDir()
+	locatedPath := filepath.Join(elsewhere, "found")
+	qt.Assert(t, qt.IsNil(os.WriteFile(locatedPath, []byte("abcd"), filePerm)))
+	info := &metainfo.Info{
+		Name:        "torrent",
+		PieceLength: 4,
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a"}, Length: 4},
+			{Path: []string{"b"}, Length: 4},
+		},
+	}
+	for _, piece := range []string{"abcd", "efgh"} {
+		sum := sha1.Sum([]byte(piece))
+		info.Pieces = append(info.Pieces, sum[:]...)
+	}
+	located, err := LocateFiles(context.Background(), info, LocateFilesOpts{Dirs: []string{elsewhere}})
+	qt.Assert(t, qt.IsNil(err))
+	base := t.TempDir()
+	opts := NewFileClientOpts{
+		ClientBaseDir: base,
+		FilePathMaker: located.FilePathMaker(func(opts FilePathMakerOpts) string {
+			return filepath.Join(append([]string{opts.BestName()}, opts.File.BestPath()...)...)
+		}),
+		AllowAbsoluteFilePath: located.IsLocatedPath,
+		PieceCompletion:       NewMapPieceCompletion(),
+	}
+	opts.UsePartFiles.Set(false)
+	ts, err := NewClient(NewFileOpts(opts)).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	defer ts.Close()
+	check := func() {
+		b, err := os.ReadFile(locatedPath)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.Equals(string(b), "abcd"))
+		b = make([]byte, 4)
+		_, err = ts.Piece(info.Piece(0)).ReadAt(b, 0)
+		qt.Check(t, qt.IsNil(err))
+		qt.Check(t, qt.Equals(string(b), "abcd"))
+	}
+	qt.Assert(t, qt.IsNil(ts.Renamer.RenameFile(0, []string{"renamed"})))
+	check()
+	qt.Assert(t, qt.IsNil(ts.Mover.MoveStorage(context.Background(), t.TempDir(), nil)))
+	check()
+}
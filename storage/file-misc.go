@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/anacrolix/torrent/segments"
@@ -85,6 +86,10 @@ type fileExtra struct {
 	safeOsPath string
 	// Utility value to help the race detector find issues for us.
 	race byte
+	// Whether space has been allocated for the file. Protected by mu.
+	preallocated bool
+	// Set when the file is not wanted, so space isn't allocated for partial writes to it.
+	unwanted atomic.Bool
 }
 
 func (f *fileExtra) partFilePath() string {
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestFileMissingData(t *testing.T) {
+	const pieceLen = 1 << 16
+	ci := NewFileOpts(NewFileClientOpts{
+		ClientBaseDir:   t.TempDir(),
+		PieceCompletion: NewMapPieceCompletion(),
+	})
+	defer ci.Close()
+	info := &metainfo.Info{
+		Name:        "dir",
+		PieceLength: pieceLen,
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a"}, Length: 3 * pieceLen},
+			{Path: []string{"b"}, Length: pieceLen},
+		},
+		Pieces: make([]byte, 4*metainfo.HashSize),
+	}
+	ts, err := NewClient(ci).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	missing := func(i int) bool {
+		ret, err := ts.Piece(info.Piece(i)).PieceImpl.(MissingDataChecker).MissingData()
+		qt.Assert(t, qt.IsNil(err))
+		return ret
+	}
+	// Nothing exists yet.
+	qt.Check(t, qt.IsTrue(missing(0)))
+	for _, i := range []int{0, 2} {
+		_, err = ts.Piece(info.Piece(i)).WriteAt(bytes.Repeat([]byte{1}, pieceLen), 0)
+		qt.Assert(t, qt.IsNil(err))
+	}
+	qt.Check(t, qt.IsFalse(missing(0)))
+	qt.Check(t, qt.IsFalse(missing(2)))
+	// The file for the last piece hasn't been created.
+	qt.Check(t, qt.IsTrue(missing(3)))
+	// There's a hole between the written pieces, where the filesystem supports it.
+	if !missing(1) {
+		t.Log("filesystem doesn't report holes")
+	}
+}
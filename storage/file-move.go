@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var _ Mover = (*fileTorrentImpl)(nil)
+
+// Moves the torrent's files, including part files, to where they'd be if the client was opened
+// with newBaseDir. Files are renamed where possible, and copied otherwise, such as across devices.
+// Piece completion is keyed by infohash and is unaffected. If an error occurs, files that were
+// already moved are used from their new location. Empty directories left behind inside the old
+// torrent directory are removed.
+func (fts *fileTorrentImpl) MoveStorage(
+	ctx context.Context,
+	newBaseDir string,
+	progress func(MoveProgress),
+) (err error) {
+	fts.ioMu.Lock()
+	defer fts.ioMu.Unlock()
+	newDir := fts.client.opts.TorrentDirMaker(newBaseDir, fts.info, fts.infoHash)
+	newPaths, err := fts.client.filePaths(newDir, fts.info, fts.metainfoFileInfos, fts.renames)
+	if err != nil {
+		return
+	}
+	var mp MoveProgress
+	mp.FilesTotal = len(fts.files)
+	for i := range fts.files {
+		mp.BytesTotal += fts.metainfoFileInfos[i].Length
+	}
+	report := func() {
+		if progress != nil {
+			progress(mp)
+		}
+	}
+	report()
+	oldDir := fts.dir
+	var doneBytes int64
+	for i := range fts.files {
+		f := fts.file(i)
+		oldPath := f.safeOsPath
+		err = fts.moveFile(ctx, f, newPaths[i], func(n int64) {
+			mp.BytesDone += n
+			report()
+		})
+		if err != nil {
+			return fmt.Errorf("moving %q: %w", oldPath, err)
+		}
+		removeEmptyDirs(oldDir, filepath.Dir(oldPath))
+		// Files may be sparse or incomplete, so count what the file should contain.
+		doneBytes += f.length()
+		mp.BytesDone = doneBytes
+		mp.FilesDone++
+		report()
+	}
+	err = fts.moveParts(newDir)
+	if err != nil {
+		return
+	}
+	fts.dir = newDir
+	return fts.moveRenames(newBaseDir)
+}
+
+// Moves whichever of the complete or part file exists to the new path. Updates the file's path once
+// the data is in the new location.
+func (fts *fileTorrentImpl) moveFile(ctx context.Context, f file, newPath string, written func(int64)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.race++
+	if newPath == f.safeOsPath {
+		return nil
+	}
+	from, to := f.safeOsPath, newPath
+	_, err := os.Lstat(from)
+	if errors.Is(err, fs.ErrNotExist) && fts.partFiles() {
+		from, to = f.partFilePath(), newPath+".part"
+		_, err = os.Lstat(from)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		// Nothing has been written yet.
+		f.safeOsPath = newPath
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = moveFile(ctx, from, to, written)
+	if err != nil {
+		return err
+	}
+	f.safeOsPath = newPath
+	fts.logger().Debug("moved file", "from", from, "to", to)
+	return nil
+}
+
+// Renames from to to, or copies and then removes from if renaming fails, such as across devices.
+// to must not already exist.
+func moveFile(ctx context.Context, from, to string, written func(int64)) (err error) {
+	fi, err := os.Stat(from)
+	if err != nil {
+		return
+	}
+	err = os.MkdirAll(filepath.Dir(to), dirPerm)
+	if err != nil {
+		return
+	}
+	_, err = os.Lstat(to)
+	if err == nil {
+		return fmt.Errorf("%q already exists", to)
+	}
+	err = os.Rename(from, to)
+	if err == nil {
+		written(fi.Size())
+		return
+	}
+	err = copyFile(ctx, from, to, fi.Mode().Perm(), written)
+	if err != nil {
+		os.Remove(to)
+		return
+	}
+	return os.Remove(from)
+}
+
+func copyFile(ctx context.Context, from, to string, perm fs.FileMode, written func(int64)) (err error) {
+	src, err := os.Open(from)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	// Add write permission so we can copy into it, and restore the source's afterwards.
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm|0o200)
+	if err != nil {
+		return
+	}
+	defer dst.Close()
+	buf := make([]byte, 1<<20)
+	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		var n int64
+		n, err = io.CopyBuffer(dst, io.LimitReader(src, int64(len(buf))), buf)
+		written(n)
+		if err != nil {
+			return
+		}
+		if n == 0 {
+			break
+		}
+	}
+	err = dst.Sync()
+	if err != nil {
+		return
+	}
+	err = dst.Close()
+	if err != nil {
+		return
+	}
+	return os.Chmod(to, perm)
+}
+
+// Removes dir and its parents while they're empty, stopping before root.
+func removeEmptyDirs(root, dir string) {
+	for dir != root && isSubFilepath(root, dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
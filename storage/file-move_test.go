@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestFileMoveStorage(t *testing.T) {
+	oldBase := t.TempDir()
+	newBase := filepath.Join(t.TempDir(), "archive")
+	ci := NewFileOpts(NewFileClientOpts{
+		ClientBaseDir:   oldBase,
+		PieceCompletion: NewMapPieceCompletion(),
+	})
+	defer ci.Close()
+	info := &metainfo.Info{
+		Name:        "dir",
+		PieceLength: 4,
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a"}, Length: 4},
+			{Path: []string{"sub", "b"}, Length: 4},
+			{Path: []string{"empty"}, Length: 0},
+		},
+		Pieces: make([]byte, 2*metainfo.HashSize),
+	}
+	ts, err := NewClient(ci).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	// The first file is complete, and the second is a part file.
+	p0 := ts.Piece(info.Piece(0))
+	_, err = p0.WriteAt([]byte("abcd"), 0)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(p0.MarkComplete()))
+	p1 := ts.Piece(info.Piece(1))
+	_, err = p1.WriteAt([]byte("ef"), 0)
+	qt.Assert(t, qt.IsNil(err))
+
+	var progress []MoveProgress
+	err = ts.Mover.MoveStorage(context.Background(), newBase, func(mp MoveProgress) {
+		progress = append(progress, mp)
+	})
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(progress[len(progress)-1], MoveProgress{
+		BytesDone:  8,
+		BytesTotal: 8,
+		FilesDone:  3,
+		FilesTotal: 3,
+	}))
+
+	_, err = os.Stat(filepath.Join(oldBase, "dir"))
+	qt.Check(t, qt.ErrorIs(err, os.ErrNotExist))
+	for _, name := range []string{"a", "sub/b.part", "empty"} {
+		_, err = os.Stat(filepath.Join(newBase, "dir", name))
+		qt.Check(t, qt.IsNil(err), qt.Commentf("%v", name))
+	}
+	qt.Check(t, qt.Equals(p0.Completion(), Completion{Complete: true, Ok: true}))
+	qt.Check(t, qt.IsFalse(p1.Completion().Complete))
+
+	// Writes and reads continue in the new location.
+	_, err = p1.WriteAt([]byte("gh"), 2)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(p1.MarkComplete()))
+	b, err := os.ReadFile(filepath.Join(newBase, "dir", "sub", "b"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b), "efgh"))
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, io.NewSectionReader(p0, 0, 4))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(buf.String(), "abcd"))
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "from")
+	to := filepath.Join(dir, "to")
+	qt.Assert(t, qt.IsNil(os.WriteFile(from, []byte("hello"), 0o444)))
+	var written int64
+	err := copyFile(context.Background(), from, to, 0o444, func(n int64) { written += n })
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(written, int64(5)))
+	b, err := os.ReadFile(to)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b), "hello"))
+	fi, err := os.Stat(to)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(fi.Mode().Perm(), os.FileMode(0o444)))
+}
@@ -0,0 +1,360 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/segments"
+)
+
+// With part files, the bytes of unwanted files that share a piece with another file are kept in a
+// hidden per-torrent parts file instead of creating files the user didn't select. The parts file
+// has a slot the length of a piece for each piece that contains the unaligned start of a file. Data
+// for a file is in the parts file while the file doesn't exist under either of its names. When an
+// unwanted file becomes wanted, its data is moved into the file straight away, and the file is
+// promoted if its pieces are already complete.
+
+func partsFilePath(dir string, infoHash metainfo.Hash) string {
+	return filepath.Join(dir, "."+infoHash.HexString()+".parts")
+}
+
+// Returns the slot for each piece that is shared by the end of one file and the start of another.
+func partsSlots(info *metainfo.Info, fileInfos []metainfo.FileInfo) map[int]int {
+	ret := make(map[int]int)
+	for _, fi := range fileInfos {
+		if fi.Length == 0 || fi.TorrentOffset%info.PieceLength == 0 {
+			continue
+		}
+		piece := int(fi.TorrentOffset / info.PieceLength)
+		if _, ok := ret[piece]; !ok {
+			ret[piece] = len(ret)
+		}
+	}
+	return ret
+}
+
+// Returns where an offset in the file is stored in the parts file, and how many bytes of the file
+// follow it in the same slot.
+func (fts *fileTorrentImpl) partsOffset(f file, off int64) (partsOff, n int64, ok bool) {
+	if fts.partsPath == "" || off < 0 || off >= f.length() {
+		return
+	}
+	pieceLength := fts.info.PieceLength
+	torrentOff := f.torrentOffset() + off
+	piece := int(torrentOff / pieceLength)
+	slot, ok := fts.partsSlots[piece]
+	if !ok {
+		return
+	}
+	pieceStart := int64(piece) * pieceLength
+	end := min(pieceStart+pieceLength, f.torrentOffset()+f.length())
+	return int64(slot)*pieceLength + torrentOff - pieceStart, end - torrentOff, true
+}
+
+// Whether the file has any data that could be in the parts file.
+func (fts *fileTorrentImpl) fileHasParts(f file) bool {
+	if f.length() == 0 {
+		return false
+	}
+	_, _, head := fts.partsOffset(f, 0)
+	_, _, tail := fts.partsOffset(f, f.length()-1)
+	return head || tail
+}
+
+// Whether all of the extent of the file can be stored in the parts file.
+func (fts *fileTorrentImpl) partsCovers(f file, e segments.Extent) bool {
+	for off := e.Start; off < e.End(); {
+		_, n, ok := fts.partsOffset(f, off)
+		if !ok {
+			return false
+		}
+		off += n
+	}
+	return true
+}
+
+// Whether the file exists under either name. Must hold the file's mu.
+func (fts *fileTorrentImpl) fileExists(f file) (bool, error) {
+	names := []string{f.safeOsPath}
+	if fts.partFiles() {
+		names = append(names, f.partFilePath())
+	}
+	for _, name := range names {
+		_, err := os.Stat(name)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// Returns a writer to the parts file if the extent of the file should be written there.
+func (fts *fileTorrentImpl) openPartsForWrite(f file, e segments.Extent) (_ fileWriter, ok bool, err error) {
+	if !f.unwanted.Load() || !fts.fileHasParts(f) || !fts.partsCovers(f, e) {
+		return
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	exists, err := fts.fileExists(f)
+	if err != nil || exists {
+		return
+	}
+	osFile, err := openFileExtra(fts.partsPath, os.O_RDWR)
+	if err != nil {
+		return
+	}
+	return &partsFileView{f: osFile, fts: fts, file: f}, true, nil
+}
+
+// Moves the file's data out of the parts file, if it's there. This is done before the file is
+// written to, so it's only needed once the file is wanted.
+func (fts *fileTorrentImpl) moveFromParts(f file) (err error) {
+	if !fts.fileHasParts(f) {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	exists, err := fts.fileExists(f)
+	if err != nil || exists {
+		return
+	}
+	parts, err := os.Open(fts.partsPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return
+	}
+	defer parts.Close()
+	partsInfo, err := parts.Stat()
+	if err != nil {
+		return
+	}
+	// The file's data can be in the slots for the pieces at its start and end.
+	tailPieceStart := (f.torrentOffset() + f.length() - 1) / fts.info.PieceLength * fts.info.PieceLength
+	var regions []segments.Extent
+	for _, off := range []int64{0, max(0, tailPieceStart-f.torrentOffset())} {
+		partsOff, n, ok := fts.partsOffset(f, off)
+		if !ok || partsOff >= partsInfo.Size() {
+			continue
+		}
+		if len(regions) != 0 && regions[0].Start == off {
+			continue
+		}
+		regions = append(regions, segments.Extent{Start: off, Length: n})
+	}
+	if len(regions) == 0 {
+		return nil
+	}
+	name := fts.pathForWrite(&f)
+	osFile, err := openFileExtra(name, os.O_WRONLY)
+	if err != nil {
+		return
+	}
+	defer osFile.Close()
+	for _, r := range regions {
+		partsOff, _, _ := fts.partsOffset(f, r.Start)
+		_, err = io.Copy(
+			io.NewOffsetWriter(osFile, r.Start),
+			io.NewSectionReader(parts, partsOff, r.Length))
+		if err != nil {
+			return fmt.Errorf("copying from parts file to %q: %w", name, err)
+		}
+	}
+	fts.logger().Debug("moved data from parts file", "file", name)
+	return osFile.Close()
+}
+
+// Moves a file that has become wanted out of the parts file, and promotes it if its pieces are all
+// complete, as MarkComplete would have. This is called with the Client lock held, so if the storage
+// is being moved, it's done once that's finished.
+func (fts *fileTorrentImpl) onFileWanted(f file) {
+	if !fts.fileHasParts(f) {
+		return
+	}
+	if fts.ioMu.TryRLock() {
+		fts.moveWantedFromParts(f)
+		return
+	}
+	go func() {
+		fts.ioMu.RLock()
+		fts.moveWantedFromParts(f)
+	}()
+}
+
+// Must hold ioMu for reading, which is released.
+func (fts *fileTorrentImpl) moveWantedFromParts(f file) {
+	defer fts.ioMu.RUnlock()
+	err := fts.moveFromParts(f)
+	if err == nil {
+		piece := fts.Piece(fts.info.Piece(f.beginPieceIndex())).(*filePieceImpl)
+		res := piece.allFilePiecesComplete(f)
+		err = res.Err
+		if res.Ok {
+			err = piece.promotePartFile(f)
+		}
+	}
+	if err != nil {
+		fts.logger().Warn("error moving wanted file from parts file", "file", f.safeOsPath, "err", err)
+	}
+}
+
+// A file's view of its data in the parts file.
+type partsFileView struct {
+	f    *os.File
+	fts  *fileTorrentImpl
+	file file
+	// The offset for Read.
+	pos int64
+}
+
+var _ interface {
+	fileReader
+	fileWriter
+} = (*partsFileView)(nil)
+
+func (me *partsFileView) ReadAt(b []byte, off int64) (n int, err error) {
+	for len(b) != 0 {
+		partsOff, avail, ok := me.fts.partsOffset(me.file, off)
+		if !ok {
+			return n, io.EOF
+		}
+		var n1 int
+		n1, err = me.f.ReadAt(b[:min(int64(len(b)), avail)], partsOff)
+		n += n1
+		b = b[n1:]
+		off += int64(n1)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (me *partsFileView) WriteAt(b []byte, off int64) (n int, err error) {
+	for len(b) != 0 {
+		partsOff, avail, ok := me.fts.partsOffset(me.file, off)
+		if !ok {
+			return n, fmt.Errorf("offset %v of %q isn't in the parts file", off, me.file.safeOsPath)
+		}
+		var n1 int
+		n1, err = me.f.WriteAt(b[:min(int64(len(b)), avail)], partsOff)
+		n += n1
+		b = b[n1:]
+		off += int64(n1)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (me *partsFileView) Read(b []byte) (n int, err error) {
+	n, err = me.ReadAt(b, me.pos)
+	me.pos += int64(n)
+	if n != 0 && err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+// Returns the bytes present from offset, up to the end of its slot.
+func (me *partsFileView) present(offset int64) (int64, error) {
+	partsOff, n, ok := me.fts.partsOffset(me.file, offset)
+	if !ok {
+		return 0, nil
+	}
+	fi, err := me.f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return max(0, min(n, fi.Size()-partsOff)), nil
+}
+
+// There's no data outside the parts file slots, so that is treated as the end of the file.
+func (me *partsFileView) seekDataOrEof(offset int64) (int64, error) {
+	n, err := me.present(offset)
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	me.pos = offset
+	return offset, nil
+}
+
+func (me *partsFileView) seekHole(offset int64) (int64, error) {
+	n, err := me.present(offset)
+	return offset + n, err
+}
+
+func (me *partsFileView) writeToN(w io.Writer, n int64) (written int64, err error) {
+	written, err = io.CopyN(w, me, n)
+	if err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+func (me *partsFileView) Close() error {
+	return me.f.Close()
+}
+
+// Opens the file's view of the parts file if it has data there. Must hold the file's mu.
+func (fts *fileTorrentImpl) openPartsForRead(f file) (*partsFileView, error) {
+	if !fts.fileHasParts(f) {
+		return nil, fs.ErrNotExist
+	}
+	osFile, err := os.Open(fts.partsPath)
+	if err != nil {
+		return nil, err
+	}
+	return &partsFileView{f: osFile, fts: fts, file: f}, nil
+}
+
+// Whether all of the extent of the file is present in the parts file. Must hold the file's mu.
+func (fts *fileTorrentImpl) partsHasExtent(f file, e segments.Extent) (bool, error) {
+	view, err := fts.openPartsForRead(f)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer view.Close()
+	for off := e.Start; off < e.End(); {
+		n, err := view.present(off)
+		if err != nil || n == 0 {
+			return false, err
+		}
+		off += n
+	}
+	return true, nil
+}
+
+// Moves the parts file with the torrent's files. Must hold ioMu for writing.
+func (fts *fileTorrentImpl) moveParts(newDir string) error {
+	if fts.partsPath == "" {
+		return nil
+	}
+	newPath := partsFilePath(newDir, fts.infoHash)
+	if newPath == fts.partsPath {
+		return nil
+	}
+	err := moveFile(context.Background(), fts.partsPath, newPath, func(int64) {})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("moving parts file: %w", err)
+	}
+	fts.partsPath = newPath
+	return nil
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestFilePartsUnwantedBoundary(t *testing.T) {
+	dir := t.TempDir()
+	info := &metainfo.Info{
+		Name:        "t",
+		PieceLength: 4,
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a"}, Length: 6},
+			{Path: []string{"b"}, Length: 4},
+			{Path: []string{"c"}, Length: 6},
+		},
+		Pieces: make([]byte, 4*metainfo.HashSize),
+	}
+	data := []byte("abcdefghijklmnop")
+	ts, err := NewClient(NewFileOpts(NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: NewMapPieceCompletion(),
+	})).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	defer ts.Close()
+	ts.SetFileWanted(1, false)
+	for i := range 4 {
+		p := ts.Piece(info.Piece(i))
+		_, err = p.WriteAt(data[i*4:i*4+4], 0)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.IsNil(p.MarkComplete()))
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, "t", name))
+		return err == nil
+	}
+	// The unwanted file's bytes only went to the parts file.
+	qt.Check(t, qt.IsFalse(exists("b")))
+	qt.Check(t, qt.IsFalse(exists("b.part")))
+	_, err = os.Stat(partsFilePath(dir, metainfo.Hash{}))
+	qt.Check(t, qt.IsNil(err))
+	qt.Check(t, qt.IsTrue(exists("a")))
+	qt.Check(t, qt.IsTrue(exists("c")))
+	b := make([]byte, 4)
+	for i := range 4 {
+		p := ts.Piece(info.Piece(i))
+		qt.Check(t, qt.IsTrue(p.Completion().Complete), qt.Commentf("piece %v", i))
+		_, err = p.ReadAt(b, 0)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.Equals(string(b), string(data[i*4:i*4+4])))
+	}
+
+	// Once wanted, the data is moved into the file.
+	ts.SetFileWanted(1, true)
+	qt.Assert(t, qt.IsNil(ts.Piece(info.Piece(2)).MarkComplete()))
+	content, err := os.ReadFile(filepath.Join(dir, "t", "b"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(content), "ghij"))
+}
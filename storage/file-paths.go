@@ -18,6 +18,19 @@ type TorrentDirFilePathMaker func(baseDir string, info *metainfo.Info, infoHash
 type FilePathMakerOpts struct {
 	Info *metainfo.Info
 	File *metainfo.FileInfo
+	// The file's index in Info.UpvertedFiles.
+	FileIndex int
+	// Overrides the info name if the torrent's storage was renamed. See BestName.
+	Name string
+}
+
+// The torrent's name, taking into account renames. FilePathMakers should use this rather than
+// Info.BestName.
+func (me FilePathMakerOpts) BestName() string {
+	if me.Name != "" {
+		return me.Name
+	}
+	return me.Info.BestName()
 }
 
 // defaultPathMaker just returns the storage client's base directory.
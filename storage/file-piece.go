@@ -29,15 +29,23 @@ var _ interface {
 	PieceImpl
 	//PieceReaderer
 	io.WriterTo
+	MissingDataChecker
+	PieceEvicter
+	PieceFileSectioner
 } = (*filePieceImpl)(nil)
 
 func (me *filePieceImpl) Flush() (err error) {
+	me.t.ioMu.RLock()
+	defer me.t.ioMu.RUnlock()
+	return me.flush()
+}
+
+func (me *filePieceImpl) flush() (err error) {
 	for fileIndex, extent := range me.fileExtents() {
 		file := me.t.file(fileIndex)
-		name := me.t.pathForWrite(&file)
-		err1 := me.t.io.flush(name, extent.Start, extent.Length)
+		err1 := me.t.flushFileExtent(file, extent)
 		if err1 != nil {
-			err = errors.Join(err, fmt.Errorf("flushing %q:%v+%v: %w", name, extent.Start, extent.Length, err1))
+			err = errors.Join(err, fmt.Errorf("flushing %q:%v+%v: %w", file.safeOsPath, extent.Start, extent.Length, err1))
 			return
 		}
 	}
@@ -84,6 +92,11 @@ func (me *filePieceImpl) Completion() (c Completion) {
 		return c
 	}
 	if c.Complete {
+		// Don't block on storage being moved, since this is called with the Client lock held.
+		if !me.t.ioMu.TryRLock() {
+			return
+		}
+		defer me.t.ioMu.RUnlock()
 		c = me.checkCompleteFileSizes()
 	}
 	return
@@ -115,6 +128,17 @@ func (me *filePieceImpl) checkCompleteFileSizes() (c Completion) {
 			// Can we use shared files for this? Is it faster?
 			s, err = os.Stat(file.partFilePath())
 		}
+		if me.partFiles() && errors.Is(err, fs.ErrNotExist) && me.t.partsCovers(file, extent) {
+			var ok bool
+			ok, err = me.t.partsHasExtent(file, extent)
+			if ok {
+				file.mu.RUnlock()
+				continue
+			}
+			if err == nil {
+				err = fs.ErrNotExist
+			}
+		}
 		file.mu.RUnlock()
 		if err != nil {
 			if errors.Is(err, fs.ErrNotExist) {
@@ -167,14 +191,23 @@ func (me *filePieceImpl) markIncompletePieces(file *file, size int64) {
 }
 
 func (me *filePieceImpl) MarkComplete() (err error) {
-	err = me.pieceCompletion().Set(me.pieceKey(), true)
-	if err != nil {
-		return
-	}
-	if pieceCompletionIsPersistent(me.pieceCompletion()) {
-		err := me.Flush()
+	me.t.ioMu.RLock()
+	defer me.t.ioMu.RUnlock()
+	if me.t.client.opts.DurableCompletion {
+		err = me.t.completionSyncer.complete(me)
+		if err != nil {
+			return
+		}
+	} else {
+		err = me.pieceCompletion().Set(me.pieceKey(), true)
 		if err != nil {
-			me.logger().Warn("error flushing completed piece", "piece", me.p.Index(), "err", err)
+			return
+		}
+		if pieceCompletionIsPersistent(me.pieceCompletion()) {
+			err := me.flush()
+			if err != nil {
+				me.logger().Warn("error flushing completed piece", "piece", me.p.Index(), "err", err)
+			}
 		}
 	}
 	for f := range me.pieceFiles() {
@@ -186,6 +219,12 @@ func (me *filePieceImpl) MarkComplete() (err error) {
 		if !res.Ok {
 			continue
 		}
+		if !f.unwanted.Load() {
+			err = me.t.moveFromParts(f)
+			if err != nil {
+				return
+			}
+		}
 		err = me.promotePartFile(f)
 		if err != nil {
 			err = fmt.Errorf("error promoting part file %q: %w", f.safeOsPath, err)
@@ -221,6 +260,8 @@ func (me *filePieceImpl) allFilePiecesComplete(f file) (ret g.Result[bool]) {
 }
 
 func (me *filePieceImpl) MarkNotComplete() (err error) {
+	me.t.ioMu.RLock()
+	defer me.t.ioMu.RUnlock()
 	err = me.pieceCompletion().Set(me.pieceKey(), false)
 	if err != nil {
 		return
@@ -309,6 +350,8 @@ func (me zeroReader) Read(p []byte) (n int, err error) {
 }
 
 func (me *filePieceImpl) WriteTo(w io.Writer) (n int64, err error) {
+	me.t.ioMu.RLock()
+	defer me.t.ioMu.RUnlock()
 	for fileIndex, extent := range me.iterFileSegments() {
 		var n1 int64
 		n1, err = me.writeFileTo(w, fileIndex, extent)
@@ -325,6 +368,43 @@ func (me *filePieceImpl) WriteTo(w io.Writer) (n int64, err error) {
 	return
 }
 
+func (me *filePieceImpl) FileSection(off, n int64) (_ FileSection, ok bool) {
+	me.t.ioMu.RLock()
+	defer me.t.ioMu.RUnlock()
+	var (
+		fileIndex int
+		extent    segments.Extent
+		segs      int
+	)
+	for fileIndex, extent = range me.t.segmentLocater.LocateIter(
+		segments.Extent{Start: me.p.Offset() + off, Length: n},
+	) {
+		segs++
+	}
+	if segs != 1 || extent.Length != n {
+		return
+	}
+	f := me.t.file(fileIndex)
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	// The same names as openFile, but data in the parts file isn't contiguous with the rest.
+	var names []string
+	if me.partFiles() {
+		names = append(names, f.partFilePath())
+	}
+	for _, name := range append(names, f.safeOsPath) {
+		fi, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		if !fi.Mode().IsRegular() || fi.Size() < extent.End() {
+			return
+		}
+		return FileSection{Name: name, Offset: extent.Start}, true
+	}
+	return
+}
+
 var (
 	packageExpvarMap = expvar.NewMap("torrentStorage")
 )
@@ -398,3 +478,69 @@ func (me *filePieceImpl) writeFileTo(w io.Writer, fileIndex int, extent segments
 //func (me *filePieceImpl) NewReader() (PieceReader, error) {
 //
 //}
+
+// Reports whether any of the piece's files are missing, short, or have holes in the piece's
+// extent. Filesystems that don't support sparse files never report holes.
+func (me *filePieceImpl) MissingData() (bool, error) {
+	me.t.ioMu.RLock()
+	defer me.t.ioMu.RUnlock()
+	for fileIndex, extent := range me.iterFileSegments() {
+		if extent.Length == 0 {
+			continue
+		}
+		f, err := me.t.openFile(me.t.file(fileIndex))
+		if errors.Is(err, fs.ErrNotExist) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		hole, err := f.seekHole(extent.Start)
+		f.Close()
+		if err != nil {
+			return false, err
+		}
+		if hole < extent.End() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Marks the piece not complete, and punches holes over its data so the space is released. Space
+// isn't released on platforms or filesystems that don't support punching holes.
+func (me *filePieceImpl) Evict() (err error) {
+	err = me.MarkNotComplete()
+	if err != nil {
+		return
+	}
+	me.t.ioMu.RLock()
+	defer me.t.ioMu.RUnlock()
+	for fileIndex, extent := range me.iterFileSegments() {
+		if extent.Length == 0 {
+			continue
+		}
+		f := me.t.file(fileIndex)
+		name := me.pathForWrite(&f)
+		_, err = os.Stat(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+			continue
+		}
+		var osFile *os.File
+		osFile, err = openFileExtra(name, os.O_WRONLY)
+		if err != nil {
+			return
+		}
+		err = punchHole(osFile, extent.Start, extent.Length)
+		osFile.Close()
+		if errors.Is(err, errors.ErrUnsupported) {
+			me.logger().Debug("can't punch hole to evict piece", "file", name)
+			err = nil
+		}
+		if err != nil {
+			return fmt.Errorf("punching hole in %q: %w", name, err)
+		}
+	}
+	return
+}
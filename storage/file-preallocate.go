@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// How the file storage allocates disk space for files.
+type FilePreallocation int
+
+const (
+	// Files are created and grown by writes. Unwritten regions may be holes, so they don't use disk
+	// space on filesystems that support sparse files.
+	FilePreallocationSparse FilePreallocation = iota
+	// Every file is allocated in full when the torrent is opened. This avoids fragmentation, and
+	// fails early if there isn't enough disk space.
+	FilePreallocationFull
+	// Files are allocated in full when they're first written to, unless they're not wanted. Files
+	// that are only written to because they share a piece with a wanted file stay sparse.
+	FilePreallocationWanted
+)
+
+func (fts *fileTorrentImpl) setFileWanted(fileIndex int, wanted bool) {
+	wasUnwanted := fts.files[fileIndex].unwanted.Swap(!wanted)
+	if wanted && wasUnwanted {
+		fts.onFileWanted(fts.file(fileIndex))
+	}
+}
+
+// Allocates the file on its first write, if the preallocation mode calls for it.
+func (fts *fileTorrentImpl) preallocateForWrite(f file) error {
+	switch fts.client.opts.Preallocation {
+	case FilePreallocationSparse:
+		return nil
+	case FilePreallocationWanted:
+		if f.unwanted.Load() {
+			return nil
+		}
+	}
+	return fts.preallocate(f)
+}
+
+// Allocates disk space for the full length of the file where it would be written, unless it's
+// already done or the file is complete.
+func (fts *fileTorrentImpl) preallocate(f file) (err error) {
+	f.mu.RLock()
+	done := f.preallocated
+	f.mu.RUnlock()
+	if done || f.length() == 0 {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.preallocated {
+		return nil
+	}
+	if fts.partFiles() {
+		// The data is complete, and won't be written to until it's moved back to a part file.
+		_, err = os.Stat(f.safeOsPath)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return
+		}
+	}
+	osFile, err := openFileExtra(fts.pathForWrite(&f), os.O_WRONLY)
+	if err != nil {
+		return
+	}
+	defer osFile.Close()
+	err = fallocate(osFile, f.length())
+	if err != nil {
+		return
+	}
+	err = osFile.Close()
+	if err != nil {
+		return
+	}
+	f.preallocated = true
+	return
+}
+
+// Extends the file to length without shrinking it.
+func extendFile(f *os.File, length int64) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() >= length {
+		return nil
+	}
+	return f.Truncate(length)
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func testFilePreallocation(t *testing.T, prealloc FilePreallocation) (dir string, ts TorrentImpl, info *metainfo.Info) {
+	dir = t.TempDir()
+	info = &metainfo.Info{
+		Name:        "dir",
+		PieceLength: 4,
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a"}, Length: 6},
+			{Path: []string{"b"}, Length: 6},
+		},
+		Pieces: make([]byte, 3*metainfo.HashSize),
+	}
+	ci := NewFileOpts(NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: NewMapPieceCompletion(),
+		Preallocation:   prealloc,
+	})
+	t.Cleanup(func() { ci.Close() })
+	ts, err := ci.OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	return
+}
+
+func fileSize(t *testing.T, name string) int64 {
+	fi, err := os.Stat(name)
+	qt.Assert(t, qt.IsNil(err))
+	return fi.Size()
+}
+
+func TestFilePreallocationFull(t *testing.T) {
+	dir, ts, info := testFilePreallocation(t, FilePreallocationFull)
+	qt.Check(t, qt.Equals(fileSize(t, filepath.Join(dir, "dir", "a.part")), 6))
+	qt.Check(t, qt.Equals(fileSize(t, filepath.Join(dir, "dir", "b.part")), 6))
+	// Preallocated files aren't mistaken for complete ones.
+	for i := range info.NumPieces() {
+		qt.Check(t, qt.IsFalse(ts.Piece(info.Piece(i)).Completion().Complete))
+	}
+}
+
+func TestFilePreallocationWanted(t *testing.T) {
+	dir, ts, info := testFilePreallocation(t, FilePreallocationWanted)
+	_, err := os.Stat(filepath.Join(dir, "dir", "a.part"))
+	qt.Check(t, qt.ErrorIs(err, os.ErrNotExist))
+	ts.SetFileWanted(1, false)
+	// The middle piece overlaps both files.
+	p := ts.Piece(info.Piece(1))
+	_, err = p.WriteAt([]byte("xyzw"), 0)
+	qt.Assert(t, qt.IsNil(err))
+	// File I/O may extend files without allocating, so check what was preallocated.
+	fts := ts.Renamer.(*fileTorrentImpl)
+	qt.Check(t, qt.IsTrue(fts.files[0].preallocated))
+	qt.Check(t, qt.IsFalse(fts.files[1].preallocated))
+	qt.Check(t, qt.Equals(fileSize(t, filepath.Join(dir, "dir", "a.part")), 6))
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+var _ Renamer = (*fileTorrentImpl)(nil)
+
+// Renames applied over the info when determining file paths. These are stored per-torrent in the
+// client base directory so they survive reopening the storage.
+type fileRenames struct {
+	Name  string           `bencode:"name,omitempty"`
+	Files []fileRenamePath `bencode:"files,omitempty"`
+}
+
+type fileRenamePath struct {
+	Index int      `bencode:"index"`
+	Path  []string `bencode:"path"`
+}
+
+func (me fileRenames) filePath(index int) (path []string, ok bool) {
+	for _, f := range me.Files {
+		if f.Index == index {
+			return f.Path, true
+		}
+	}
+	return
+}
+
+func (me fileRenames) withFilePath(index int, path []string) fileRenames {
+	me.Files = slices.DeleteFunc(slices.Clone(me.Files), func(f fileRenamePath) bool {
+		return f.Index == index
+	})
+	me.Files = append(me.Files, fileRenamePath{Index: index, Path: path})
+	slices.SortFunc(me.Files, func(a, b fileRenamePath) int {
+		return a.Index - b.Index
+	})
+	return me
+}
+
+func (me fileRenames) isZero() bool {
+	return me.Name == "" && len(me.Files) == 0
+}
+
+func fileRenamesPath(baseDir string, infoHash metainfo.Hash) string {
+	return filepath.Join(baseDir, ".torrent.renames", infoHash.HexString())
+}
+
+func loadFileRenames(path string) (ret fileRenames, err error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	err = bencode.Unmarshal(b, &ret)
+	return
+}
+
+func saveFileRenames(path string, renames fileRenames) error {
+	if renames.isZero() {
+		err := os.Remove(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+		return err
+	}
+	b, err := bencode.Marshal(renames)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), dirPerm)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, b, filePerm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Checks that a path component can't escape or be split by the OS.
+func validateRenameComponent(s string) error {
+	if s == "" || s == "." || s == ".." {
+		return fmt.Errorf("invalid path component %q", s)
+	}
+	if strings.ContainsAny(s, `/\`) || strings.ContainsRune(s, os.PathSeparator) || strings.ContainsRune(s, 0) {
+		return fmt.Errorf("path component %q contains a separator", s)
+	}
+	return nil
+}
+
+func (fts *fileTorrentImpl) RenameFile(fileIndex int, path []string) error {
+	if fileIndex < 0 || fileIndex >= len(fts.files) {
+		return fmt.Errorf("file index %v out of range", fileIndex)
+	}
+	if !fts.info.IsDir() {
+		if len(path) != 1 {
+			return errors.New("single-file torrents must be renamed to a single component")
+		}
+		return fts.RenameRoot(path[0])
+	}
+	if len(path) == 0 {
+		return errors.New("empty path")
+	}
+	for _, c := range path {
+		if err := validateRenameComponent(c); err != nil {
+			return err
+		}
+	}
+	fts.ioMu.Lock()
+	defer fts.ioMu.Unlock()
+	return fts.applyRenames(fts.renames.withFilePath(fileIndex, slices.Clone(path)))
+}
+
+func (fts *fileTorrentImpl) RenameRoot(name string) error {
+	if err := validateRenameComponent(name); err != nil {
+		return err
+	}
+	fts.ioMu.Lock()
+	defer fts.ioMu.Unlock()
+	renames := fts.renames
+	renames.Name = name
+	return fts.applyRenames(renames)
+}
+
+// Moves files to their paths under the new renames, and persists them. Files that were already
+// moved are moved back if an error occurs. Must hold ioMu for writing.
+func (fts *fileTorrentImpl) applyRenames(renames fileRenames) (err error) {
+	newPaths, err := fts.client.filePaths(fts.dir, fts.info, fts.metainfoFileInfos, renames)
+	if err != nil {
+		return
+	}
+	// Two files can't be renamed to the same path.
+	seen := make(map[string]int, len(newPaths))
+	for i, p := range newPaths {
+		if j, ok := seen[p]; ok {
+			return fmt.Errorf("files %v and %v would both be at %q", j, i, p)
+		}
+		seen[p] = i
+	}
+	oldPaths := make([]string, len(fts.files))
+	for i := range fts.files {
+		oldPaths[i] = fts.files[i].safeOsPath
+	}
+	ctx := context.Background()
+	noProgress := func(int64) {}
+	for i := range fts.files {
+		err = fts.moveFile(ctx, fts.file(i), newPaths[i], noProgress)
+		if err != nil {
+			err = fmt.Errorf("renaming %q: %w", oldPaths[i], err)
+			for j := range i {
+				rollbackErr := fts.moveFile(ctx, fts.file(j), oldPaths[j], noProgress)
+				if rollbackErr != nil {
+					fts.logger().Error("restoring renamed file", "file", newPaths[j], "err", rollbackErr)
+				}
+			}
+			return
+		}
+	}
+	for i := range fts.files {
+		removeEmptyDirs(fts.dir, filepath.Dir(oldPaths[i]))
+	}
+	fts.renames = renames
+	return saveFileRenames(fileRenamesPath(fts.baseDir, fts.infoHash), renames)
+}
+
+// Moves the persisted renames along with the files for MoveStorage. Must hold ioMu for writing.
+func (fts *fileTorrentImpl) moveRenames(newBaseDir string) error {
+	oldPath := fileRenamesPath(fts.baseDir, fts.infoHash)
+	fts.baseDir = newBaseDir
+	if fts.renames.isZero() {
+		return nil
+	}
+	err := saveFileRenames(fileRenamesPath(newBaseDir, fts.infoHash), fts.renames)
+	if err != nil {
+		return err
+	}
+	os.Remove(oldPath)
+	removeEmptyDirs(filepath.Dir(filepath.Dir(oldPath)), filepath.Dir(oldPath))
+	return nil
+}
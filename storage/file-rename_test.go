@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestFileRename(t *testing.T) {
+	base := t.TempDir()
+	pc := NewMapPieceCompletion()
+	newClient := func(base string) ClientImpl {
+		return NewFileOpts(NewFileClientOpts{
+			ClientBaseDir:   base,
+			PieceCompletion: pc,
+		})
+	}
+	info := &metainfo.Info{
+		Name:        "Ugly.Release.Name",
+		PieceLength: 4,
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a"}, Length: 4},
+			{Path: []string{"sub", "b"}, Length: 4},
+		},
+		Pieces: make([]byte, 2*metainfo.HashSize),
+	}
+	ts, err := NewClient(newClient(base)).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	p0 := ts.Piece(info.Piece(0))
+	_, err = p0.WriteAt([]byte("abcd"), 0)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(p0.MarkComplete()))
+	p1 := ts.Piece(info.Piece(1))
+	_, err = p1.WriteAt([]byte("ef"), 0)
+	qt.Assert(t, qt.IsNil(err))
+
+	qt.Assert(t, qt.IsNil(ts.Renamer.RenameRoot("Nice Name")))
+	qt.Assert(t, qt.IsNil(ts.Renamer.RenameFile(1, []string{"b"})))
+	_, err = os.Stat(filepath.Join(base, "Ugly.Release.Name"))
+	qt.Check(t, qt.ErrorIs(err, os.ErrNotExist))
+	for _, name := range []string{"a", "b.part"} {
+		_, err = os.Stat(filepath.Join(base, "Nice Name", name))
+		qt.Check(t, qt.IsNil(err), qt.Commentf("%v", name))
+	}
+	qt.Check(t, qt.Equals(p0.Completion(), Completion{Complete: true, Ok: true}))
+
+	// Bad paths and collisions are rejected without changing anything.
+	qt.Check(t, qt.IsNotNil(ts.Renamer.RenameFile(0, []string{".."})))
+	qt.Check(t, qt.IsNotNil(ts.Renamer.RenameFile(0, []string{"x/y"})))
+	qt.Check(t, qt.IsNotNil(ts.Renamer.RenameFile(0, []string{"b"})))
+	_, err = os.Stat(filepath.Join(base, "Nice Name", "a"))
+	qt.Check(t, qt.IsNil(err))
+
+	// Renames persist across reopening and moving.
+	qt.Assert(t, qt.IsNil(ts.Close()))
+	ts, err = NewClient(newClient(base)).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	p1 = ts.Piece(info.Piece(1))
+	_, err = p1.WriteAt([]byte("gh"), 2)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(p1.MarkComplete()))
+	newBase := t.TempDir()
+	qt.Assert(t, qt.IsNil(ts.Mover.MoveStorage(context.Background(), newBase, nil)))
+	qt.Assert(t, qt.IsNil(ts.Close()))
+	ts, err = NewClient(newClient(newBase)).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	defer ts.Close()
+	b, err := os.ReadFile(filepath.Join(newBase, "Nice Name", "b"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b), "efgh"))
+	for i := range info.NumPieces() {
+		qt.Check(t, qt.Equals(ts.Piece(info.Piece(i)).Completion(), Completion{Complete: true, Ok: true}))
+	}
+}
@@ -48,6 +48,8 @@ func (fst fileTorrentImplIO) readFileAt(file file, b []byte, off int64) (n int,
 
 // Only returns EOF at the end of the torrent. Premature EOF is ErrUnexpectedEOF.
 func (fst fileTorrentImplIO) ReadAt(b []byte, off int64) (n int, err error) {
+	fst.fts.ioMu.RLock()
+	defer fst.fts.ioMu.RUnlock()
 	for i, e := range fst.fts.segmentLocater.LocateIter(
 		segments.Extent{off, int64(len(b))},
 	) {
@@ -76,14 +78,32 @@ func (fst fileTorrentImplIO) ReadAt(b []byte, off int64) (n int, err error) {
 }
 
 func (fst fileTorrentImplIO) WriteAt(p []byte, off int64) (n int, err error) {
+	fst.fts.ioMu.RLock()
+	defer fst.fts.ioMu.RUnlock()
 	for i, e := range fst.fts.segmentLocater.LocateIter(
 		segments.Extent{off, int64(len(p))},
 	) {
+		file := fst.fts.file(i)
 		var f fileWriter
-		f, err = fst.fts.openForWrite(fst.fts.file(i))
+		var toParts bool
+		f, toParts, err = fst.fts.openPartsForWrite(file, e)
 		if err != nil {
 			return
 		}
+		if !toParts {
+			err = fst.fts.moveFromParts(file)
+			if err != nil {
+				return
+			}
+			err = fst.fts.preallocateForWrite(file)
+			if err != nil {
+				return
+			}
+			f, err = fst.fts.openForWrite(file)
+			if err != nil {
+				return
+			}
+		}
 		var n1 int
 		n1, err = f.WriteAt(p[:e.Length], e.Start)
 		closeErr := f.Close()
@@ -7,6 +7,7 @@ import (
 	"io/fs"
 	"log/slog"
 	"os"
+	"sync"
 
 	"github.com/anacrolix/missinggo/v2"
 	"github.com/anacrolix/missinggo/v2/panicif"
@@ -16,7 +17,13 @@ import (
 )
 
 type fileTorrentImpl struct {
-	info              *metainfo.Info
+	info *metainfo.Info
+	// The client base directory, and the directory the torrent's files are in. Changed by
+	// MoveStorage.
+	baseDir string
+	dir     string
+	// Changed by the Renamer methods. Protected by ioMu.
+	renames           fileRenames
 	files             []fileExtra
 	metainfoFileInfos []metainfo.FileInfo
 	segmentLocater    segments.Index
@@ -24,6 +31,14 @@ type fileTorrentImpl struct {
 	io                fileIo
 	// Save memory by pointing to the other data.
 	client *fileClientImpl
+	// Held for reading around I/O, and for writing to pause I/O while files are moved.
+	ioMu sync.RWMutex
+	// Where data for unwanted files is kept with part files, and the slots in it for the pieces
+	// shared between files. partsPath is empty if there isn't one, and is changed by MoveStorage.
+	partsPath  string
+	partsSlots map[int]int
+	// Batches syncs for pieces completed with NewFileClientOpts.DurableCompletion.
+	completionSyncer fileCompletionSyncer
 }
 
 func (fts *fileTorrentImpl) logger() *slog.Logger {
@@ -93,6 +108,29 @@ func (fts *fileTorrentImpl) pathForWrite(f *file) string {
 	return f.safeOsPath
 }
 
+// Flushes the extent of the file wherever its data is, resolving names as openFile does. With part
+// files, a file under its final name was synced before it was promoted, and an unwanted file's data
+// may be in the parts file.
+func (fts *fileTorrentImpl) flushFileExtent(f file, e segments.Extent) error {
+	if !fts.partFiles() {
+		return fts.io.flush(f.safeOsPath, e.Start, e.Length)
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	err := fts.io.flush(f.partFilePath(), e.Start, e.Length)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if _, err = os.Stat(f.safeOsPath); !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if fts.partsCovers(f, e) {
+		// The parts file isn't written through fileIo.
+		return fsync(fts.partsPath)
+	}
+	return err
+}
+
 func (fts *fileTorrentImpl) getCompletion(piece int) Completion {
 	cmpl, err := fts.pieceCompletion().Get(metainfo.PieceKey{fts.infoHash, piece})
 	cmpl.Err = errors.Join(cmpl.Err, err)
@@ -116,6 +154,8 @@ func (fs *fileTorrentImpl) Close() error {
 }
 
 func (fts *fileTorrentImpl) Flush() (err error) {
+	fts.ioMu.RLock()
+	defer fts.ioMu.RUnlock()
 	for i := range fts.files {
 		f := fts.file(i)
 		name := fts.pathForWrite(&f)
@@ -145,6 +185,13 @@ func (me *fileTorrentImpl) openSharedFile(file file) (f sharedFileIf, err error)
 	if err == nil && f == nil || errors.Is(err, fs.ErrNotExist) {
 		f, err = me.io.openForSharedRead(file.safeOsPath)
 	}
+	if errors.Is(err, fs.ErrNotExist) && me.partFiles() {
+		var view *partsFileView
+		view, err = me.openPartsForRead(file)
+		if err == nil {
+			f = view
+		}
+	}
 	file.mu.RUnlock()
 	return
 }
@@ -160,6 +207,13 @@ func (me *fileTorrentImpl) openFile(file file) (f fileReader, err error) {
 	if err == nil && f == nil || errors.Is(err, fs.ErrNotExist) {
 		f, err = me.io.openForRead(file.safeOsPath)
 	}
+	if errors.Is(err, fs.ErrNotExist) && me.partFiles() {
+		var view *partsFileView
+		view, err = me.openPartsForRead(file)
+		if err == nil {
+			f = view
+		}
+	}
 	file.mu.RUnlock()
 	return
 }
@@ -37,6 +37,41 @@ type TorrentImpl struct {
 	// to determine the storage for torrents sharing the same function pointer, and mutated in
 	// place.
 	Capacity TorrentCapacity
+	// Optional. Relocates the torrent's data while it's open.
+	Mover Mover
+	// Optional. Renames the torrent's files while it's open.
+	Renamer Renamer
+	// Optional. Called with whether a file is wanted once the torrent is opened, and again whenever
+	// that may have changed, such as through its priority. It can be called with an unchanged
+	// state. Files are assumed to be wanted until told otherwise.
+	SetFileWanted func(fileIndex int, wanted bool)
+	// Optional. Called with the sorted indexes of the pieces that readers are using or are about to,
+	// which storage should avoid evicting.
+	SetReaderPieces func(pieces []int)
+}
+
+// Implemented by storage that can rename a torrent's files while it's open, without losing data or
+// piece completion. Renames persist when the storage is reopened.
+type Renamer interface {
+	// Replaces the path components of a file, relative to the torrent's root directory. For
+	// single-file torrents this replaces the name.
+	RenameFile(fileIndex int, path []string) error
+	// Replaces the info name, which is the root directory of multi-file torrents.
+	RenameRoot(name string) error
+}
+
+// Implemented by storage that can relocate a torrent's data, such as to a different disk.
+type Mover interface {
+	// Moves the data to where it would be if the storage had been opened with newBaseDir. I/O is
+	// paused while moving. progress is called as data is moved, and may be nil.
+	MoveStorage(ctx context.Context, newBaseDir string, progress func(MoveProgress)) error
+}
+
+type MoveProgress struct {
+	BytesDone  int64
+	BytesTotal int64
+	FilesDone  int
+	FilesTotal int
 }
 
 // Interacts with torrent piece data. Optional interfaces to implement include:
@@ -70,6 +105,35 @@ type SelfHashing interface {
 	SelfHash() (metainfo.Hash, error)
 }
 
+// Allows a storage backend to report that a piece is missing some of its data without reading it,
+// such as when its files are short or contain sparse holes. Pieces that are missing data are
+// treated as failing a hash check.
+type MissingDataChecker interface {
+	MissingData() (bool, error)
+}
+
+// Implemented by pieces that can release the space used by their data, such as by punching holes in
+// files. The piece is no longer complete afterwards.
+type PieceEvicter interface {
+	Evict() error
+}
+
+// Where part of a piece is stored in a regular file.
+type FileSection struct {
+	// The path of the file.
+	Name string
+	// The offset of the data in the file.
+	Offset int64
+}
+
+// Implemented by pieces that keep their data in regular files. This allows data to be sent from the
+// file directly, such as with sendfile, without copying it through memory.
+type PieceFileSectioner interface {
+	// Returns where the extent of the piece is stored. ok is false if it isn't stored contiguously
+	// in a single file.
+	FileSection(off, n int64) (_ FileSection, ok bool)
+}
+
 // Piece supports dedicated reader.
 type PieceReaderer interface {
 	NewReader() (PieceReader, error)
@@ -16,6 +16,7 @@ import (
 
 	"github.com/anacrolix/torrent/metainfo"
 	mmapSpan "github.com/anacrolix/torrent/mmap-span"
+	"github.com/anacrolix/torrent/segments"
 )
 
 type mmapClientImpl struct {
@@ -40,11 +41,13 @@ func (s *mmapClientImpl) OpenTorrent(
 	info *metainfo.Info,
 	infoHash metainfo.Hash,
 ) (_ TorrentImpl, err error) {
-	span, err := mMapTorrent(info, s.baseDir)
+	span, mMaps, err := mMapTorrent(info, s.baseDir)
 	t := &mmapTorrentStorage{
-		infoHash: infoHash,
-		span:     span,
-		pc:       s.pc,
+		infoHash:       infoHash,
+		span:           span,
+		mMaps:          mMaps,
+		segmentLocater: info.FileSegmentsIndex(),
+		pc:             s.pc,
 	}
 	return TorrentImpl{Piece: t.Piece, Close: t.Close}, err
 }
@@ -56,7 +59,10 @@ func (s *mmapClientImpl) Close() error {
 type mmapTorrentStorage struct {
 	infoHash metainfo.Hash
 	span     *mmapSpan.MMapSpan
-	pc       PieceCompletionGetSetter
+	// The mappings in span, for access to their files.
+	mMaps          []FileMapping
+	segmentLocater segments.Index
+	pc             PieceCompletionGetSetter
 }
 
 func (ts *mmapTorrentStorage) Piece(p metainfo.Piece) PieceImpl {
@@ -109,8 +115,30 @@ func (sp mmapStoragePiece) MarkNotComplete() error {
 	return sp.t.pc.Set(sp.pieceKey(), false)
 }
 
-func mMapTorrent(md *metainfo.Info, location string) (mms *mmapSpan.MMapSpan, err error) {
-	var mMaps []FileMapping
+// Marks the piece not complete, and punches holes over its data in the mapped files. Space isn't
+// released where punching holes isn't supported.
+func (sp mmapStoragePiece) Evict() error {
+	err := sp.MarkNotComplete()
+	if err != nil {
+		return err
+	}
+	for i, e := range sp.t.segmentLocater.LocateIter(segments.Extent{Start: sp.p.Offset(), Length: sp.p.Length()}) {
+		mm, ok := sp.t.mMaps[i].(mmapWithFile)
+		if !ok || e.Length == 0 {
+			continue
+		}
+		err = punchHole(mm.f, e.Start, e.Length)
+		if errors.Is(err, errors.ErrUnsupported) {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mMapTorrent(md *metainfo.Info, location string) (mms *mmapSpan.MMapSpan, mMaps []FileMapping, err error) {
 	defer func() {
 		if err != nil {
 			for _, mm := range mMaps {
@@ -133,7 +161,7 @@ func mMapTorrent(md *metainfo.Info, location string) (mms *mmapSpan.MMapSpan, er
 		}
 		mMaps = append(mMaps, mm)
 	}
-	return mmapSpan.New(mMaps, md.FileSegmentsIndex()), nil
+	return mmapSpan.New(mMaps, md.FileSegmentsIndex()), mMaps, nil
 }
 
 func mmapFile(name string, size int64) (_ FileMapping, err error) {
@@ -0,0 +1,334 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	g "github.com/anacrolix/generics"
+
+	"github.com/anacrolix/torrent/metainfo"
+	typedRoaring "github.com/anacrolix/torrent/typed-roaring"
+)
+
+// The default memory budget for a Ring.
+const DefaultRingCapacity = 64 << 20
+
+type NewRingOpts struct {
+	// The most memory to use for piece data across all torrents. Defaults to DefaultRingCapacity.
+	Capacity int64
+}
+
+// Memory-only storage with a hard budget, for streaming without a disk. Whole pieces are allocated
+// when first written. When the budget would be exceeded, pieces that torrent readers aren't using
+// are dropped, starting with those furthest behind the readers. The budget is reported as the
+// torrents' capacity, so only as many pieces as fit are requested, with reader positions and
+// readahead coming first. Readahead beyond the budget isn't fetched until the reader moves on.
+// Incomplete pieces are only dropped when no complete pieces can be, oldest first, so partial pieces
+// left behind when a reader seeks elsewhere don't fill the budget. Writes to new pieces fail if the
+// budget is used by pieces readers are using.
+type Ring struct {
+	opts    NewRingOpts
+	capFunc func() (int64, bool)
+
+	mu sync.Mutex
+	// Bytes allocated for pieces. Protected by mu, as are the fields of ringTorrent and ringPiece.
+	used     int64
+	torrents map[*ringTorrent]struct{}
+	// ringKeys of incomplete pieces, in the order they were allocated.
+	incomplete list.List
+}
+
+var _ ClientImplCloser = (*Ring)(nil)
+
+func NewRing(opts NewRingOpts) *Ring {
+	if opts.Capacity <= 0 {
+		opts.Capacity = DefaultRingCapacity
+	}
+	r := &Ring{
+		opts:     opts,
+		torrents: make(map[*ringTorrent]struct{}),
+	}
+	r.capFunc = func() (int64, bool) {
+		return r.opts.Capacity, true
+	}
+	return r
+}
+
+func (r *Ring) Close() error {
+	return nil
+}
+
+// Returns the bytes of memory allocated for pieces.
+func (r *Ring) Used() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.used
+}
+
+func (r *Ring) OpenTorrent(ctx context.Context, info *metainfo.Info, infoHash metainfo.Hash) (TorrentImpl, error) {
+	if info.PieceLength > r.opts.Capacity {
+		return TorrentImpl{}, fmt.Errorf(
+			"piece length %v exceeds ring storage capacity %v", info.PieceLength, r.opts.Capacity)
+	}
+	t := &ringTorrent{
+		r:      r,
+		info:   info,
+		pieces: make(map[int]*ringPiece),
+	}
+	r.mu.Lock()
+	r.torrents[t] = struct{}{}
+	r.mu.Unlock()
+	return TorrentImpl{
+		Piece:           t.Piece,
+		PieceWithHash:   t.PieceWithHash,
+		Close:           t.Close,
+		Capacity:        &r.capFunc,
+		SetReaderPieces: t.setReaderPieces,
+	}, nil
+}
+
+type ringTorrent struct {
+	r    *Ring
+	info *metainfo.Info
+	// Pieces with memory allocated.
+	pieces map[int]*ringPiece
+	// The complete pieces with memory allocated.
+	complete     typedRoaring.Bitmap[int]
+	readerPieces []int
+}
+
+type ringPiece struct {
+	data []byte
+	// The piece's element in Ring.incomplete, or nil if it's complete.
+	incomplete *list.Element
+}
+
+type ringKey struct {
+	t     *ringTorrent
+	index int
+}
+
+func (t *ringTorrent) Piece(p metainfo.Piece) PieceImpl {
+	return t.PieceWithHash(p, g.None[[]byte]())
+}
+
+func (t *ringTorrent) PieceWithHash(p metainfo.Piece, pieceHash g.Option[[]byte]) PieceImpl {
+	return ringPieceImpl{t, p}
+}
+
+func (t *ringTorrent) setReaderPieces(pieces []int) {
+	t.r.mu.Lock()
+	t.readerPieces = pieces
+	t.r.mu.Unlock()
+}
+
+func (t *ringTorrent) Close() error {
+	t.r.mu.Lock()
+	defer t.r.mu.Unlock()
+	for i := range t.pieces {
+		t.drop(i)
+	}
+	delete(t.r.torrents, t)
+	return nil
+}
+
+// Must hold mu.
+func (t *ringTorrent) drop(i int) {
+	rp := t.pieces[i]
+	if rp.incomplete != nil {
+		t.r.incomplete.Remove(rp.incomplete)
+	} else {
+		t.complete.Remove(i)
+	}
+	t.r.used -= int64(len(rp.data))
+	delete(t.pieces, i)
+}
+
+// Must hold mu.
+func (t *ringTorrent) setComplete(i int, rp *ringPiece, complete bool) {
+	if complete {
+		if rp.incomplete != nil {
+			t.r.incomplete.Remove(rp.incomplete)
+			rp.incomplete = nil
+		}
+		t.complete.Add(i)
+	} else if rp.incomplete == nil {
+		t.complete.Remove(i)
+		rp.incomplete = t.r.incomplete.PushBack(ringKey{t, i})
+	}
+}
+
+// Must hold mu.
+func (t *ringTorrent) readerPiece(i int) bool {
+	_, found := slices.BinarySearch(t.readerPieces, i)
+	return found
+}
+
+// Returns how readily a complete piece that readers aren't using should be dropped. Pieces behind all
+// the torrent's readers go first, furthest behind first, then pieces ahead of readers, furthest
+// ahead first. Must hold mu.
+func (t *ringTorrent) evictionScore(i int) (behind bool, distance int) {
+	pos, _ := slices.BinarySearch(t.readerPieces, i)
+	if pos == 0 {
+		if len(t.readerPieces) == 0 {
+			return true, t.info.NumPieces() - i
+		}
+		return true, t.readerPieces[0] - i
+	}
+	return false, i - t.readerPieces[pos-1]
+}
+
+// Returns the complete piece that readers aren't using that should be dropped first, and its
+// evictionScore. Must hold mu.
+func (t *ringTorrent) completeVictim() (victim int, behind bool, distance int, ok bool) {
+	if t.complete.IsEmpty() {
+		return
+	}
+	first := int(t.complete.Minimum())
+	if len(t.readerPieces) == 0 || first < t.readerPieces[0] {
+		behind, distance = t.evictionScore(first)
+		return first, behind, distance, true
+	}
+	// The furthest piece ahead of each run of reader pieces is the last complete piece before the
+	// next run.
+	rps := t.readerPieces
+	for k, runEnd := range rps {
+		next := t.info.NumPieces()
+		if k+1 < len(rps) {
+			if rps[k+1] == runEnd+1 {
+				continue
+			}
+			next = rps[k+1]
+		}
+		rank := t.complete.Rank(next - 1)
+		if rank == 0 {
+			continue
+		}
+		last, err := t.complete.Select(uint32(rank - 1))
+		if err != nil {
+			panic(err)
+		}
+		if i := int(last); i > runEnd && i-runEnd > distance {
+			victim, distance, ok = i, i-runEnd, true
+		}
+	}
+	return
+}
+
+var errRingFull = errors.New("ring storage is full of pieces in use by readers")
+
+// Drops pieces not used by readers until there's room for n more bytes. Complete pieces go first,
+// then incomplete pieces, oldest first. Must hold mu.
+func (r *Ring) makeRoom(n int64) error {
+	for r.used+n > r.opts.Capacity {
+		var (
+			victimTorrent *ringTorrent
+			victimPiece   int
+			victimBehind  bool
+			victimDist    int
+		)
+		for t := range r.torrents {
+			i, behind, dist, ok := t.completeVictim()
+			if !ok {
+				continue
+			}
+			better := victimTorrent == nil ||
+				behind && !victimBehind ||
+				behind == victimBehind && dist > victimDist
+			if better {
+				victimTorrent, victimPiece, victimBehind, victimDist = t, i, behind, dist
+			}
+		}
+		for e := r.incomplete.Front(); victimTorrent == nil && e != nil; e = e.Next() {
+			key := e.Value.(ringKey)
+			if !key.t.readerPiece(key.index) {
+				victimTorrent, victimPiece = key.t, key.index
+			}
+		}
+		if victimTorrent == nil {
+			return errRingFull
+		}
+		victimTorrent.drop(victimPiece)
+	}
+	return nil
+}
+
+type ringPieceImpl struct {
+	t *ringTorrent
+	p metainfo.Piece
+}
+
+var errRingPieceMissing = errors.New("piece not in ring storage")
+
+func (me ringPieceImpl) ReadAt(b []byte, off int64) (n int, err error) {
+	me.t.r.mu.Lock()
+	defer me.t.r.mu.Unlock()
+	rp, ok := me.t.pieces[me.p.Index()]
+	if !ok {
+		return 0, errRingPieceMissing
+	}
+	if off >= int64(len(rp.data)) {
+		return 0, io.EOF
+	}
+	n = copy(b, rp.data[off:])
+	if n < len(b) {
+		err = io.EOF
+	}
+	return
+}
+
+func (me ringPieceImpl) WriteAt(b []byte, off int64) (n int, err error) {
+	me.t.r.mu.Lock()
+	defer me.t.r.mu.Unlock()
+	rp, ok := me.t.pieces[me.p.Index()]
+	if !ok {
+		length := me.p.Length()
+		err = me.t.r.makeRoom(length)
+		if err != nil {
+			return
+		}
+		rp = &ringPiece{data: make([]byte, length)}
+		me.t.setComplete(me.p.Index(), rp, false)
+		me.t.pieces[me.p.Index()] = rp
+		me.t.r.used += length
+	}
+	if off+int64(len(b)) > int64(len(rp.data)) {
+		return 0, io.ErrShortWrite
+	}
+	return copy(rp.data[off:], b), nil
+}
+
+func (me ringPieceImpl) MarkComplete() error {
+	me.t.r.mu.Lock()
+	defer me.t.r.mu.Unlock()
+	rp, ok := me.t.pieces[me.p.Index()]
+	if !ok {
+		return errRingPieceMissing
+	}
+	me.t.setComplete(me.p.Index(), rp, true)
+	return nil
+}
+
+func (me ringPieceImpl) MarkNotComplete() error {
+	me.t.r.mu.Lock()
+	defer me.t.r.mu.Unlock()
+	if rp, ok := me.t.pieces[me.p.Index()]; ok {
+		me.t.setComplete(me.p.Index(), rp, false)
+	}
+	return nil
+}
+
+func (me ringPieceImpl) Completion() Completion {
+	me.t.r.mu.Lock()
+	defer me.t.r.mu.Unlock()
+	rp, ok := me.t.pieces[me.p.Index()]
+	return Completion{
+		Complete: ok && rp.incomplete == nil,
+		Ok:       true,
+	}
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestRing(t *testing.T) {
+	const pieceLen = 4
+	ring := NewRing(NewRingOpts{Capacity: 3 * pieceLen})
+	defer ring.Close()
+	info := &metainfo.Info{
+		Name:        "a",
+		Length:      6 * pieceLen,
+		PieceLength: pieceLen,
+		Pieces:      make([]byte, 6*metainfo.HashSize),
+	}
+	ts, err := NewClient(ring).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	cap, capped := (*ts.Capacity)()
+	qt.Check(t, qt.IsTrue(capped))
+	qt.Check(t, qt.Equals(cap, 3*pieceLen))
+	piece := func(i int) Piece {
+		return ts.Piece(info.Piece(i))
+	}
+	data := func(i int) []byte {
+		return bytes.Repeat([]byte{byte(i)}, pieceLen)
+	}
+	write := func(i int) error {
+		_, err := piece(i).WriteAt(data(i), 0)
+		if err == nil {
+			err = piece(i).MarkComplete()
+		}
+		return err
+	}
+	stored := func() (ret []int) {
+		for i := range info.NumPieces() {
+			if piece(i).Completion().Complete {
+				ret = append(ret, i)
+			}
+		}
+		return
+	}
+	ts.SetReaderPieces([]int{3})
+	for i := range 4 {
+		qt.Assert(t, qt.IsNil(write(i)))
+	}
+	// The piece furthest behind the reader goes first.
+	qt.Check(t, qt.DeepEquals(stored(), []int{1, 2, 3}))
+	qt.Check(t, qt.Equals(ring.Used(), 3*pieceLen))
+	b := make([]byte, pieceLen)
+	_, err = piece(0).ReadAt(b, 0)
+	qt.Check(t, qt.IsNotNil(err))
+	_, err = piece(2).ReadAt(b, 0)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(b, data(2)))
+
+	// After seeking back, pieces ahead of the reader are dropped, furthest first.
+	ts.SetReaderPieces([]int{1})
+	qt.Assert(t, qt.IsNil(write(0)))
+	qt.Check(t, qt.DeepEquals(stored(), []int{0, 1, 2}))
+
+	// Pieces in use by readers aren't dropped.
+	ts.SetReaderPieces([]int{0, 1, 2})
+	qt.Check(t, qt.ErrorIs(write(5), errRingFull))
+	qt.Check(t, qt.DeepEquals(stored(), []int{0, 1, 2}))
+
+	// Complete pieces are dropped before incomplete ones.
+	ts.SetReaderPieces([]int{5})
+	_, err = piece(4).WriteAt(data(4), 0)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(write(3)))
+	qt.Check(t, qt.DeepEquals(stored(), []int{2, 3}))
+	_, err = piece(4).ReadAt(b, 0)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(b, data(4)))
+
+	// Incomplete pieces in use by readers aren't dropped either.
+	ts.SetReaderPieces([]int{2, 3, 4})
+	qt.Check(t, qt.ErrorIs(write(5), errRingFull))
+
+	// Incomplete pieces readers have left are dropped.
+	ts.SetReaderPieces([]int{2, 3})
+	qt.Assert(t, qt.IsNil(write(5)))
+	qt.Check(t, qt.DeepEquals(stored(), []int{2, 3, 5}))
+	_, err = piece(4).ReadAt(b, 0)
+	qt.Check(t, qt.ErrorIs(err, errRingPieceMissing))
+}
+
+// Partial pieces that readers have left don't fill the budget, and the oldest go first.
+func TestRingDropsOldestIncomplete(t *testing.T) {
+	const pieceLen = 4
+	ring := NewRing(NewRingOpts{Capacity: 2 * pieceLen})
+	defer ring.Close()
+	info := &metainfo.Info{
+		Name:        "a",
+		Length:      4 * pieceLen,
+		PieceLength: pieceLen,
+		Pieces:      make([]byte, 4*metainfo.HashSize),
+	}
+	ts, err := NewClient(ring).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	writePartial := func(i int) error {
+		_, err := ts.Piece(info.Piece(i)).WriteAt([]byte{byte(i)}, 0)
+		return err
+	}
+	allocated := func(i int) bool {
+		_, err := ts.Piece(info.Piece(i)).ReadAt(make([]byte, 1), 0)
+		return err == nil
+	}
+	for i := range 2 {
+		qt.Assert(t, qt.IsNil(writePartial(i)))
+	}
+	for i := 2; i < 4; i++ {
+		ts.SetReaderPieces([]int{i})
+		qt.Assert(t, qt.IsNil(writePartial(i)))
+		qt.Check(t, qt.IsFalse(allocated(i-2)))
+		qt.Check(t, qt.IsTrue(allocated(i-1)))
+		qt.Check(t, qt.IsTrue(allocated(i)))
+	}
+	qt.Check(t, qt.Equals(ring.Used(), 2*pieceLen))
+}
@@ -0,0 +1,368 @@
+// Package s3Storage stores torrent data in S3-compatible object storage.
+package s3Storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Used if Client.Region is empty. Most S3-compatible services ignore the region.
+	DefaultRegion        = "us-east-1"
+	metadataHeaderPrefix = "X-Amz-Meta-"
+)
+
+// A minimal client for the parts of the S3 API needed to store torrent data. Requests use
+// path-style addressing (<Endpoint>/<Bucket>/<key>), which is supported by AWS and by
+// S3-compatible services such as MinIO, Ceph and Garage.
+type Client struct {
+	// Base URL of the service, for example "https://s3.eu-west-1.amazonaws.com" or
+	// "http://localhost:9000".
+	Endpoint    string
+	Bucket      string
+	Region      string
+	Credentials Credentials
+	// Defaults to http.DefaultClient.
+	HttpClient *http.Client
+}
+
+// Details of a stored object. Metadata keys are lower case, without the x-amz-meta- prefix.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ETag         string
+	Metadata     map[string]string
+}
+
+// An error response from the service. Errors for missing objects match fs.ErrNotExist with
+// errors.Is.
+type Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (me *Error) Error() string {
+	if me.Code == "" {
+		return fmt.Sprintf("s3: http status %v", me.StatusCode)
+	}
+	return fmt.Sprintf("s3: %v: %v", me.Code, me.Message)
+}
+
+func (me *Error) Is(target error) bool {
+	return target == fs.ErrNotExist && (me.StatusCode == http.StatusNotFound || me.Code == "NoSuchKey")
+}
+
+func (me *Client) objectUrl(key string, query url.Values) *url.URL {
+	u, err := url.Parse(me.Endpoint)
+	if err != nil {
+		panic(fmt.Sprintf("bad endpoint %q: %v", me.Endpoint, err))
+	}
+	p := strings.TrimSuffix(u.Path, "/") + "/" + me.Bucket
+	if key != "" {
+		p += "/" + key
+	}
+	u.Path = p
+	// Send exactly what gets signed.
+	u.RawPath = uriEncode(p, false)
+	u.RawQuery = query.Encode()
+	return u
+}
+
+// Builds, signs and sends a request. Responses with error status codes are returned as *Error.
+// body may be nil. size is the body length, or -1 if it has no body.
+func (me *Client) do(
+	ctx context.Context,
+	method, key string,
+	query url.Values,
+	header http.Header,
+	body io.Reader,
+	size int64,
+) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, me.objectUrl(key, query).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	payloadSha := emptyPayloadSha
+	if body != nil {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+		payloadSha = unsignedPayload
+	}
+	region := me.Region
+	if region == "" {
+		region = DefaultRegion
+	}
+	signV4(req, me.Credentials, region, "s3", payloadSha, time.Now())
+	httpClient := me.HttpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		ret := &Error{StatusCode: resp.StatusCode}
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		xml.Unmarshal(b, ret)
+		return nil, ret
+	}
+	resp.Body = drainOnClose{resp.Body}
+	return resp, nil
+}
+
+// Reads a little of what remains on Close, so the connection can be reused.
+type drainOnClose struct {
+	io.ReadCloser
+}
+
+func (me drainOnClose) Close() error {
+	io.Copy(io.Discard, io.LimitReader(me.ReadCloser, 1<<16))
+	return me.ReadCloser.Close()
+}
+
+// Reads length bytes of the object from off. A negative length reads to the end of the object.
+func (me *Client) GetObject(ctx context.Context, key string, off, length int64) (io.ReadCloser, error) {
+	header := make(http.Header)
+	if off != 0 || length >= 0 {
+		if length == 0 {
+			return io.NopCloser(bytes.NewReader(nil)), nil
+		}
+		r := "bytes=" + strconv.FormatInt(off, 10) + "-"
+		if length > 0 {
+			r += strconv.FormatInt(off+length-1, 10)
+		}
+		header.Set("Range", r)
+	}
+	resp, err := me.do(ctx, http.MethodGet, key, nil, header, nil, -1)
+	if err != nil {
+		// Reading past the end of an object.
+		var s3Err *Error
+		if errors.As(err, &s3Err) && s3Err.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			return io.NopCloser(bytes.NewReader(nil)), nil
+		}
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (me *Client) PutObject(
+	ctx context.Context, key string, r io.Reader, size int64, metadata map[string]string,
+) error {
+	if r == nil {
+		r = bytes.NewReader(nil)
+	}
+	resp, err := me.do(ctx, http.MethodPut, key, nil, metadataHeader(metadata), r, size)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (me *Client) HeadObject(ctx context.Context, key string) (ret ObjectInfo, err error) {
+	resp, err := me.do(ctx, http.MethodHead, key, nil, nil, nil, -1)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	ret = ObjectInfo{
+		Key:      key,
+		Size:     resp.ContentLength,
+		ETag:     resp.Header.Get("ETag"),
+		Metadata: make(map[string]string),
+	}
+	ret.LastModified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	for k, vs := range resp.Header {
+		if strings.HasPrefix(k, metadataHeaderPrefix) && len(vs) != 0 {
+			ret.Metadata[strings.ToLower(k[len(metadataHeaderPrefix):])] = vs[0]
+		}
+	}
+	return
+}
+
+// Deleting an object that doesn't exist isn't an error.
+func (me *Client) DeleteObject(ctx context.Context, key string) error {
+	resp, err := me.do(ctx, http.MethodDelete, key, nil, nil, nil, -1)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+		ETag         string    `xml:"ETag"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// Lists the objects with the given key prefix. If delimiter is not empty, keys containing it after
+// the prefix are rolled up into commonPrefixes instead. Metadata isn't returned.
+func (me *Client) ListObjects(
+	ctx context.Context, prefix, delimiter string,
+) (objects []ObjectInfo, commonPrefixes []string, err error) {
+	token := ""
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"prefix":    {prefix},
+		}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		var res listBucketResult
+		err = me.doXml(ctx, http.MethodGet, "", query, nil, &res)
+		if err != nil {
+			return
+		}
+		for _, c := range res.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          c.Key,
+				Size:         c.Size,
+				LastModified: c.LastModified,
+				ETag:         c.ETag,
+			})
+		}
+		for _, cp := range res.CommonPrefixes {
+			commonPrefixes = append(commonPrefixes, cp.Prefix)
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			return
+		}
+		token = res.NextContinuationToken
+	}
+}
+
+// Sends a request with an optional XML body, and decodes an XML response into out if it's not nil.
+func (me *Client) doXml(ctx context.Context, method, key string, query url.Values, in, out any) error {
+	var (
+		body io.Reader
+		size int64 = -1
+	)
+	if in != nil {
+		b, err := xml.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+		size = int64(len(b))
+	}
+	resp, err := me.do(ctx, method, key, query, nil, body, size)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	// Some errors during CompleteMultipartUpload arrive with a 200 status.
+	var s3Err Error
+	if xml.Unmarshal(b, &s3Err) == nil && s3Err.Code != "" {
+		s3Err.StatusCode = resp.StatusCode
+		return &s3Err
+	}
+	return xml.Unmarshal(b, out)
+}
+
+// Starts a multipart upload, returning its upload ID.
+func (me *Client) CreateMultipartUpload(
+	ctx context.Context, key string, metadata map[string]string,
+) (uploadId string, err error) {
+	resp, err := me.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, metadataHeader(metadata), nil, -1)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	var res struct {
+		UploadId string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&res)
+	if err == nil && res.UploadId == "" {
+		err = errors.New("no upload id in response")
+	}
+	return res.UploadId, err
+}
+
+// A part that has been uploaded, for completing a multipart upload.
+type CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// Uploads a part of a multipart upload. Part numbers start at 1. All parts except the last must be
+// at least MinPartSize.
+func (me *Client) UploadPart(
+	ctx context.Context, key, uploadId string, partNumber int, r io.Reader, size int64,
+) (CompletedPart, error) {
+	query := url.Values{
+		"partNumber": {strconv.Itoa(partNumber)},
+		"uploadId":   {uploadId},
+	}
+	resp, err := me.do(ctx, http.MethodPut, key, query, nil, r, size)
+	if err != nil {
+		return CompletedPart{}, err
+	}
+	resp.Body.Close()
+	return CompletedPart{PartNumber: partNumber, ETag: resp.Header.Get("ETag")}, nil
+}
+
+func (me *Client) CompleteMultipartUpload(ctx context.Context, key, uploadId string, parts []CompletedPart) error {
+	type completeMultipartUpload struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []CompletedPart `xml:"Part"`
+	}
+	var res struct {
+		Key string `xml:"Key"`
+	}
+	return me.doXml(
+		ctx, http.MethodPost, key, url.Values{"uploadId": {uploadId}},
+		completeMultipartUpload{Parts: parts}, &res)
+}
+
+func (me *Client) AbortMultipartUpload(ctx context.Context, key, uploadId string) error {
+	resp, err := me.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadId}}, nil, nil, -1)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func metadataHeader(metadata map[string]string) http.Header {
+	h := make(http.Header, len(metadata))
+	for k, v := range metadata {
+		h.Set(metadataHeaderPrefix+k, v)
+	}
+	return h
+}
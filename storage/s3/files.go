@@ -0,0 +1,682 @@
+package s3Storage
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	g "github.com/anacrolix/generics"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/segments"
+	"github.com/anacrolix/torrent/storage"
+)
+
+const (
+	// The part size used for multipart uploads of completed files if NewFilesOpts.PartSize is zero.
+	DefaultPartSize = 16 << 20
+	// S3 requires all parts except the last to be at least this size.
+	MinPartSize = 5 << 20
+)
+
+// Object metadata keys.
+const (
+	// On completed piece objects, the hex piece hash the data was verified against.
+	pieceHashMetadataKey = "piece-hash"
+	// On completed file objects, the hex infohash of the torrent that completed them.
+	infohashMetadataKey = "infohash"
+)
+
+type NewFilesOpts struct {
+	Client *Client
+	// Prepended to object keys, for example "seeding/".
+	Prefix string
+	// Part size for multipart uploads of completed files. Files no larger than this are uploaded
+	// in a single request. Raised to MinPartSize if smaller.
+	PartSize int64
+}
+
+// Stores torrent files as whole objects at <Prefix><info name>/<file path>, the same layout a web
+// seed (BEP 19) serves. Chunks are stored as objects while their piece is incomplete, and
+// completed pieces are kept as objects until every file they overlap is complete. Completed files
+// are assembled from pieces with multipart uploads, streaming each piece object once. Completion is
+// stored as object metadata, so existing objects aren't trusted unless this storage wrote them.
+func NewFiles(opts NewFilesOpts) storage.ClientImpl {
+	if opts.PartSize == 0 {
+		opts.PartSize = DefaultPartSize
+	}
+	opts.PartSize = max(opts.PartSize, MinPartSize)
+	return &filesClient{opts}
+}
+
+type filesClient struct {
+	opts NewFilesOpts
+}
+
+func (me *filesClient) OpenTorrent(
+	ctx context.Context, info *metainfo.Info, infoHash metainfo.Hash,
+) (_ storage.TorrentImpl, err error) {
+	t := &filesTorrent{
+		c:            me.opts.Client,
+		opts:         me.opts,
+		info:         info,
+		infoHash:     infoHash,
+		files:        info.UpvertedFiles(),
+		segments:     info.FileSegmentsIndex(),
+		pieceLocks:   make([]sync.RWMutex, info.NumPieces()),
+		pieceHashes:  make([]g.Option[[]byte], info.NumPieces()),
+		pieceObjects: make([]g.Option[bool], info.NumPieces()),
+	}
+	t.fileKeys = make([]string, len(t.files))
+	t.fileComplete = make([]g.Option[bool], len(t.files))
+	t.fileLocks = make([]sync.Mutex, len(t.files))
+	for i, fi := range t.files {
+		t.fileKeys[i], err = me.fileKey(info, &fi)
+		if err != nil {
+			err = fmt.Errorf("file %v: %w", i, err)
+			return
+		}
+		if fi.Length == 0 {
+			err = t.assembleFile(ctx, i)
+			if err != nil {
+				err = fmt.Errorf("creating zero length file: %w", err)
+				return
+			}
+		}
+	}
+	return storage.TorrentImpl{
+		PieceWithHash: t.piece,
+		Close:         func() error { return nil },
+	}, nil
+}
+
+func (me *filesClient) fileKey(info *metainfo.Info, fi *metainfo.FileInfo) (string, error) {
+	comps := []string{info.BestName()}
+	if info.IsDir() {
+		comps = append(comps, fi.BestPath()...)
+	}
+	for _, c := range comps {
+		switch c {
+		case "", ".", "..":
+			return "", fmt.Errorf("bad path component %q", c)
+		}
+		if strings.Contains(c, "/") {
+			return "", fmt.Errorf("path component %q contains separator", c)
+		}
+	}
+	return me.opts.Prefix + path.Join(comps...), nil
+}
+
+type filesTorrent struct {
+	c        *Client
+	opts     NewFilesOpts
+	info     *metainfo.Info
+	infoHash metainfo.Hash
+	files    []metainfo.FileInfo
+	fileKeys []string
+	segments segments.Index
+	// Orders marking a piece complete or not with reading and writing it.
+	pieceLocks []sync.RWMutex
+
+	// Serializes assembling each file.
+	fileLocks []sync.Mutex
+	mu        sync.Mutex
+	// Cached completion of file objects.
+	fileComplete []g.Option[bool]
+	// Piece hashes given by the client, for recreating piece objects of other pieces.
+	pieceHashes []g.Option[[]byte]
+	// Cached existence of verified piece objects, so completing each piece doesn't look up every
+	// other piece of its files.
+	pieceObjects []g.Option[bool]
+}
+
+func (me *filesTorrent) piece(p metainfo.Piece, pieceHash g.Option[[]byte]) storage.PieceImpl {
+	if pieceHash.Ok {
+		me.mu.Lock()
+		me.pieceHashes[p.Index()] = pieceHash
+		me.mu.Unlock()
+	}
+	return filesPiece{
+		t:         me,
+		p:         p,
+		pieceHash: pieceHash,
+		mu:        &me.pieceLocks[p.Index()],
+	}
+}
+
+func (me *filesTorrent) ihHex() string {
+	return me.infoHash.HexString()
+}
+
+func (me *filesTorrent) incompleteDir(index int) string {
+	return me.opts.Prefix + path.Join(".incomplete", me.ihHex(), strconv.Itoa(index)) + "/"
+}
+
+func (me *filesTorrent) pieceKey(index int) string {
+	return me.opts.Prefix + path.Join(".pieces", me.ihHex(), strconv.Itoa(index))
+}
+
+// Indexes of files overlapping the piece.
+func (me *filesTorrent) pieceFiles(p metainfo.Piece) (ret []int) {
+	for i := range me.segments.LocateIter(segments.Extent{Start: p.Offset(), Length: p.Length()}) {
+		ret = append(ret, i)
+	}
+	return
+}
+
+// Whether the file object exists, and was completed by this torrent.
+func (me *filesTorrent) isFileComplete(ctx context.Context, i int) (bool, error) {
+	me.mu.Lock()
+	cached := me.fileComplete[i]
+	me.mu.Unlock()
+	if cached.Ok {
+		return cached.Value, nil
+	}
+	oi, err := me.c.HeadObject(ctx, me.fileKeys[i])
+	complete := err == nil &&
+		oi.Size == me.files[i].Length &&
+		oi.Metadata[infohashMetadataKey] == me.ihHex()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	me.setFileComplete(i, complete)
+	return complete, nil
+}
+
+func (me *filesTorrent) setFileComplete(i int, complete bool) {
+	me.mu.Lock()
+	me.fileComplete[i] = g.Some(complete)
+	me.mu.Unlock()
+}
+
+func (me *filesTorrent) allFilesComplete(ctx context.Context, files []int) (bool, error) {
+	for _, i := range files {
+		complete, err := me.isFileComplete(ctx, i)
+		if err != nil || !complete {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Whether the piece has a completed object, verified against pieceHash.
+func (me *filesTorrent) hasPieceObject(ctx context.Context, p metainfo.Piece, pieceHash []byte) (bool, error) {
+	me.mu.Lock()
+	cached := me.pieceObjects[p.Index()]
+	me.mu.Unlock()
+	if cached.Ok {
+		return cached.Value, nil
+	}
+	oi, err := me.c.HeadObject(ctx, me.pieceKey(p.Index()))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	ok := err == nil &&
+		oi.Size == p.Length() &&
+		oi.Metadata[pieceHashMetadataKey] == hex.EncodeToString(pieceHash)
+	me.setPieceObject(p.Index(), ok)
+	return ok, nil
+}
+
+func (me *filesTorrent) setPieceObject(index int, ok bool) {
+	me.mu.Lock()
+	me.pieceObjects[index] = g.Some(ok)
+	me.mu.Unlock()
+}
+
+// The hash given by the client for the piece, or its v1 hash.
+func (me *filesTorrent) pieceHash(p metainfo.Piece) (ret g.Option[[]byte]) {
+	me.mu.Lock()
+	ret = me.pieceHashes[p.Index()]
+	me.mu.Unlock()
+	if !ret.Ok {
+		if v1Hash := p.V1Hash(); v1Hash.Ok {
+			ret = g.Some(v1Hash.Value.Bytes())
+		}
+	}
+	return
+}
+
+// Assembles the file from completed piece objects if they're all present, then deletes piece
+// objects that are no longer needed.
+func (me *filesTorrent) maybeAssembleFile(ctx context.Context, fileIndex int) error {
+	fi := &me.files[fileIndex]
+	for i := fi.BeginPieceIndex(me.info.PieceLength); i < fi.EndPieceIndex(me.info.PieceLength); i++ {
+		p := me.info.Piece(i)
+		pieceHash := me.pieceHash(p)
+		if !pieceHash.Ok {
+			return nil
+		}
+		ok, err := me.hasPieceObject(ctx, p, pieceHash.Value)
+		if err != nil || !ok {
+			return err
+		}
+	}
+	err := me.assembleFile(ctx, fileIndex)
+	if err != nil {
+		return err
+	}
+	return me.deleteRedundantPieceObjects(ctx, fileIndex)
+}
+
+func (me *filesTorrent) assembleFile(ctx context.Context, fileIndex int) error {
+	me.fileLocks[fileIndex].Lock()
+	defer me.fileLocks[fileIndex].Unlock()
+	complete, err := me.isFileComplete(ctx, fileIndex)
+	if err != nil || complete {
+		return err
+	}
+	fi := &me.files[fileIndex]
+	key := me.fileKeys[fileIndex]
+	metadata := map[string]string{infohashMetadataKey: me.ihHex()}
+	if fi.Length <= me.opts.PartSize {
+		r := me.newPieceObjectsReader(ctx, fi.TorrentOffset, fi.Length)
+		err = me.c.PutObject(ctx, key, r, fi.Length, metadata)
+		r.Close()
+	} else {
+		err = me.multipartUpload(ctx, key, fi.TorrentOffset, fi.Length, metadata)
+	}
+	if err != nil {
+		return fmt.Errorf("uploading %q: %w", key, err)
+	}
+	me.setFileComplete(fileIndex, true)
+	return nil
+}
+
+// Uploads the torrent data at [off, off+length) from piece objects.
+func (me *filesTorrent) multipartUpload(
+	ctx context.Context, key string, off, length int64, metadata map[string]string,
+) (err error) {
+	uploadId, err := me.c.CreateMultipartUpload(ctx, key, metadata)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			me.c.AbortMultipartUpload(context.WithoutCancel(ctx), key, uploadId)
+		}
+	}()
+	var parts []CompletedPart
+	for partOff := int64(0); partOff < length; partOff += me.opts.PartSize {
+		size := min(me.opts.PartSize, length-partOff)
+		r := me.newPieceObjectsReader(ctx, off+partOff, size)
+		var part CompletedPart
+		part, err = me.c.UploadPart(ctx, key, uploadId, len(parts)+1, r, size)
+		r.Close()
+		if err != nil {
+			return
+		}
+		parts = append(parts, part)
+	}
+	return me.c.CompleteMultipartUpload(ctx, key, uploadId, parts)
+}
+
+// Deletes piece objects for the file's pieces that only overlap completed files.
+func (me *filesTorrent) deleteRedundantPieceObjects(ctx context.Context, fileIndex int) error {
+	fi := &me.files[fileIndex]
+	var errs []error
+	for i := fi.BeginPieceIndex(me.info.PieceLength); i < fi.EndPieceIndex(me.info.PieceLength); i++ {
+		complete, err := me.allFilesComplete(ctx, me.pieceFiles(me.info.Piece(i)))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if complete {
+			err = me.c.DeleteObject(ctx, me.pieceKey(i))
+			if err == nil {
+				me.setPieceObject(i, false)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Streams torrent data from completed piece objects, with a request per piece.
+type pieceObjectsReader struct {
+	ctx context.Context
+	t   *filesTorrent
+	// The next offset to read, and where to stop.
+	off, end int64
+	// The current piece object, and where its part of the data ends.
+	cur    io.ReadCloser
+	curEnd int64
+}
+
+func (me *filesTorrent) newPieceObjectsReader(ctx context.Context, off, length int64) *pieceObjectsReader {
+	return &pieceObjectsReader{ctx: ctx, t: me, off: off, end: off + length}
+}
+
+func (me *pieceObjectsReader) Read(b []byte) (n int, err error) {
+	for {
+		if me.cur == nil {
+			if me.off >= me.end {
+				return 0, io.EOF
+			}
+			pieceLength := me.t.info.PieceLength
+			pieceOff := me.off % pieceLength
+			length := min(me.end-me.off, pieceLength-pieceOff)
+			me.cur, err = me.t.c.GetObject(me.ctx, me.t.pieceKey(int(me.off/pieceLength)), pieceOff, length)
+			if err != nil {
+				return
+			}
+			me.curEnd = me.off + length
+		}
+		n, err = me.cur.Read(b)
+		me.off += int64(n)
+		if err != io.EOF {
+			return
+		}
+		me.cur.Close()
+		me.cur = nil
+		if me.off < me.curEnd {
+			return n, io.ErrUnexpectedEOF
+		}
+		if n != 0 {
+			return n, nil
+		}
+	}
+}
+
+func (me *pieceObjectsReader) Close() error {
+	if me.cur == nil {
+		return nil
+	}
+	return me.cur.Close()
+}
+
+type filesPiece struct {
+	t         *filesTorrent
+	p         metainfo.Piece
+	pieceHash g.Option[[]byte]
+	mu        *sync.RWMutex
+}
+
+var _ interface {
+	storage.PieceImpl
+	storage.PieceReaderer
+} = filesPiece{}
+
+func (me filesPiece) WriteAt(b []byte, off int64) (n int, err error) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	key := me.t.incompleteDir(me.p.Index()) + strconv.FormatInt(off, 10)
+	err = me.t.c.PutObject(context.Background(), key, bytes.NewReader(b), int64(len(b)), nil)
+	if err == nil {
+		n = len(b)
+	}
+	return
+}
+
+func (me filesPiece) ReadAt(b []byte, off int64) (n int, err error) {
+	r, err := me.NewReader()
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	return r.ReadAt(b, off)
+}
+
+func (me filesPiece) Completion() storage.Completion {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	complete, err := me.complete(context.Background())
+	if err != nil {
+		return storage.Completion{Err: err}
+	}
+	return storage.Completion{Complete: complete, Ok: true}
+}
+
+func (me filesPiece) complete(ctx context.Context) (bool, error) {
+	if !me.pieceHash.Ok {
+		return false, nil
+	}
+	complete, err := me.t.hasPieceObject(ctx, me.p, me.pieceHash.Value)
+	if err != nil || complete {
+		return complete, err
+	}
+	return me.t.allFilesComplete(ctx, me.t.pieceFiles(me.p))
+}
+
+func (me filesPiece) MarkComplete() error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	ctx := context.Background()
+	incompleteDir := me.t.incompleteDir(me.p.Index())
+	chunks, err := me.t.listChunks(ctx, incompleteDir)
+	if err != nil {
+		return fmt.Errorf("listing chunks: %w", err)
+	}
+	err = me.t.c.PutObject(
+		ctx,
+		me.t.pieceKey(me.p.Index()),
+		io.NewSectionReader(chunks, 0, me.p.Length()),
+		me.p.Length(),
+		map[string]string{pieceHashMetadataKey: hex.EncodeToString(me.pieceHash.UnwrapOr(nil))},
+	)
+	if err != nil {
+		return fmt.Errorf("putting piece object: %w", err)
+	}
+	me.t.setPieceObject(me.p.Index(), me.pieceHash.Ok)
+	var errs []error
+	for _, c := range chunks.chunks {
+		errs = append(errs, me.t.c.DeleteObject(ctx, c.key))
+	}
+	for _, fileIndex := range me.t.pieceFiles(me.p) {
+		err = me.t.maybeAssembleFile(ctx, fileIndex)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("assembling file %v: %w", fileIndex, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Completed files containing the piece are deleted, since they can't be partially rewritten. The
+// file's other pieces are first copied back into piece objects, so they remain complete.
+func (me filesPiece) MarkNotComplete() error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	ctx := context.Background()
+	errs := []error{me.t.c.DeleteObject(ctx, me.t.pieceKey(me.p.Index()))}
+	me.t.setPieceObject(me.p.Index(), false)
+	for _, i := range me.t.pieceFiles(me.p) {
+		if me.t.files[i].Length == 0 {
+			continue
+		}
+		err := me.t.disassembleFile(ctx, i, me.p.Index())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("disassembling file %v: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Deletes a completed file object, after recreating piece objects for its pieces other than
+// exceptPiece from it.
+func (me *filesTorrent) disassembleFile(ctx context.Context, fileIndex, exceptPiece int) error {
+	me.fileLocks[fileIndex].Lock()
+	defer me.fileLocks[fileIndex].Unlock()
+	complete, err := me.isFileComplete(ctx, fileIndex)
+	if err != nil || !complete {
+		return err
+	}
+	fi := &me.files[fileIndex]
+	for i := fi.BeginPieceIndex(me.info.PieceLength); i < fi.EndPieceIndex(me.info.PieceLength); i++ {
+		if i == exceptPiece {
+			continue
+		}
+		err = me.putPieceObjectFromFiles(ctx, me.info.Piece(i))
+		if err != nil {
+			return fmt.Errorf("piece %v: %w", i, err)
+		}
+	}
+	err = me.c.DeleteObject(ctx, me.fileKeys[fileIndex])
+	if err != nil {
+		return err
+	}
+	me.setFileComplete(fileIndex, false)
+	return nil
+}
+
+// Puts a piece object for a piece read from the completed files it overlaps, if there isn't one
+// already.
+func (me *filesTorrent) putPieceObjectFromFiles(ctx context.Context, p metainfo.Piece) error {
+	pieceHash := me.pieceHash(p)
+	if !pieceHash.Ok {
+		return errors.New("piece hash unknown")
+	}
+	ok, err := me.hasPieceObject(ctx, p, pieceHash.Value)
+	if err != nil || ok {
+		return err
+	}
+	err = me.c.PutObject(
+		ctx,
+		me.pieceKey(p.Index()),
+		io.NewSectionReader(filesPieceReader{ctx, me, p}, 0, p.Length()),
+		p.Length(),
+		map[string]string{pieceHashMetadataKey: hex.EncodeToString(pieceHash.Value)},
+	)
+	if err == nil {
+		me.setPieceObject(p.Index(), true)
+	}
+	return err
+}
+
+func (me filesPiece) NewReader() (storage.PieceReader, error) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	ctx := context.Background()
+	if me.pieceHash.Ok {
+		ok, err := me.t.hasPieceObject(ctx, me.p, me.pieceHash.Value)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return objectPieceReader{ctx, me.t.c, me.t.pieceKey(me.p.Index())}, nil
+		}
+		ok, err = me.t.allFilesComplete(ctx, me.t.pieceFiles(me.p))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return filesPieceReader{ctx, me.t, me.p}, nil
+		}
+	}
+	return me.t.listChunks(ctx, me.t.incompleteDir(me.p.Index()))
+}
+
+type objectPieceReader struct {
+	ctx context.Context
+	c   *Client
+	key string
+}
+
+func (me objectPieceReader) ReadAt(b []byte, off int64) (int, error) {
+	return readObjectAt(me.ctx, me.c, me.key, b, off)
+}
+
+func (objectPieceReader) Close() error {
+	return nil
+}
+
+// Reads a piece from the completed file objects it overlaps.
+type filesPieceReader struct {
+	ctx context.Context
+	t   *filesTorrent
+	p   metainfo.Piece
+}
+
+func (me filesPieceReader) ReadAt(b []byte, off int64) (n int, err error) {
+	if off >= me.p.Length() {
+		return 0, io.EOF
+	}
+	want := min(int64(len(b)), me.p.Length()-off)
+	for i, e := range me.t.segments.LocateIter(segments.Extent{Start: me.p.Offset() + off, Length: want}) {
+		var n1 int
+		n1, err = readObjectAt(me.ctx, me.t.c, me.t.fileKeys[i], b[n:n+int(e.Length)], e.Start)
+		n += n1
+		if err != nil {
+			return
+		}
+	}
+	if n < len(b) {
+		err = io.EOF
+	}
+	return
+}
+
+func (filesPieceReader) Close() error {
+	return nil
+}
+
+type chunkObject struct {
+	key    string
+	offset int64
+	size   int64
+}
+
+// Incomplete chunk objects for a piece, sorted by offset.
+type chunkObjects struct {
+	ctx    context.Context
+	c      *Client
+	chunks []chunkObject
+}
+
+func (me *filesTorrent) listChunks(ctx context.Context, dir string) (ret chunkObjects, err error) {
+	ret = chunkObjects{ctx: ctx, c: me.c}
+	objects, _, err := me.c.ListObjects(ctx, dir, "/")
+	if err != nil {
+		return
+	}
+	for _, o := range objects {
+		offset, parseErr := strconv.ParseInt(strings.TrimPrefix(o.Key, dir), 10, 64)
+		if parseErr != nil {
+			continue
+		}
+		ret.chunks = append(ret.chunks, chunkObject{o.Key, offset, o.Size})
+	}
+	slices.SortFunc(ret.chunks, func(a, b chunkObject) int {
+		return cmp.Compare(a.offset, b.offset)
+	})
+	return
+}
+
+func (me chunkObjects) ReadAt(b []byte, off int64) (n int, err error) {
+	for len(b) != 0 {
+		i := sort.Search(len(me.chunks), func(i int) bool {
+			return me.chunks[i].offset+me.chunks[i].size > off
+		})
+		if i == len(me.chunks) || me.chunks[i].offset > off {
+			if n == 0 {
+				return n, io.EOF
+			}
+			return n, io.ErrUnexpectedEOF
+		}
+		c := me.chunks[i]
+		readLen := min(int64(len(b)), c.offset+c.size-off)
+		var n1 int
+		n1, err = readObjectAt(me.ctx, me.c, c.key, b[:readLen], off-c.offset)
+		n += n1
+		off += int64(n1)
+		b = b[n1:]
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (chunkObjects) Close() error {
+	return nil
+}
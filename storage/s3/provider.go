@@ -0,0 +1,164 @@
+package s3Storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/missinggo/v2/resource"
+
+	"github.com/anacrolix/torrent/storage"
+)
+
+// A resource.Provider storing each resource as an object. Use it with storage.NewResourcePieces
+// to store incomplete chunks and completed pieces as separate objects, keyed by piece hash.
+type Provider struct {
+	Client *Client
+	// Prepended to resource paths to form object keys, for example "torrents/".
+	Prefix string
+}
+
+var _ interface {
+	storage.PieceProvider
+	storage.PrefixDeleter
+} = Provider{}
+
+func (me Provider) NewInstance(p string) (resource.Instance, error) {
+	return instance{me.Client, me.Prefix + p}, nil
+}
+
+// Deletes all objects with keys starting with prefix.
+func (me Provider) DeletePrefix(prefix string) error {
+	return deletePrefix(context.Background(), me.Client, me.Prefix+prefix)
+}
+
+func deletePrefix(ctx context.Context, c *Client, prefix string) error {
+	objects, _, err := c.ListObjects(ctx, prefix, "")
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, o := range objects {
+		errs = append(errs, c.DeleteObject(ctx, o.Key))
+	}
+	return errors.Join(errs...)
+}
+
+// A single object.
+type instance struct {
+	c   *Client
+	key string
+}
+
+var _ interface {
+	resource.Instance
+	resource.DirInstance
+	storage.SizedPutter
+} = instance{}
+
+func (me instance) Get() (io.ReadCloser, error) {
+	return me.c.GetObject(context.Background(), me.key, 0, -1)
+}
+
+// Objects need their size up front, so this buffers r. Prefer PutSized.
+func (me instance) Put(r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return me.PutSized(bytes.NewReader(b), int64(len(b)))
+}
+
+func (me instance) PutSized(r io.Reader, size int64) error {
+	return me.c.PutObject(context.Background(), me.key, r, size, nil)
+}
+
+func (me instance) Stat() (os.FileInfo, error) {
+	oi, err := me.c.HeadObject(context.Background(), me.key)
+	if err != nil {
+		return nil, err
+	}
+	return objectFileInfo{oi}, nil
+}
+
+func (me instance) ReadAt(b []byte, off int64) (int, error) {
+	return readObjectAt(context.Background(), me.c, me.key, b, off)
+}
+
+// Objects can't be partially written.
+func (me instance) WriteAt(b []byte, off int64) (int, error) {
+	return 0, errors.ErrUnsupported
+}
+
+func (me instance) Delete() error {
+	return me.c.DeleteObject(context.Background(), me.key)
+}
+
+// Treats the key as a directory, returning the names of objects and "subdirectories" under it.
+func (me instance) Readdirnames() (names []string, err error) {
+	prefix := me.key + "/"
+	objects, commonPrefixes, err := me.c.ListObjects(context.Background(), prefix, "/")
+	if err != nil {
+		return
+	}
+	for _, o := range objects {
+		names = append(names, strings.TrimPrefix(o.Key, prefix))
+	}
+	for _, cp := range commonPrefixes {
+		names = append(names, strings.TrimSuffix(strings.TrimPrefix(cp, prefix), "/"))
+	}
+	if len(names) == 0 {
+		err = fs.ErrNotExist
+	}
+	return
+}
+
+// Reads with a ranged GET, following the io.ReaderAt contract.
+func readObjectAt(ctx context.Context, c *Client, key string, b []byte, off int64) (n int, err error) {
+	r, err := c.GetObject(ctx, key, off, int64(len(b)))
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	n, err = io.ReadFull(r, b)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return
+}
+
+type objectFileInfo struct {
+	oi ObjectInfo
+}
+
+var _ os.FileInfo = objectFileInfo{}
+
+func (me objectFileInfo) Name() string {
+	return path.Base(me.oi.Key)
+}
+
+func (me objectFileInfo) Size() int64 {
+	return me.oi.Size
+}
+
+func (me objectFileInfo) Mode() fs.FileMode {
+	return 0o444
+}
+
+func (me objectFileInfo) ModTime() time.Time {
+	return me.oi.LastModified
+}
+
+func (me objectFileInfo) IsDir() bool {
+	return false
+}
+
+func (me objectFileInfo) Sys() any {
+	return me.oi
+}
@@ -0,0 +1,197 @@
+package s3Storage_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	s3Storage "github.com/anacrolix/torrent/storage/s3"
+	"github.com/anacrolix/torrent/storage/s3/s3test"
+	test_storage "github.com/anacrolix/torrent/storage/test"
+)
+
+const chunkSize = 1 << 14
+
+func writePiece(t *testing.T, p storage.Piece, data []byte) {
+	for off := 0; off < len(data); off += chunkSize {
+		n, err := p.WriteAt(data[off:min(off+chunkSize, len(data))], int64(off))
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.Equals(n, min(chunkSize, len(data)-off)))
+	}
+}
+
+func readPiece(t *testing.T, p storage.Piece, length int64) []byte {
+	var buf bytes.Buffer
+	_, err := io.Copy(&buf, io.NewSectionReader(p, 0, length))
+	qt.Assert(t, qt.IsNil(err))
+	return buf.Bytes()
+}
+
+func TestResourcePieces(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	ci := storage.NewResourcePieces(s3Storage.Provider{
+		Client: srv.Client("bucket"),
+		Prefix: "pieces/",
+	})
+	info := &metainfo.Info{
+		Name:        "a",
+		Length:      3 << 14,
+		PieceLength: 2 << 14,
+		Pieces:      make([]byte, 2*metainfo.HashSize),
+	}
+	rand.Read(info.Pieces)
+	ts, err := storage.NewClient(ci).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	data := make([]byte, info.Length)
+	rand.Read(data)
+	for i := range info.NumPieces() {
+		mp := info.Piece(i)
+		p := ts.Piece(mp)
+		pieceData := data[mp.Offset() : mp.Offset()+mp.Length()]
+		writePiece(t, p, pieceData)
+		qt.Check(t, qt.Equals(p.Completion(), storage.Completion{Complete: false, Ok: true}))
+		qt.Check(t, qt.IsTrue(bytes.Equal(readPiece(t, p, mp.Length()), pieceData)))
+		qt.Assert(t, qt.IsNil(p.MarkComplete()))
+		qt.Check(t, qt.Equals(p.Completion(), storage.Completion{Complete: true, Ok: true}))
+		qt.Check(t, qt.IsTrue(bytes.Equal(readPiece(t, p, mp.Length()), pieceData)))
+	}
+	// Incomplete chunks are cleaned up after completion.
+	for _, key := range srv.Keys("bucket") {
+		qt.Check(t, qt.StringContains(key, "pieces/completed/"))
+	}
+}
+
+func BenchmarkResourcePieces(b *testing.B) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	ci := storage.NewResourcePieces(s3Storage.Provider{Client: srv.Client("bucket")})
+	test_storage.BenchmarkPieceMarkComplete(b, ci, 1<<20, 4, 0)
+}
+
+func TestFiles(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	newStorage := func() storage.ClientImpl {
+		return s3Storage.NewFiles(s3Storage.NewFilesOpts{
+			Client: srv.Client("bucket"),
+			Prefix: "seed/",
+			// Anything smaller is raised to the minimum.
+			PartSize: 1,
+		})
+	}
+	info := &metainfo.Info{
+		Name:        "dir",
+		PieceLength: 1 << 20,
+		Files: []metainfo.FileInfo{
+			// Large enough to need a multipart upload.
+			{Path: []string{"big"}, Length: s3Storage.MinPartSize + 12345},
+			{Path: []string{"empty"}, Length: 0},
+			{Path: []string{"sub", "small"}, Length: 1000},
+		},
+	}
+	numPieces := (info.TotalLength() + info.PieceLength - 1) / info.PieceLength
+	info.Pieces = make([]byte, numPieces*metainfo.HashSize)
+	rand.Read(info.Pieces)
+	infoHash := metainfo.HashBytes([]byte("files"))
+	data := make([]byte, info.TotalLength())
+	rand.Read(data)
+
+	ts, err := storage.NewClient(newStorage()).OpenTorrent(context.Background(), info, infoHash)
+	qt.Assert(t, qt.IsNil(err))
+	for i := range info.NumPieces() {
+		mp := info.Piece(i)
+		p := ts.Piece(mp)
+		pieceData := data[mp.Offset() : mp.Offset()+mp.Length()]
+		qt.Check(t, qt.Equals(p.Completion(), storage.Completion{Complete: false, Ok: true}))
+		writePiece(t, p, pieceData)
+		qt.Check(t, qt.IsTrue(bytes.Equal(readPiece(t, p, mp.Length()), pieceData)))
+		qt.Assert(t, qt.IsNil(p.MarkComplete()))
+		qt.Check(t, qt.Equals(p.Completion(), storage.Completion{Complete: true, Ok: true}))
+		qt.Check(t, qt.IsTrue(bytes.Equal(readPiece(t, p, mp.Length()), pieceData)))
+	}
+	// Only the files remain, laid out for a web seed.
+	qt.Assert(t, qt.DeepEquals(srv.Keys("bucket"), []string{"seed/dir/big", "seed/dir/empty", "seed/dir/sub/small"}))
+	var off int64
+	for _, fi := range info.Files {
+		b, md, ok := srv.Object("bucket", "seed/dir/"+fi.DisplayPath(info))
+		qt.Assert(t, qt.IsTrue(ok))
+		qt.Check(t, qt.IsTrue(bytes.Equal(b, data[off:off+fi.Length])))
+		qt.Check(t, qt.Equals(md["infohash"], infoHash.HexString()))
+		off += fi.Length
+	}
+
+	// Completion and data survive reopening.
+	ts, err = storage.NewClient(newStorage()).OpenTorrent(context.Background(), info, infoHash)
+	qt.Assert(t, qt.IsNil(err))
+	for i := range info.NumPieces() {
+		mp := info.Piece(i)
+		p := ts.Piece(mp)
+		qt.Check(t, qt.Equals(p.Completion(), storage.Completion{Complete: true, Ok: true}))
+		qt.Check(t, qt.IsTrue(bytes.Equal(readPiece(t, p, mp.Length()), data[mp.Offset():mp.Offset()+mp.Length()])))
+	}
+
+	// Objects completed by another torrent aren't trusted.
+	other, err := storage.NewClient(newStorage()).OpenTorrent(context.Background(), info, metainfo.HashBytes([]byte("other")))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(other.Piece(info.Piece(0)).Completion(), storage.Completion{Complete: false, Ok: true}))
+
+	// Failing a piece removes the files it overlaps, but their other pieces are kept.
+	firstPiece := ts.Piece(info.Piece(0))
+	qt.Assert(t, qt.IsNil(firstPiece.MarkNotComplete()))
+	qt.Check(t, qt.Equals(firstPiece.Completion(), storage.Completion{Complete: false, Ok: true}))
+	var wantKeys []string
+	for i := 1; i < info.NumPieces(); i++ {
+		wantKeys = append(wantKeys, fmt.Sprintf("seed/.pieces/%v/%v", infoHash.HexString(), i))
+	}
+	wantKeys = append(wantKeys, "seed/dir/empty", "seed/dir/sub/small")
+	qt.Check(t, qt.DeepEquals(srv.Keys("bucket"), wantKeys))
+	for i := 1; i < info.NumPieces(); i++ {
+		mp := info.Piece(i)
+		p := ts.Piece(mp)
+		qt.Check(t, qt.Equals(p.Completion(), storage.Completion{Complete: true, Ok: true}))
+		qt.Check(t, qt.IsTrue(bytes.Equal(readPiece(t, p, mp.Length()), data[mp.Offset():mp.Offset()+mp.Length()])))
+	}
+}
+
+// Completing each piece doesn't look up every other piece of the file, and assembling the file
+// reads each piece object once.
+func TestFilesRequestsPerPiece(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	const numPieces = 32
+	info := &metainfo.Info{
+		Name:        "a",
+		Length:      numPieces * chunkSize,
+		PieceLength: chunkSize,
+		Pieces:      make([]byte, numPieces*metainfo.HashSize),
+	}
+	rand.Read(info.Pieces)
+	ts, err := storage.NewClient(s3Storage.NewFiles(s3Storage.NewFilesOpts{
+		Client: srv.Client("bucket"),
+	})).OpenTorrent(context.Background(), info, metainfo.HashBytes([]byte("a")))
+	qt.Assert(t, qt.IsNil(err))
+	data := make([]byte, info.Length)
+	rand.Read(data)
+	for i := range numPieces {
+		writePiece(t, ts.Piece(info.Piece(i)), data[i*chunkSize:(i+1)*chunkSize])
+	}
+	heads, gets := srv.Requests(http.MethodHead), srv.Requests(http.MethodGet)
+	for i := range numPieces {
+		qt.Assert(t, qt.IsNil(ts.Piece(info.Piece(i)).MarkComplete()))
+	}
+	qt.Check(t, qt.IsTrue(srv.Requests(http.MethodHead)-heads <= 2*numPieces))
+	// Listing each piece's chunks, reading them, and reading the piece objects for the file.
+	qt.Check(t, qt.Equals(srv.Requests(http.MethodGet)-gets, 3*numPieces))
+	b, _, ok := srv.Object("bucket", "a")
+	qt.Assert(t, qt.IsTrue(ok))
+	qt.Check(t, qt.IsTrue(bytes.Equal(b, data)))
+}
@@ -0,0 +1,316 @@
+// Package s3test provides an in-process stand-in for an S3-compatible service, for testing S3
+// storage without network access or credentials.
+package s3test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	s3Storage "github.com/anacrolix/torrent/storage/s3"
+)
+
+// Serves the subset of the S3 API used by s3Storage.Client from memory, with path-style
+// addressing. Buckets are created on first use. Requests must be signed, but signatures aren't
+// verified.
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	objects map[string]*object
+	uploads map[string]*upload
+	nextId  int
+	// Requests served, by method.
+	requests map[string]int
+}
+
+type object struct {
+	data     []byte
+	metadata http.Header
+	modified time.Time
+}
+
+type upload struct {
+	key      string
+	metadata http.Header
+	parts    map[int][]byte
+}
+
+func NewServer() *Server {
+	s := &Server{
+		objects:  make(map[string]*object),
+		uploads:  make(map[string]*upload),
+		requests: make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHttp))
+	return s
+}
+
+// Returns a Client for the bucket on this server.
+func (s *Server) Client(bucket string) *s3Storage.Client {
+	return &s3Storage.Client{
+		Endpoint: s.URL,
+		Bucket:   bucket,
+		Credentials: s3Storage.Credentials{
+			AccessKeyId:     "test",
+			SecretAccessKey: "test",
+		},
+		HttpClient: s.Server.Client(),
+	}
+}
+
+// Returns a copy of an object's data and metadata.
+func (s *Server) Object(bucket, key string) (data []byte, metadata map[string]string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[bucket+"/"+key]
+	if !ok {
+		return
+	}
+	metadata = make(map[string]string)
+	for k := range o.metadata {
+		metadata[strings.ToLower(strings.TrimPrefix(k, "X-Amz-Meta-"))] = o.metadata.Get(k)
+	}
+	return bytes.Clone(o.data), metadata, true
+}
+
+// Returns how many requests with the method have been served.
+func (s *Server) Requests(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[method]
+}
+
+// Returns the sorted keys of objects in the bucket.
+func (s *Server) Keys(bucket string) (ret []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k := range s.objects {
+		if key, ok := strings.CutPrefix(k, bucket+"/"); ok {
+			ret = append(ret, key)
+		}
+	}
+	slices.Sort(ret)
+	return
+}
+
+type errorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(errorResponse{Code: code, Message: msg})
+}
+
+func writeXml(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) serveHttp(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		writeError(w, http.StatusForbidden, "AccessDenied", "request not signed")
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	q := r.URL.Query()
+	// Read the body before locking, since clients may stream it from other objects.
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[r.Method]++
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		s.list(w, bucket, q.Get("prefix"), q.Get("delimiter"), q.Get("continuation-token"))
+	case key == "":
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "bucket operation")
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		s.nextId++
+		id := strconv.Itoa(s.nextId)
+		s.uploads[id] = &upload{
+			key:      bucket + "/" + key,
+			metadata: metadataHeader(r.Header),
+			parts:    make(map[int][]byte),
+		}
+		writeXml(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: bucket, Key: key, UploadId: id})
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		u, ok := s.uploads[q.Get("uploadId")]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchUpload", "")
+			return
+		}
+		partNumber, err := strconv.Atoi(q.Get("partNumber"))
+		if err != nil || partNumber < 1 {
+			writeError(w, http.StatusBadRequest, "InvalidArgument", "bad part number")
+			return
+		}
+		u.parts[partNumber] = body
+		w.Header().Set("ETag", etag(body))
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		s.completeUpload(w, body, q.Get("uploadId"))
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		delete(s.uploads, q.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		s.objects[bucket+"/"+key] = &object{
+			data:     body,
+			metadata: metadataHeader(r.Header),
+			modified: time.Now(),
+		}
+		w.Header().Set("ETag", etag(body))
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		o, ok := s.objects[bucket+"/"+key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		for k, vs := range o.metadata {
+			w.Header()[k] = vs
+		}
+		w.Header().Set("ETag", etag(o.data))
+		// ServeContent handles ranges and HEAD.
+		http.ServeContent(w, r, "", o.modified, bytes.NewReader(o.data))
+	case r.Method == http.MethodDelete:
+		delete(s.objects, bucket+"/"+key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", r.Method)
+	}
+}
+
+func (s *Server) completeUpload(w http.ResponseWriter, body []byte, id string) {
+	u, ok := s.uploads[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "")
+		return
+	}
+	var req struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	err := xml.Unmarshal(body, &req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+	var data []byte
+	for i, p := range req.Parts {
+		b, ok := u.parts[p.PartNumber]
+		if !ok || p.ETag != etag(b) {
+			writeError(w, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("part %v", p.PartNumber))
+			return
+		}
+		if i != len(req.Parts)-1 && len(b) < s3Storage.MinPartSize {
+			writeError(w, http.StatusBadRequest, "EntityTooSmall", fmt.Sprintf("part %v", p.PartNumber))
+			return
+		}
+		data = append(data, b...)
+	}
+	s.objects[u.key] = &object{
+		data:     data,
+		metadata: u.metadata,
+		modified: time.Now(),
+	}
+	delete(s.uploads, id)
+	writeXml(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Key     string
+	}{Key: u.key})
+}
+
+// Only returns a single page, unless there's a continuation token, which is the key to start
+// after.
+func (s *Server) list(w http.ResponseWriter, bucket, prefix, delimiter, startAfter string) {
+	const maxKeys = 1000
+	type content struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+		ETag         string
+	}
+	type commonPrefix struct {
+		Prefix string
+	}
+	var res struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Name                  string
+		Prefix                string
+		Contents              []content
+		CommonPrefixes        []commonPrefix
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}
+	res.Name = bucket
+	res.Prefix = prefix
+	var keys []string
+	for k := range s.objects {
+		key, ok := strings.CutPrefix(k, bucket+"/")
+		if ok && strings.HasPrefix(key, prefix) && key > startAfter {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if len(res.Contents)+len(res.CommonPrefixes) == maxKeys {
+			res.IsTruncated = true
+			break
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i != -1 {
+				cp := key[:len(prefix)+i+len(delimiter)]
+				if len(res.CommonPrefixes) == 0 || res.CommonPrefixes[len(res.CommonPrefixes)-1].Prefix != cp {
+					res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{cp})
+				}
+				res.NextContinuationToken = key
+				continue
+			}
+		}
+		o := s.objects[bucket+"/"+key]
+		res.Contents = append(res.Contents, content{key, int64(len(o.data)), o.modified, etag(o.data)})
+		res.NextContinuationToken = key
+	}
+	if !res.IsTruncated {
+		res.NextContinuationToken = ""
+	}
+	writeXml(w, res)
+}
+
+func metadataHeader(h http.Header) http.Header {
+	ret := make(http.Header)
+	for k, vs := range h {
+		if strings.HasPrefix(k, "X-Amz-Meta-") {
+			ret[k] = vs
+		}
+	}
+	return ret
+}
+
+func etag(b []byte) string {
+	h := md5.Sum(b)
+	return `"` + hex.EncodeToString(h[:]) + `"`
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package storage
+
+import (
+	"errors"
+	"os"
+)
+
+// Allocating disk space isn't implemented for this platform, so the file is just extended.
+func fallocate(f *os.File, length int64) error {
+	return extendFile(f, length)
+}
+
+// Punching holes isn't implemented for this platform. Files can't be truncated instead, as they may
+// be memory mapped.
+func punchHole(f *os.File, offset, length int64) error {
+	return errors.ErrUnsupported
+}
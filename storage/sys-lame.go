@@ -7,6 +7,15 @@ import (
 	"os"
 )
 
+// Holes can't be found, so only the end of the file is a hole.
+func seekHole(f *os.File, offset int64) (ret int64, err error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return
+	}
+	return max(offset, fi.Size()), nil
+}
+
 func seekData(f *os.File, offset int64) (ret int64, err error) {
 	return f.Seek(offset, io.SeekStart)
 }
@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Allocates disk space for the file up to length, extending it if necessary. Falls back to
+// extending the file without allocating if the filesystem doesn't support it.
+func fallocate(f *os.File, length int64) error {
+	err := unix.Fallocate(int(f.Fd()), 0, 0, length)
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOSYS) {
+		return extendFile(f, length)
+	}
+	return err
+}
+
+// Releases the space for the region of the file, which then reads as zeroes. Returns
+// errors.ErrUnsupported if the filesystem can't do that.
+func punchHole(f *os.File, offset, length int64) error {
+	err := unix.Fallocate(int(f.Fd()), unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, offset, length)
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOSYS) {
+		return errors.ErrUnsupported
+	}
+	return err
+}
@@ -22,6 +22,15 @@ func seekData(f *os.File, offset int64) (ret int64, err error) {
 	return
 }
 
+// Offsets at or beyond the end of the file are holes.
+func seekHole(f *os.File, offset int64) (ret int64, err error) {
+	ret, err = unix.Seek(int(f.Fd()), offset, unix.SEEK_HOLE)
+	if err == unix.ENXIO {
+		return offset, nil
+	}
+	return
+}
+
 var pageSize = unix.Getpagesize()
 
 func msync(mm mmap.MMap, offset, nbytes int) error {
@@ -0,0 +1,447 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	g "github.com/anacrolix/generics"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+type NewTieredOpts struct {
+	// Pieces migrated concurrently. Defaults to 1, which keeps writes to the bulk tier sequential.
+	Migrators int
+	// Defaults to slog.Default.
+	Logger *slog.Logger
+}
+
+// Combines a fast storage tier, such as an SSD or memory, with a slow bulk tier, such as a hard disk
+// or object storage. Incoming data is written to the fast tier. Once a piece is complete it is
+// copied to the bulk tier in the background in a single sequential write, and then released from
+// the fast tier, using PieceEvicter if the fast tier implements it. Reads are served from whichever
+// tier holds the piece. Pieces that are complete in the fast tier but not the bulk tier when a
+// torrent is opened are migrated then. The torrent's capacity is that of the bulk tier, and moving
+// and renaming the torrent's storage apply to the bulk tier, where the data ends up. File wanted
+// states and reader pieces are passed to both tiers.
+type Tiered struct {
+	fast ClientImpl
+	bulk ClientImpl
+	opts NewTieredOpts
+
+	mu     sync.Mutex
+	cond   sync.Cond
+	queue  []tieredJob
+	closed bool
+	wg     sync.WaitGroup
+}
+
+var _ ClientImplCloser = (*Tiered)(nil)
+
+func NewTiered(fast, bulk ClientImpl, opts NewTieredOpts) *Tiered {
+	if opts.Migrators <= 0 {
+		opts.Migrators = 1
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	me := &Tiered{
+		fast: fast,
+		bulk: bulk,
+		opts: opts,
+	}
+	me.cond.L = &me.mu
+	for range opts.Migrators {
+		me.wg.Add(1)
+		go me.migrator()
+	}
+	return me
+}
+
+// Stops migrating, waiting for migrations in progress, and closes the tiers that are io.Closers.
+// Pieces that weren't migrated stay in the fast tier until their torrent is opened again.
+func (me *Tiered) Close() error {
+	me.mu.Lock()
+	me.closed = true
+	me.queue = nil
+	me.cond.Broadcast()
+	me.mu.Unlock()
+	me.wg.Wait()
+	var errs []error
+	for _, ci := range []ClientImpl{me.fast, me.bulk} {
+		if closer, ok := ci.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (me *Tiered) OpenTorrent(ctx context.Context, info *metainfo.Info, infoHash metainfo.Hash) (_ TorrentImpl, err error) {
+	fast, err := me.fast.OpenTorrent(ctx, info, infoHash)
+	if err != nil {
+		err = fmt.Errorf("opening fast tier: %w", err)
+		return
+	}
+	bulk, err := me.bulk.OpenTorrent(ctx, info, infoHash)
+	if err != nil {
+		if fast.Close != nil {
+			fast.Close()
+		}
+		err = fmt.Errorf("opening bulk tier: %w", err)
+		return
+	}
+	t := &tieredTorrent{
+		tiered: me,
+		fast:   Torrent{fast},
+		bulk:   Torrent{bulk},
+		info:   info,
+		pieces: make(map[int]*tieredPiece),
+	}
+	t.cond.L = &t.mu
+	for i := range info.NumPieces() {
+		p := info.Piece(i)
+		if t.bulk.PieceWithHash(p, g.None[[]byte]()).Completion().Complete {
+			t.piece(i).inBulk = true
+		} else if t.fast.PieceWithHash(p, g.None[[]byte]()).Completion().Complete {
+			me.enqueue(tieredJob{t, i})
+		}
+	}
+	return TorrentImpl{
+		Piece:           t.Piece,
+		PieceWithHash:   t.PieceWithHash,
+		Close:           t.Close,
+		Flush:           t.Flush,
+		Capacity:        bulk.Capacity,
+		Mover:           bulk.Mover,
+		Renamer:         bulk.Renamer,
+		SetFileWanted:   t.setFileWanted,
+		SetReaderPieces: t.setReaderPieces,
+	}, nil
+}
+
+type tieredJob struct {
+	t     *tieredTorrent
+	piece int
+}
+
+func (me *Tiered) enqueue(job tieredJob) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if me.closed {
+		return
+	}
+	me.queue = append(me.queue, job)
+	me.cond.Signal()
+}
+
+func (me *Tiered) migrator() {
+	defer me.wg.Done()
+	for {
+		me.mu.Lock()
+		for len(me.queue) == 0 && !me.closed {
+			me.cond.Wait()
+		}
+		if me.closed {
+			me.mu.Unlock()
+			return
+		}
+		job := me.queue[0]
+		me.queue = me.queue[1:]
+		me.mu.Unlock()
+		err := job.t.migrate(job.piece)
+		if err != nil {
+			me.opts.Logger.Error("migrating piece to bulk tier", "piece", job.piece, "err", err)
+		}
+	}
+}
+
+type tieredTorrent struct {
+	tiered *Tiered
+	fast   Torrent
+	bulk   Torrent
+	info   *metainfo.Info
+
+	mu     sync.Mutex
+	cond   sync.Cond
+	pieces map[int]*tieredPiece
+	closed bool
+	// Migrations and releases from the fast tier in progress, which Close waits for. Only added to
+	// with mu held while not closed.
+	busy sync.WaitGroup
+}
+
+// Where a piece's data is. Protected by tieredTorrent.mu.
+type tieredPiece struct {
+	inBulk bool
+	// Incremented when the piece is written to or marked not complete, to abandon migrations that
+	// began before.
+	gen uint64
+	// Reads in progress, and whether the fast tier should be released when they're done.
+	readers     int
+	releaseFast bool
+	// The piece is being released from the fast tier. Writes wait for it on tieredTorrent.cond.
+	releasing bool
+	hash      g.Option[[]byte]
+}
+
+// Must hold mu.
+func (t *tieredTorrent) piece(i int) *tieredPiece {
+	p, ok := t.pieces[i]
+	if !ok {
+		p = &tieredPiece{}
+		t.pieces[i] = p
+	}
+	return p
+}
+
+func (t *tieredTorrent) Piece(p metainfo.Piece) PieceImpl {
+	return t.PieceWithHash(p, g.None[[]byte]())
+}
+
+func (t *tieredTorrent) PieceWithHash(p metainfo.Piece, pieceHash g.Option[[]byte]) PieceImpl {
+	if pieceHash.Ok {
+		t.mu.Lock()
+		t.piece(p.Index()).hash = pieceHash
+		t.mu.Unlock()
+	}
+	return &tieredPieceImpl{
+		t:     t,
+		index: p.Index(),
+		fast:  t.fast.PieceWithHash(p, pieceHash),
+		bulk:  t.bulk.PieceWithHash(p, pieceHash),
+	}
+}
+
+func (t *tieredTorrent) Close() error {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	t.busy.Wait()
+	var errs []error
+	for _, ti := range []Torrent{t.fast, t.bulk} {
+		if ti.Close != nil {
+			errs = append(errs, ti.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t *tieredTorrent) Flush() error {
+	var errs []error
+	for _, ti := range []Torrent{t.fast, t.bulk} {
+		if ti.Flush != nil {
+			errs = append(errs, ti.Flush())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t *tieredTorrent) setFileWanted(fileIndex int, wanted bool) {
+	for _, ti := range []Torrent{t.fast, t.bulk} {
+		if ti.SetFileWanted != nil {
+			ti.SetFileWanted(fileIndex, wanted)
+		}
+	}
+}
+
+func (t *tieredTorrent) setReaderPieces(pieces []int) {
+	for _, ti := range []Torrent{t.fast, t.bulk} {
+		if ti.SetReaderPieces != nil {
+			ti.SetReaderPieces(pieces)
+		}
+	}
+}
+
+// Copies a complete piece from the fast tier to the bulk tier, and then releases it from the fast
+// tier once no reads are using it.
+func (t *tieredTorrent) migrate(index int) error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.busy.Add(1)
+	defer t.busy.Done()
+	tp := t.piece(index)
+	gen := tp.gen
+	hash := tp.hash
+	t.mu.Unlock()
+	mip := t.info.Piece(index)
+	fast := t.fast.PieceWithHash(mip, hash)
+	if !fast.Completion().Complete {
+		return nil
+	}
+	bulk := t.bulk.PieceWithHash(mip, hash)
+	buf := make([]byte, mip.Length())
+	_, err := fast.ReadAt(buf, 0)
+	if err != nil {
+		return fmt.Errorf("reading from fast tier: %w", err)
+	}
+	_, err = bulk.WriteAt(buf, 0)
+	if err != nil {
+		return fmt.Errorf("writing to bulk tier: %w", err)
+	}
+	err = bulk.MarkComplete()
+	if err != nil {
+		return fmt.Errorf("marking complete in bulk tier: %w", err)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tp.gen != gen || t.closed {
+		// The piece changed while it was copied. It will be migrated again if it completes.
+		return bulk.MarkNotComplete()
+	}
+	tp.inBulk = true
+	if tp.readers != 0 {
+		tp.releaseFast = true
+		return nil
+	}
+	return t.releaseFast(tp, fast)
+}
+
+// Must hold mu, which is released during the I/O. Writes to the piece wait until it's done.
+func (t *tieredTorrent) releaseFast(tp *tieredPiece, fast Piece) (err error) {
+	if t.closed {
+		return nil
+	}
+	t.busy.Add(1)
+	defer t.busy.Done()
+	tp.releasing = true
+	t.mu.Unlock()
+	if evicter, ok := fast.PieceImpl.(PieceEvicter); ok {
+		err = evicter.Evict()
+	} else {
+		err = fast.MarkNotComplete()
+	}
+	t.mu.Lock()
+	tp.releasing = false
+	t.cond.Broadcast()
+	return
+}
+
+type tieredPieceImpl struct {
+	t     *tieredTorrent
+	index int
+	fast  Piece
+	bulk  Piece
+}
+
+var _ PieceReaderer = (*tieredPieceImpl)(nil)
+
+// Returns the tier to read from. endRead must be called with fromFast when the read is done.
+func (p *tieredPieceImpl) beginRead() (tier Piece, fromFast bool) {
+	p.t.mu.Lock()
+	defer p.t.mu.Unlock()
+	tp := p.t.piece(p.index)
+	if tp.inBulk {
+		return p.bulk, false
+	}
+	tp.readers++
+	return p.fast, true
+}
+
+func (p *tieredPieceImpl) endRead(fromFast bool) {
+	if !fromFast {
+		return
+	}
+	p.t.mu.Lock()
+	defer p.t.mu.Unlock()
+	tp := p.t.piece(p.index)
+	tp.readers--
+	if tp.readers != 0 || !tp.releaseFast {
+		return
+	}
+	tp.releaseFast = false
+	err := p.t.releaseFast(tp, p.fast)
+	if err != nil {
+		p.t.tiered.opts.Logger.Error("releasing piece from fast tier", "piece", p.index, "err", err)
+	}
+}
+
+func (p *tieredPieceImpl) ReadAt(b []byte, off int64) (int, error) {
+	tier, fromFast := p.beginRead()
+	defer p.endRead(fromFast)
+	return tier.ReadAt(b, off)
+}
+
+func (p *tieredPieceImpl) WriteTo(w io.Writer) (int64, error) {
+	tier, fromFast := p.beginRead()
+	defer p.endRead(fromFast)
+	return tier.WriteTo(w)
+}
+
+func (p *tieredPieceImpl) NewReader() (PieceReader, error) {
+	tier, fromFast := p.beginRead()
+	var r PieceReader
+	if pr, ok := tier.PieceImpl.(PieceReaderer); ok {
+		var err error
+		r, err = pr.NewReader()
+		if err != nil {
+			p.endRead(fromFast)
+			return nil, err
+		}
+	} else {
+		r = struct {
+			io.ReaderAt
+			io.Closer
+		}{tier, io.NopCloser(nil)}
+	}
+	return &tieredPieceReader{PieceReader: r, p: p, fromFast: fromFast}, nil
+}
+
+type tieredPieceReader struct {
+	PieceReader
+	p        *tieredPieceImpl
+	fromFast bool
+	once     sync.Once
+}
+
+func (r *tieredPieceReader) Close() error {
+	err := r.PieceReader.Close()
+	r.once.Do(func() { r.p.endRead(r.fromFast) })
+	return err
+}
+
+// Marks the piece as changing, so migrations in progress are abandoned. Waits for the piece to
+// finish being released from the fast tier.
+func (p *tieredPieceImpl) invalidate() {
+	p.t.mu.Lock()
+	tp := p.t.piece(p.index)
+	for tp.releasing {
+		p.t.cond.Wait()
+	}
+	tp.gen++
+	tp.inBulk = false
+	p.t.mu.Unlock()
+}
+
+func (p *tieredPieceImpl) WriteAt(b []byte, off int64) (int, error) {
+	p.invalidate()
+	return p.fast.WriteAt(b, off)
+}
+
+func (p *tieredPieceImpl) MarkComplete() error {
+	err := p.fast.MarkComplete()
+	if err != nil {
+		return err
+	}
+	p.t.tiered.enqueue(tieredJob{p.t, p.index})
+	return nil
+}
+
+func (p *tieredPieceImpl) MarkNotComplete() error {
+	p.invalidate()
+	return errors.Join(p.bulk.MarkNotComplete(), p.fast.MarkNotComplete())
+}
+
+func (p *tieredPieceImpl) Completion() Completion {
+	c := p.bulk.Completion()
+	if c.Complete {
+		return c
+	}
+	return p.fast.Completion()
+}
@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestTiered(t *testing.T) {
+	const pieceLen = 1 << 14
+	fastDir, bulkDir := t.TempDir(), t.TempDir()
+	fastPc, bulkPc := NewMapPieceCompletion(), NewMapPieceCompletion()
+	newFile := func(dir string, pc PieceCompletion) ClientImplCloser {
+		opts := NewFileClientOpts{ClientBaseDir: dir, PieceCompletion: pc}
+		// Completion is kept by the piece completion rather than inferred from file names.
+		opts.UsePartFiles.Set(false)
+		return NewFileOpts(opts)
+	}
+	newTiered := func() *Tiered {
+		return NewTiered(newFile(fastDir, fastPc), newFile(bulkDir, bulkPc), NewTieredOpts{})
+	}
+	info := &metainfo.Info{
+		Name:        "a",
+		Length:      2 * pieceLen,
+		PieceLength: pieceLen,
+		Pieces:      make([]byte, 2*metainfo.HashSize),
+	}
+	data := func(i int) []byte {
+		return bytes.Repeat([]byte{byte(i + 1)}, pieceLen)
+	}
+	inBulk := func(i int) bool {
+		b, _ := os.ReadFile(filepath.Join(bulkDir, "a"))
+		return int64(len(b)) >= int64(i+1)*pieceLen && bytes.Equal(b[i*pieceLen:(i+1)*pieceLen], data(i))
+	}
+	// Waits for the piece to be complete in the bulk tier and released from the fast tier.
+	waitMigrated := func(i int) {
+		key := metainfo.PieceKey{Index: i}
+		for range 500 {
+			fastC, _ := fastPc.Get(key)
+			bulkC, _ := bulkPc.Get(key)
+			if bulkC.Complete && !fastC.Complete {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatalf("piece %v not migrated", i)
+	}
+
+	tiered := newTiered()
+	ts, err := NewClient(tiered).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	p0 := ts.Piece(info.Piece(0))
+	_, err = p0.WriteAt(data(0), 0)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.IsFalse(inBulk(0)))
+	qt.Assert(t, qt.IsNil(p0.MarkComplete()))
+	waitMigrated(0)
+	qt.Check(t, qt.IsTrue(inBulk(0)))
+	qt.Check(t, qt.IsTrue(p0.Completion().Complete))
+	b := make([]byte, pieceLen)
+	_, err = p0.ReadAt(b, 0)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(b, data(0)))
+
+	// A piece left complete in the fast tier is migrated when the torrent is opened again.
+	qt.Assert(t, qt.IsNil(ts.Close()))
+	qt.Assert(t, qt.IsNil(tiered.Close()))
+	fast, err := NewClient(newFile(fastDir, fastPc)).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	p1 := fast.Piece(info.Piece(1))
+	_, err = p1.WriteAt(data(1), 0)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(p1.MarkComplete()))
+	qt.Assert(t, qt.IsNil(fast.Close()))
+	tiered = newTiered()
+	defer tiered.Close()
+	ts, err = NewClient(tiered).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	defer ts.Close()
+	waitMigrated(1)
+	qt.Check(t, qt.IsTrue(inBulk(1)))
+	qt.Check(t, qt.IsTrue(ts.Piece(info.Piece(1)).Completion().Complete))
+
+	// Renaming and moving apply to the bulk tier.
+	qt.Assert(t, qt.IsNotNil(ts.Renamer))
+	qt.Assert(t, qt.IsNil(ts.Renamer.RenameRoot("b")))
+	_, err = os.Stat(filepath.Join(bulkDir, "b"))
+	qt.Check(t, qt.IsNil(err))
+	movedDir := t.TempDir()
+	qt.Assert(t, qt.IsNotNil(ts.Mover))
+	qt.Assert(t, qt.IsNil(ts.Mover.MoveStorage(context.Background(), movedDir, nil)))
+	_, err = os.Stat(filepath.Join(movedDir, "b"))
+	qt.Check(t, qt.IsNil(err))
+	_, err = ts.Piece(info.Piece(1)).ReadAt(b, 0)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(b, data(1)))
+}
+
+// Records the optional calls a tier receives.
+type recordingTier struct {
+	ClientImpl
+	fileWanted   map[int]bool
+	readerPieces []int
+}
+
+func (me *recordingTier) OpenTorrent(ctx context.Context, info *metainfo.Info, infoHash metainfo.Hash) (TorrentImpl, error) {
+	ti, err := me.ClientImpl.OpenTorrent(ctx, info, infoHash)
+	ti.SetFileWanted = func(fileIndex int, wanted bool) {
+		me.fileWanted[fileIndex] = wanted
+	}
+	ti.SetReaderPieces = func(pieces []int) {
+		me.readerPieces = pieces
+	}
+	return ti, err
+}
+
+func TestTieredPassesFileWantedAndReaderPieces(t *testing.T) {
+	fast := &recordingTier{ClientImpl: NewMMap(t.TempDir()), fileWanted: make(map[int]bool)}
+	bulk := &recordingTier{ClientImpl: NewMMap(t.TempDir()), fileWanted: make(map[int]bool)}
+	tiered := NewTiered(fast, bulk, NewTieredOpts{})
+	defer tiered.Close()
+	info := &metainfo.Info{
+		Name:        "a",
+		Length:      2,
+		PieceLength: 1,
+		Pieces:      make([]byte, 2*metainfo.HashSize),
+	}
+	ts, err := NewClient(tiered).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	defer ts.Close()
+	ts.SetFileWanted(0, false)
+	ts.SetReaderPieces([]int{1})
+	for _, tier := range []*recordingTier{fast, bulk} {
+		qt.Check(t, qt.DeepEquals(tier.fileWanted, map[int]bool{0: false}))
+		qt.Check(t, qt.DeepEquals(tier.readerPieces, []int{1}))
+	}
+}
+
+// Blocks writes until released, and records if the torrent is closed during one.
+type blockingTier struct {
+	ClientImpl
+	writing           chan struct{}
+	release           chan struct{}
+	inWrite           atomic.Bool
+	closedDuringWrite atomic.Bool
+}
+
+func (me *blockingTier) OpenTorrent(ctx context.Context, info *metainfo.Info, infoHash metainfo.Hash) (TorrentImpl, error) {
+	ti, err := me.ClientImpl.OpenTorrent(ctx, info, infoHash)
+	piece := ti.Piece
+	ti.Piece = func(p metainfo.Piece) PieceImpl {
+		return blockingPiece{piece(p), me}
+	}
+	ti.PieceWithHash = nil
+	closeTorrent := ti.Close
+	ti.Close = func() error {
+		if me.inWrite.Load() {
+			me.closedDuringWrite.Store(true)
+		}
+		return closeTorrent()
+	}
+	return ti, err
+}
+
+type blockingPiece struct {
+	PieceImpl
+	tier *blockingTier
+}
+
+func (me blockingPiece) WriteAt(b []byte, off int64) (int, error) {
+	me.tier.inWrite.Store(true)
+	defer me.tier.inWrite.Store(false)
+	close(me.tier.writing)
+	<-me.tier.release
+	return me.PieceImpl.WriteAt(b, off)
+}
+
+func TestTieredCloseWaitsForMigration(t *testing.T) {
+	bulk := &blockingTier{
+		ClientImpl: NewMMap(t.TempDir()),
+		writing:    make(chan struct{}),
+		release:    make(chan struct{}),
+	}
+	tiered := NewTiered(NewMMap(t.TempDir()), bulk, NewTieredOpts{})
+	defer tiered.Close()
+	release := sync.OnceFunc(func() { close(bulk.release) })
+	defer release()
+	info := &metainfo.Info{
+		Name:        "a",
+		Length:      1,
+		PieceLength: 1,
+		Pieces:      make([]byte, metainfo.HashSize),
+	}
+	ts, err := NewClient(tiered).OpenTorrent(context.Background(), info, metainfo.Hash{})
+	qt.Assert(t, qt.IsNil(err))
+	p := ts.Piece(info.Piece(0))
+	_, err = p.WriteAt([]byte{1}, 0)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(p.MarkComplete()))
+	<-bulk.writing
+	closed := make(chan error)
+	go func() { closed <- ts.Close() }()
+	select {
+	case <-closed:
+		t.Fatal("closed during migration")
+	case <-time.After(10 * time.Millisecond):
+	}
+	release()
+	qt.Check(t, qt.IsNil(<-closed))
+	qt.Check(t, qt.IsFalse(bulk.closedDuringWrite.Load()))
+}
@@ -0,0 +1,521 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// A minimal io_uring, shared by goroutines. Operations are queued, and a submitter goroutine adds
+// whatever is queued to the submission ring in a single io_uring_enter, so concurrent I/O is
+// batched. A reaper goroutine waits for completions. Data is transferred through buffers
+// registered with the kernel, which live outside the Go heap, so the kernel never sees Go memory.
+// Large reads and writes are split across several buffers that are submitted together. If the ring
+// fails, operations in progress fail with errUringFailed, and callers fall back to classic I/O.
+
+const (
+	uringOpNop           = 0
+	uringOpFsync         = 3
+	uringOpReadFixed     = 4
+	uringOpWriteFixed    = 5
+	uringOpSyncFileRange = 8
+
+	uringSqeIoLink       = 1 << 2
+	uringFsyncDatasync   = 1
+	uringEnterGetEvents  = 1
+	uringRegisterBuffers = 0
+	uringOffSqRing       = 0
+	uringOffCqRing       = 0x8000000
+	uringOffSqes         = 0x10000000
+	uringEntries         = 64
+	uringBufferSize      = 1 << 16
+	// Buffers a single read or write can use at once, leaving the rest for concurrent I/O.
+	uringMaxBufsPerOp = uringEntries / 4
+	uringSqeSize      = 64
+	uringCqeSize      = 16
+)
+
+type uringSqringOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringCqringOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCpu, sqThreadIdle, features, wqFd uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  uringSqringOffsets
+	cqOff                                                                  uringCqringOffsets
+}
+
+type uringSqe struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	opFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFdIn  int32
+	addr3       uint64
+	pad2        uint64
+}
+
+type uringCqe struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+var errUringFailed = errors.New("io_uring failed")
+
+// One or more submissions, completed together. Protected by uring.mu once submitted.
+type uringOp struct {
+	sqes      []uringSqe
+	res       []int32
+	remaining int
+	// Set if the ring failed before the op completed.
+	err  error
+	done chan struct{}
+}
+
+type uring struct {
+	fd                 int
+	sqRing, cqRing     []byte
+	sqes               []byte
+	sqHead, sqTail     *uint32
+	sqMask             uint32
+	sqArray            []uint32
+	cqHead, cqTail     *uint32
+	cqMask             uint32
+	cqes               unsafe.Pointer
+	bufMem             []byte
+	freeBufs           chan uint16
+	queue              chan *uringOp
+	inFlightSubmitSlot chan struct{}
+	slotMu             sync.Mutex
+	// Closed when the ring fails.
+	failedC chan struct{}
+
+	mu       sync.Mutex
+	nextUd   uint64
+	inFlight map[uint64]uringInFlight
+	err      error
+}
+
+type uringInFlight struct {
+	op    *uringOp
+	index int
+}
+
+func uringSetup(entries uint32, params *uringParams) (int, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(entries), uintptr(unsafe.Pointer(params)), 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+func (r *uring) enter(toSubmit, minComplete, flags uint32) (int, error) {
+	for {
+		n, _, errno := unix.Syscall6(
+			unix.SYS_IO_URING_ENTER,
+			uintptr(r.fd), uintptr(toSubmit), uintptr(minComplete), uintptr(flags), 0, 0)
+		if errno == unix.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return int(n), errno
+		}
+		return int(n), nil
+	}
+}
+
+func newUring() (_ *uring, err error) {
+	var params uringParams
+	fd, err := uringSetup(uringEntries, &params)
+	if err != nil {
+		return nil, fmt.Errorf("io_uring_setup: %w", err)
+	}
+	r := &uring{fd: fd}
+	defer func() {
+		if err != nil {
+			r.unmap()
+		}
+	}()
+	sqRingSize := int(params.sqOff.array + params.sqEntries*4)
+	cqRingSize := int(params.cqOff.cqes + params.cqEntries*uringCqeSize)
+	r.sqRing, err = unix.Mmap(fd, uringOffSqRing, sqRingSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		return
+	}
+	r.cqRing, err = unix.Mmap(fd, uringOffCqRing, cqRingSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		return
+	}
+	r.sqes, err = unix.Mmap(fd, uringOffSqes, int(params.sqEntries)*uringSqeSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		return
+	}
+	r.sqHead = (*uint32)(unsafe.Pointer(&r.sqRing[params.sqOff.head]))
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sqRing[params.sqOff.tail]))
+	r.sqMask = *(*uint32)(unsafe.Pointer(&r.sqRing[params.sqOff.ringMask]))
+	r.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&r.sqRing[params.sqOff.array])), params.sqEntries)
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cqRing[params.cqOff.head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cqRing[params.cqOff.tail]))
+	r.cqMask = *(*uint32)(unsafe.Pointer(&r.cqRing[params.cqOff.ringMask]))
+	r.cqes = unsafe.Pointer(&r.cqRing[params.cqOff.cqes])
+	// Register one buffer per submission slot.
+	numBufs := int(params.sqEntries)
+	r.bufMem, err = unix.Mmap(-1, 0, numBufs*uringBufferSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+	if err != nil {
+		return
+	}
+	iovecs := make([]unix.Iovec, numBufs)
+	r.freeBufs = make(chan uint16, numBufs)
+	for i := range iovecs {
+		iovecs[i].Base = &r.bufMem[i*uringBufferSize]
+		iovecs[i].SetLen(uringBufferSize)
+		r.freeBufs <- uint16(i)
+	}
+	_, _, errno := unix.Syscall6(
+		unix.SYS_IO_URING_REGISTER,
+		uintptr(fd), uringRegisterBuffers, uintptr(unsafe.Pointer(&iovecs[0])), uintptr(numBufs), 0, 0)
+	if errno != 0 {
+		err = fmt.Errorf("registering buffers: %w", errno)
+		return
+	}
+	// Completions can't overflow if there's no more in flight than there are submission slots.
+	r.inFlightSubmitSlot = make(chan struct{}, params.sqEntries)
+	r.queue = make(chan *uringOp, params.sqEntries)
+	r.inFlight = make(map[uint64]uringInFlight)
+	r.failedC = make(chan struct{})
+	go r.submitter()
+	go r.reaper()
+	return r, nil
+}
+
+func (r *uring) unmap() {
+	for _, b := range [][]byte{r.sqRing, r.cqRing, r.sqes, r.bufMem} {
+		if b != nil {
+			unix.Munmap(b)
+		}
+	}
+	unix.Close(r.fd)
+}
+
+func (r *uring) buf(index uint16) []byte {
+	return r.bufMem[int(index)*uringBufferSize : int(index+1)*uringBufferSize]
+}
+
+// Returns the error the ring failed with, wrapping errUringFailed, or nil if it hasn't.
+func (r *uring) failed() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Fails the ring, and the ops in flight. The kernel may still complete them, so their buffers are
+// never reused.
+func (r *uring) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	r.err = fmt.Errorf("%w: %w", errUringFailed, err)
+	close(r.failedC)
+	for ud, f := range r.inFlight {
+		delete(r.inFlight, ud)
+		<-r.inFlightSubmitSlot
+		r.finishOp(f.op)
+	}
+	slog.Warn("io_uring failed, falling back to classic file io", "err", err)
+}
+
+// Must hold mu.
+func (r *uring) finishOp(op *uringOp) {
+	if op.remaining == 0 {
+		return
+	}
+	op.remaining = 0
+	op.err = r.err
+	close(op.done)
+}
+
+// Submits the operations and waits for them to complete, returning their results.
+func (r *uring) do(sqes ...uringSqe) ([]int32, error) {
+	op := &uringOp{
+		sqes:      sqes,
+		res:       make([]int32, len(sqes)),
+		remaining: len(sqes),
+		done:      make(chan struct{}),
+	}
+	// Operations take their slots together, so that they can't deadlock each other.
+	r.slotMu.Lock()
+	for range sqes {
+		select {
+		case r.inFlightSubmitSlot <- struct{}{}:
+		case <-r.failedC:
+			r.slotMu.Unlock()
+			return nil, r.failed()
+		}
+	}
+	r.slotMu.Unlock()
+	r.queue <- op
+	<-op.done
+	return op.res, op.err
+}
+
+func (r *uring) submitter() {
+	for op := range r.queue {
+		ops := []*uringOp{op}
+	drain:
+		for {
+			select {
+			case op := <-r.queue:
+				ops = append(ops, op)
+			default:
+				break drain
+			}
+		}
+		tail := atomic.LoadUint32(r.sqTail)
+		var n uint32
+		r.mu.Lock()
+		if r.err != nil {
+			// The ops' slots were taken after the ring failed, and so weren't released by fail.
+			for _, op := range ops {
+				for range op.sqes {
+					<-r.inFlightSubmitSlot
+				}
+				r.finishOp(op)
+			}
+			r.mu.Unlock()
+			continue
+		}
+		for _, op := range ops {
+			for i, sqe := range op.sqes {
+				r.nextUd++
+				sqe.userData = r.nextUd
+				r.inFlight[sqe.userData] = uringInFlight{op, i}
+				r.putSqe(tail+n, sqe)
+				n++
+			}
+		}
+		r.mu.Unlock()
+		atomic.StoreUint32(r.sqTail, tail+n)
+		for n > 0 {
+			submitted, err := r.enter(n, 0, 0)
+			if err != nil {
+				if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EBUSY) {
+					continue
+				}
+				r.fail(fmt.Errorf("io_uring_enter: %w", err))
+				break
+			}
+			n -= uint32(submitted)
+		}
+	}
+}
+
+func (r *uring) putSqe(pos uint32, sqe uringSqe) {
+	index := pos & r.sqMask
+	*(*uringSqe)(unsafe.Pointer(&r.sqes[index*uringSqeSize])) = sqe
+	r.sqArray[index] = index
+}
+
+func (r *uring) reaper() {
+	for {
+		head := atomic.LoadUint32(r.cqHead)
+		if head == atomic.LoadUint32(r.cqTail) {
+			_, err := r.enter(0, 1, uringEnterGetEvents)
+			if err != nil && !errors.Is(err, unix.EAGAIN) && !errors.Is(err, unix.EBUSY) {
+				r.fail(fmt.Errorf("io_uring_enter: %w", err))
+				return
+			}
+			continue
+		}
+		cqe := *(*uringCqe)(unsafe.Add(r.cqes, uintptr(head&r.cqMask)*uringCqeSize))
+		atomic.StoreUint32(r.cqHead, head+1)
+		r.mu.Lock()
+		f, ok := r.inFlight[cqe.userData]
+		if ok {
+			// Ops failed by fail have already released their slots.
+			delete(r.inFlight, cqe.userData)
+			<-r.inFlightSubmitSlot
+			f.op.res[f.index] = cqe.res
+			f.op.remaining--
+			if f.op.remaining == 0 {
+				close(f.op.done)
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+func uringResult(res int32) (int, error) {
+	if res < 0 {
+		return 0, syscall.Errno(-res)
+	}
+	return int(res), nil
+}
+
+// Takes up to n free buffers, waiting for at least one. Only the first is waited for, so a caller
+// never holds buffers while it waits for others.
+func (r *uring) getBufs(n int) (bufs []uint16, err error) {
+	select {
+	case i := <-r.freeBufs:
+		bufs = append(bufs, i)
+	case <-r.failedC:
+		return nil, r.failed()
+	}
+	for len(bufs) < min(n, uringMaxBufsPerOp) {
+		select {
+		case i := <-r.freeBufs:
+			bufs = append(bufs, i)
+		default:
+			return
+		}
+	}
+	return
+}
+
+func (r *uring) putBufs(bufs []uint16) {
+	for _, i := range bufs {
+		r.freeBufs <- i
+	}
+}
+
+// Reads or writes through registered buffers. Data that spans several buffers is submitted
+// together, so the kernel can work on all of it at once.
+func (r *uring) rw(write bool, f *os.File, b []byte, off int64) (n int, err error) {
+	opcode := uint8(uringOpReadFixed)
+	if write {
+		opcode = uringOpWriteFixed
+	}
+	fd := int32(f.Fd())
+	// The file must stay open until the kernel is done with its descriptor.
+	defer runtime.KeepAlive(f)
+	for len(b) != 0 {
+		var bufs []uint16
+		bufs, err = r.getBufs((len(b) + uringBufferSize - 1) / uringBufferSize)
+		if err != nil {
+			return
+		}
+		chunks := make([][]byte, len(bufs))
+		sqes := make([]uringSqe, len(bufs))
+		var chunkOff int
+		for i, bufIndex := range bufs {
+			chunk := r.buf(bufIndex)[:min(len(b)-chunkOff, uringBufferSize)]
+			if write {
+				copy(chunk, b[chunkOff:])
+			}
+			chunks[i] = chunk
+			sqes[i] = uringSqe{
+				opcode:   opcode,
+				fd:       fd,
+				off:      uint64(off + int64(chunkOff)),
+				addr:     uint64(uintptr(unsafe.Pointer(&chunk[0]))),
+				len:      uint32(len(chunk)),
+				bufIndex: bufIndex,
+			}
+			chunkOff += len(chunk)
+		}
+		var res []int32
+		res, err = r.do(sqes...)
+		if err != nil {
+			// The kernel may still be using the buffers, so they're abandoned with the ring.
+			return
+		}
+		// Results count up to the first chunk that failed or was short.
+		var short bool
+		var roundN int
+		for i, chunk := range chunks {
+			var n1 int
+			n1, err = uringResult(res[i])
+			if !write {
+				copy(b, chunk[:n1])
+			}
+			roundN += n1
+			b = b[n1:]
+			off += int64(n1)
+			if err != nil || n1 < len(chunk) {
+				short = true
+				break
+			}
+		}
+		r.putBufs(bufs)
+		n += roundN
+		if err != nil {
+			return
+		}
+		if short {
+			if !write {
+				// The end of the file.
+				return
+			}
+			if roundN == 0 {
+				err = fmt.Errorf("io_uring write made no progress")
+				return
+			}
+		}
+	}
+	return
+}
+
+// Starts writeback of the range and then waits for the file data to be durable, as linked
+// operations.
+func (r *uring) syncRange(f *os.File, off, n int64) error {
+	fd := int32(f.Fd())
+	res, err := r.do(
+		uringSqe{
+			opcode:  uringOpSyncFileRange,
+			flags:   uringSqeIoLink,
+			fd:      fd,
+			off:     uint64(off),
+			len:     uint32(min(n, 1<<31)),
+			opFlags: unix.SYNC_FILE_RANGE_WRITE,
+		},
+		uringSqe{
+			opcode:  uringOpFsync,
+			fd:      fd,
+			opFlags: uringFsyncDatasync,
+		},
+	)
+	runtime.KeepAlive(f)
+	if err != nil {
+		return err
+	}
+	for _, r := range res {
+		if _, err := uringResult(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks the ring works, with a no-op.
+func (r *uring) nop() error {
+	res, err := r.do(uringSqe{opcode: uringOpNop})
+	if err != nil {
+		return err
+	}
+	_, err = uringResult(res[0])
+	return err
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+)
+
+// A failed ring fails its operations, and file I/O through it falls back to classic I/O.
+func TestUringFailureFallsBack(t *testing.T) {
+	r, err := newUring()
+	if err == nil {
+		err = r.nop()
+	}
+	if err != nil {
+		t.Skipf("io_uring unavailable: %v", err)
+	}
+	r.fail(errors.New("test"))
+	qt.Check(t, qt.ErrorIs(r.nop(), errUringFailed))
+	fio := uringFileIo{r}
+	name := filepath.Join(t.TempDir(), "data")
+	data := bytes.Repeat([]byte{1, 2, 3}, 1<<16)
+	w, err := fio.openForWrite(name, int64(len(data)))
+	qt.Assert(t, qt.IsNil(err))
+	n, err := w.WriteAt(data, 0)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(n, len(data)))
+	qt.Assert(t, qt.IsNil(w.Close()))
+	qt.Assert(t, qt.IsNil(fio.flush(name, 0, int64(len(data)))))
+	rd, err := fio.openForRead(name)
+	qt.Assert(t, qt.IsNil(err))
+	defer rd.Close()
+	var buf bytes.Buffer
+	_, err = rd.writeToN(&buf, int64(len(data)))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.IsTrue(bytes.Equal(buf.Bytes(), data)))
+}
+
+// Reads and writes needing several buffers go ahead with those that are free, rather than waiting
+// for more.
+func TestUringUsesFreeBuffers(t *testing.T) {
+	r, err := newUring()
+	if err == nil {
+		err = r.nop()
+	}
+	if err != nil {
+		t.Skipf("io_uring unavailable: %v", err)
+	}
+	var held []uint16
+	for len(r.freeBufs) > 1 {
+		held = append(held, <-r.freeBufs)
+	}
+	defer r.putBufs(held)
+	bufs, err := r.getBufs(4)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.HasLen(bufs, 1))
+	r.putBufs(bufs)
+	f, err := os.Create(filepath.Join(t.TempDir(), "data"))
+	qt.Assert(t, qt.IsNil(err))
+	defer f.Close()
+	data := bytes.Repeat([]byte{1, 2, 3}, uringBufferSize)
+	n, err := r.rw(true, f, data, 0)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(n, len(data)))
+	b := make([]byte, len(data))
+	n, err = r.rw(false, f, b, 0)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(n, len(data)))
+	qt.Check(t, qt.IsTrue(bytes.Equal(b, data)))
+}
@@ -38,6 +38,12 @@ func (t *Torrent) NewReader() Reader {
 	return t.newReader(0, t.length())
 }
 
+// Returns a ReaderAt for the torrent's data, for concurrent random access. As with NewReader, the
+// Torrent Info should be available first.
+func (t *Torrent) ReaderAt() ReaderAt {
+	return t.newReaderAt(0, t.length())
+}
+
 // NewPassiveReader creates a reader that avoids triggering piece priority updates while consuming
 // data that is already available.
 func (t *Torrent) NewPassiveReader() Reader {
@@ -245,7 +251,7 @@ func (t *Torrent) initFiles() {
 	info := t.info
 	var offset int64
 	t.files = new([]*File)
-	for _, fi := range t.info.UpvertedFiles() {
+	for i, fi := range t.info.UpvertedFiles() {
 		*t.files = append(*t.files, &File{
 			t,
 			strings.Join(append([]string{info.BestName()}, fi.BestPath()...), "/"),
@@ -255,6 +261,7 @@ func (t *Torrent) initFiles() {
 			fi.DisplayPath(info),
 			PiecePriorityNone,
 			fi.PiecesRoot,
+			i,
 		})
 		offset += fi.Length
 		if info.FilesArePieceAligned() {
@@ -277,9 +284,15 @@ func (t *Torrent) AddPeers(pp []PeerInfo) (n int) {
 }
 
 // Marks the entire torrent for download. Requires the info first, see
-// GotInfo. Sets piece priorities for historical reasons.
+// GotInfo. Sets piece priorities for historical reasons. Storage is told every
+// file is wanted, until File.SetPriority says otherwise.
 func (t *Torrent) DownloadAll() {
-	t.DownloadPieces(0, t.numPieces())
+	t.cl.lock()
+	t.downloadPiecesLocked(0, t.numPieces())
+	for _, f := range *t.files {
+		t.setStorageFileWanted(f.index, true)
+	}
+	t.cl.unlock()
 }
 
 func (t *Torrent) String() string {
@@ -0,0 +1,207 @@
+package torrent
+
+import (
+	"time"
+)
+
+const (
+	// How often requests for time-critical pieces are reconsidered, so that ones at risk of
+	// missing their deadlines can be duplicated to other peers.
+	pieceDeadlineCheckInterval = 250 * time.Millisecond
+	// Peers slower than the fastest peer with a time-critical piece by more than this factor don't
+	// request it, unless it's at risk of missing its deadline.
+	timeCriticalPeerRateFactor = 2
+	// How long a request for a time-critical piece is left with a peer that hasn't given us any data
+	// to estimate its rate from, before the request is considered at risk.
+	timeCriticalRequestPatience = time.Second
+)
+
+// A deadline set with Torrent.SetPieceDeadline.
+type pieceDeadline struct {
+	deadline time.Time
+	// Callbacks.PieceDeadlineMissed has been run for the deadline.
+	missed bool
+}
+
+// Sets the time by which a piece is wanted, for example when streaming. Time-critical pieces are
+// requested before other pieces, earliest deadline first, and from the fastest peers that have
+// them. Requests that are at risk of missing the deadline are duplicated to other peers. If the
+// deadline passes before the piece completes, Callbacks.PieceDeadlineMissed are run, and the piece
+// remains time-critical. The deadline is cleared when the piece completes, or by passing the zero
+// time. Requires that the info has been obtained.
+func (t *Torrent) SetPieceDeadline(piece int, deadline time.Time) {
+	t.cl.lock()
+	defer t.cl.unlock()
+	if deadline.IsZero() {
+		if _, ok := t.pieceDeadlines[piece]; !ok {
+			return
+		}
+		delete(t.pieceDeadlines, piece)
+	} else {
+		if t.pieceComplete(piece) {
+			return
+		}
+		if t.pieceDeadlines == nil {
+			t.pieceDeadlines = make(map[pieceIndex]pieceDeadline)
+		}
+		t.pieceDeadlines[piece] = pieceDeadline{deadline: deadline}
+	}
+	t.updatePiecePriority(piece, "Torrent.SetPieceDeadline")
+	t.schedulePieceDeadlineCheck()
+}
+
+// Clears all deadlines set with SetPieceDeadline.
+func (t *Torrent) ClearPieceDeadlines() {
+	t.cl.lock()
+	defer t.cl.unlock()
+	deadlines := t.pieceDeadlines
+	t.pieceDeadlines = nil
+	for i := range deadlines {
+		t.updatePiecePriority(i, "Torrent.ClearPieceDeadlines")
+	}
+}
+
+// Returns the earliest deadline for a piece, from SetPieceDeadline and readers with a playback
+// rate.
+func (t *Torrent) pieceDeadline(i pieceIndex) (deadline time.Time, ok bool) {
+	if d, ok1 := t.pieceDeadlines[i]; ok1 {
+		deadline, ok = d.deadline, true
+	}
+	for r := range t.readers {
+		rd, rok := r.pieceDeadline(i)
+		if rok && (!ok || rd.Before(deadline)) {
+			deadline, ok = rd, true
+		}
+	}
+	return
+}
+
+// Whether any incomplete pieces have deadlines. Completed pieces have their deadlines cleared.
+func (t *Torrent) haveTimeCriticalPieces() bool {
+	if len(t.pieceDeadlines) != 0 {
+		return true
+	}
+	for r := range t.readers {
+		if r.playbackRate <= 0 {
+			continue
+		}
+		for i := r.pieces.begin; i < r.pieces.end; i++ {
+			if !t.pieceComplete(i) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Starts the timer that reports missed deadlines and reconsiders time-critical requests if there
+// are time-critical pieces, or brings it forward for an earlier deadline.
+func (t *Torrent) schedulePieceDeadlineCheck() {
+	if t.closed.IsSet() || !t.haveTimeCriticalPieces() {
+		return
+	}
+	next := time.Now().Add(pieceDeadlineCheckInterval)
+	for _, d := range t.pieceDeadlines {
+		if !d.missed && d.deadline.Before(next) {
+			next = d.deadline
+		}
+	}
+	if t.pieceDeadlineTimer != nil {
+		// If the timer has already fired, the handler reschedules it.
+		if !next.Before(t.pieceDeadlineCheckAt) || !t.pieceDeadlineTimer.Stop() {
+			return
+		}
+	}
+	t.pieceDeadlineCheckAt = next
+	t.pieceDeadlineTimer = time.AfterFunc(time.Until(next), t.onPieceDeadlineTimer)
+}
+
+func (t *Torrent) onPieceDeadlineTimer() {
+	t.cl.lock()
+	defer t.cl.unlock()
+	t.pieceDeadlineTimer = nil
+	if t.closed.IsSet() {
+		return
+	}
+	now := time.Now()
+	for i, d := range t.pieceDeadlines {
+		if d.missed || now.Before(d.deadline) {
+			continue
+		}
+		d.missed = true
+		t.pieceDeadlines[i] = d
+		t.slogger().Debug("missed piece deadline", "piece", i, "deadline", d.deadline)
+		for _, cb := range t.cl.config.Callbacks.PieceDeadlineMissed {
+			cb(PieceDeadlineMissedEvent{
+				Torrent:  t,
+				Piece:    i,
+				Deadline: d.deadline,
+			})
+		}
+	}
+	// Peers only reconsider their requests on events, which may not occur while a time-critical
+	// request is stuck with a slow peer.
+	for c := range t.conns {
+		if c.isLowOnRequests() {
+			c.onNeedUpdateRequests("time-critical pieces")
+		}
+	}
+	t.schedulePieceDeadlineCheck()
+}
+
+// Estimates when the peer would deliver the given number of chunks after the requests it already
+// has. ok is false if the peer hasn't given us any data to estimate its rate from.
+func (t *Torrent) peerChunksETA(p *PeerConn, chunks int) (eta time.Time, ok bool) {
+	rate := p.downloadRate()
+	if rate <= 0 {
+		return
+	}
+	bytes := float64(int(p.requestState.Requests.GetCardinality())+chunks) * float64(t.chunkSize)
+	return time.Now().Add(time.Duration(bytes / rate * float64(time.Second))), true
+}
+
+// Returns the fastest unchoked peer with the piece that we've measured a download rate for.
+func (t *Torrent) fastestPeerWithPiece(piece pieceIndex) (fastest *PeerConn) {
+	var fastestRate float64
+	for c := range t.conns {
+		if c.peerChoking && !c.peerAllowedFast.Contains(piece) || !c.peerHasPiece(piece) {
+			continue
+		}
+		if rate := c.downloadRate(); rate > fastestRate {
+			fastest, fastestRate = c, rate
+		}
+	}
+	return
+}
+
+// Whether the peer should request chunks of a time-critical piece. Slow peers only do so when
+// the fastest peer with the piece is unlikely to meet the deadline.
+func (t *Torrent) peerMayRequestTimeCritical(p *PeerConn, piece pieceIndex, deadline time.Time) bool {
+	fastest := t.fastestPeerWithPiece(piece)
+	if fastest == nil || fastest == p {
+		return true
+	}
+	if p.downloadRate()*timeCriticalPeerRateFactor >= fastest.downloadRate() {
+		return true
+	}
+	eta, _ := t.peerChunksETA(fastest, int(t.pieceNumPendingChunks(piece)))
+	return eta.After(deadline)
+}
+
+// Whether an existing request for a time-critical piece is unlikely to be delivered before the
+// deadline, so it should be duplicated to another peer.
+func (t *Torrent) requestAtRisk(r RequestIndex, deadline time.Time) bool {
+	if !time.Now().Before(deadline) {
+		return true
+	}
+	state := t.requestState[r]
+	existing := state.peer.Value()
+	if existing == nil {
+		return false
+	}
+	eta, ok := t.peerChunksETA(existing, 0)
+	if !ok {
+		return time.Since(state.when) > timeCriticalRequestPatience
+	}
+	return eta.After(deadline)
+}
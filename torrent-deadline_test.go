@@ -0,0 +1,177 @@
+package torrent
+
+import (
+	"testing"
+	"time"
+	"weak"
+
+	g "github.com/anacrolix/generics"
+	"github.com/anacrolix/generics/heap"
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/metainfo"
+	infohash_v2 "github.com/anacrolix/torrent/types/infohash-v2"
+)
+
+const deadlineTestPieceLength = 1 << 8 << 10
+
+func newDeadlineTestTorrent(t *testing.T) *Torrent {
+	cl := newTestingClient(t)
+	tor, _ := cl.AddTorrentOpt(AddTorrentOpts{
+		InfoHash:   testingTorrentInfoHash,
+		InfoHashV2: g.Some(infohash_v2.FromHexString("deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef")),
+		Storage:    &storageClient{},
+	})
+	tor.disableTriggers = true
+	const numPieces = 100
+	qt.Assert(t, qt.IsNil(tor.setInfoUnlocked(&metainfo.Info{
+		Pieces:      make([]byte, numPieces*metainfo.HashSize),
+		PieceLength: deadlineTestPieceLength,
+		Length:      deadlineTestPieceLength * numPieces,
+	})))
+	for i := range tor.numPieces() {
+		tor.cl.lock()
+		tor.updatePieceCompletion(i)
+		tor.cl.unlock()
+		tor.pieces[i].priority.Raise(PiecePriorityNormal)
+		tor.updatePiecePriorityNoRequests(i)
+	}
+	return tor
+}
+
+// Adds an unchoking peer with all pieces that has downloaded at the given rate.
+func addDeadlineTestPeer(tor *Torrent, bytesPerSecond int64) *PeerConn {
+	peer := tor.cl.newConnection(nil, newConnectionOpts{
+		network: "test",
+	})
+	peer.setTorrent(tor)
+	peer.onPeerHasAllPiecesNoTriggers()
+	peer.peerChoking = false
+	peer._stats.BytesReadUsefulData.Add(bytesPerSecond)
+	peer.cumulativeExpectedToReceiveChunks = time.Second
+	tor.conns[peer] = struct{}{}
+	return peer
+}
+
+// Sets deadlines without starting the timer, which would update requests on the test peers.
+func setTestPieceDeadlines(tor *Torrent, deadlines map[pieceIndex]time.Time) {
+	old := tor.pieceDeadlines
+	tor.pieceDeadlines = make(map[pieceIndex]pieceDeadline)
+	for i, d := range deadlines {
+		tor.pieceDeadlines[i] = pieceDeadline{deadline: d}
+		tor.updatePiecePriorityNoRequests(i)
+	}
+	for i := range old {
+		tor.updatePiecePriorityNoRequests(i)
+	}
+}
+
+// Returns the pieces of the peer's desired requests, in the order they would be made.
+func desiredRequestPieces(p *PeerConn) (pieces []pieceIndex) {
+	next := p.getDesiredRequestState()
+	requests := next.Requests.requestIndexes
+	h := heap.InterfaceForSlice(&requests, next.Requests.lessByValue)
+	heap.Init(h)
+	for h.Len() != 0 {
+		piece := p.t.pieceIndexOfRequestIndex(heap.Pop(h))
+		if len(pieces) == 0 || pieces[len(pieces)-1] != piece {
+			pieces = append(pieces, piece)
+		}
+	}
+	return
+}
+
+func TestPieceDeadlineRequestOrder(t *testing.T) {
+	tor := newDeadlineTestTorrent(t)
+	fast := addDeadlineTestPeer(tor, 10<<20)
+	slow := addDeadlineTestPeer(tor, 1<<20)
+	now := time.Now()
+	setTestPieceDeadlines(tor, map[pieceIndex]time.Time{
+		50: now.Add(time.Hour),
+		20: now.Add(time.Minute),
+	})
+	qt.Check(t, qt.Equals(tor.piece(50).purePriority(), PiecePriorityNow))
+	pieces := desiredRequestPieces(fast)
+	qt.Assert(t, qt.IsTrue(len(pieces) > 2))
+	qt.Check(t, qt.DeepEquals(pieces[:2], []pieceIndex{20, 50}))
+	// The fast peer will get the time-critical pieces in time, so the slow peer leaves them.
+	pieces = desiredRequestPieces(slow)
+	qt.Check(t, qt.Not(qt.SliceContains(pieces, 20)))
+	qt.Check(t, qt.Not(qt.SliceContains(pieces, 50)))
+	// Now the fast peer can't make it.
+	setTestPieceDeadlines(tor, map[pieceIndex]time.Time{
+		20: now.Add(time.Millisecond),
+	})
+	pieces = desiredRequestPieces(slow)
+	qt.Check(t, qt.Equals(pieces[0], 20))
+}
+
+func TestPieceDeadlineRequestAtRisk(t *testing.T) {
+	tor := newDeadlineTestTorrent(t)
+	slow := addDeadlineTestPeer(tor, 1<<10)
+	req := tor.pieceRequestIndexBegin(20)
+	tor.requestState[req] = requestState{
+		peer: weak.Make(slow),
+		when: time.Now(),
+	}
+	slow.requestState.Requests.Add(req)
+	qt.Check(t, qt.IsFalse(tor.requestAtRisk(req, time.Now().Add(time.Hour))))
+	qt.Check(t, qt.IsTrue(tor.requestAtRisk(req, time.Now().Add(time.Second))))
+	qt.Check(t, qt.IsTrue(tor.requestAtRisk(req, time.Now().Add(-time.Second))))
+}
+
+func TestPieceDeadlineMissed(t *testing.T) {
+	cfg := TestingConfig(t)
+	events := make(chan PieceDeadlineMissedEvent, 1)
+	cfg.Callbacks.PieceDeadlineMissed = append(cfg.Callbacks.PieceDeadlineMissed, func(ev PieceDeadlineMissedEvent) {
+		events <- ev
+	})
+	cl, err := NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	tor, _ := cl.AddTorrentOpt(AddTorrentOpts{
+		InfoHash: testingTorrentInfoHash,
+		Storage:  &storageClient{},
+	})
+	qt.Assert(t, qt.IsNil(tor.setInfoUnlocked(&metainfo.Info{
+		Pieces:      make([]byte, 2*metainfo.HashSize),
+		PieceLength: deadlineTestPieceLength,
+		Length:      2 * deadlineTestPieceLength,
+	})))
+	tor.SetPieceDeadline(0, time.Now().Add(time.Hour))
+	qt.Check(t, qt.Equals(tor.PieceState(0).Priority, PiecePriorityNow))
+	tor.SetPieceDeadline(0, time.Time{})
+	qt.Check(t, qt.Equals(tor.PieceState(0).Priority, PiecePriorityNone))
+	deadline := time.Now().Add(10 * time.Millisecond)
+	tor.SetPieceDeadline(1, deadline)
+	select {
+	case ev := <-events:
+		qt.Check(t, qt.Equals(ev.Torrent, tor))
+		qt.Check(t, qt.Equals(ev.Piece, 1))
+		qt.Check(t, qt.Equals(ev.Deadline, deadline))
+	case <-time.After(5 * time.Second):
+		t.Fatal("missed deadline not reported")
+	}
+	// Missed pieces remain time-critical.
+	qt.Check(t, qt.Equals(tor.PieceState(1).Priority, PiecePriorityNow))
+}
+
+func TestReaderPlaybackRateDeadlines(t *testing.T) {
+	tor := newDeadlineTestTorrent(t)
+	r := tor.newReader(0, tor.length()).(*reader)
+	defer r.Close()
+	r.mu.Lock()
+	r.reading = true
+	r.mu.Unlock()
+	r.SetReadahead(4 * deadlineTestPieceLength)
+	r.SetPlaybackRate(deadlineTestPieceLength)
+	tor.cl.lock()
+	defer tor.cl.unlock()
+	first, ok := tor.pieceDeadline(0)
+	qt.Assert(t, qt.IsTrue(ok))
+	third, ok := tor.pieceDeadline(2)
+	qt.Assert(t, qt.IsTrue(ok))
+	qt.Check(t, qt.Equals(third.Sub(first), 2*time.Second))
+	_, ok = tor.pieceDeadline(4)
+	qt.Check(t, qt.IsFalse(ok))
+}
@@ -0,0 +1,52 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+
+	g "github.com/anacrolix/generics"
+
+	"github.com/anacrolix/torrent/storage"
+)
+
+// Moves the torrent's data to where it would be if the storage had been opened with newBaseDir,
+// such as a different disk. Storage I/O is paused while moving, but the torrent stays active. The
+// storage must implement storage.Mover, which the file storage does. The torrent's info must be
+// available.
+func (t *Torrent) MoveStorage(ctx context.Context, newBaseDir string) error {
+	t.storageLock.RLock()
+	defer t.storageLock.RUnlock()
+	t.cl.lock()
+	if t.storage == nil {
+		t.cl.unlock()
+		return errors.New("torrent storage not open")
+	}
+	mover := t.storage.Mover
+	if mover == nil {
+		t.cl.unlock()
+		return errors.New("storage doesn't support moving")
+	}
+	if t.storageMoveProgress.Ok {
+		t.cl.unlock()
+		return errors.New("storage is already being moved")
+	}
+	t.storageMoveProgress.Set(storage.MoveProgress{})
+	t.cl.unlock()
+	defer func() {
+		t.cl.lock()
+		t.storageMoveProgress.SetNone()
+		t.cl.unlock()
+	}()
+	return mover.MoveStorage(ctx, newBaseDir, func(mp storage.MoveProgress) {
+		t.cl.lock()
+		t.storageMoveProgress.Set(mp)
+		t.cl.unlock()
+	})
+}
+
+// Returns the progress of a call to MoveStorage, if one is running.
+func (t *Torrent) MoveStorageProgress() g.Option[storage.MoveProgress] {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	return t.storageMoveProgress
+}
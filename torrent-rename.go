@@ -0,0 +1,43 @@
+package torrent
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/anacrolix/torrent/storage"
+)
+
+// Changes where the file's data is stored, relative to the torrent's root directory, while the
+// torrent stays active. newPath components are separated by '/', like DisplayPath. For single-file
+// torrents this renames the torrent root. The data and piece completion are kept, and the storage
+// persists the new path. Path and DisplayPath continue to reflect the metainfo. The storage must
+// implement storage.Renamer, which the file storage does.
+func (f *File) Rename(newPath string) error {
+	return f.t.withRenamer(func(r storage.Renamer) error {
+		return r.RenameFile(f.index, strings.Split(newPath, "/"))
+	})
+}
+
+// Changes the name of the torrent's root directory in storage, or the file name for single-file
+// torrents, while the torrent stays active. See File.Rename.
+func (t *Torrent) RenameRoot(newName string) error {
+	return t.withRenamer(func(r storage.Renamer) error {
+		return r.RenameRoot(newName)
+	})
+}
+
+func (t *Torrent) withRenamer(f func(storage.Renamer) error) error {
+	t.storageLock.RLock()
+	defer t.storageLock.RUnlock()
+	t.cl.rLock()
+	if t.storage == nil {
+		t.cl.rUnlock()
+		return errors.New("torrent storage not open")
+	}
+	renamer := t.storage.Renamer
+	t.cl.rUnlock()
+	if renamer == nil {
+		return errors.New("storage doesn't support renaming")
+	}
+	return f(renamer)
+}
@@ -0,0 +1,40 @@
+package torrent
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+)
+
+func TestFileRename(t *testing.T) {
+	dataDir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dataDir)
+	cfg := TestingConfig(t)
+	cfg.DataDir = dataDir
+	cl, err := NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	tt, err := cl.AddTorrent(mi)
+	qt.Assert(t, qt.IsNil(err))
+	<-tt.GotInfo()
+	qt.Assert(t, qt.IsNil(tt.VerifyData()))
+
+	qt.Assert(t, qt.IsNil(tt.Files()[0].Rename("renamed.txt")))
+	_, err = os.Stat(filepath.Join(dataDir, testutil.GreetingFileName))
+	qt.Check(t, qt.ErrorIs(err, os.ErrNotExist))
+	_, err = os.Stat(filepath.Join(dataDir, "renamed.txt"))
+	qt.Check(t, qt.IsNil(err))
+
+	// Still complete without rehashing, and readable from the new name.
+	qt.Check(t, qt.IsTrue(tt.Complete().Bool()))
+	r := tt.NewReader()
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b), testutil.GreetingFileContents))
+}
@@ -0,0 +1,184 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	stdsync "sync"
+	"time"
+
+	g "github.com/anacrolix/generics"
+	"golang.org/x/time/rate"
+)
+
+// How long a piece verified for reading is trusted before it's hashed again.
+const verifyOnReadValidity = time.Minute
+
+var errPieceCorrupted = errors.New("piece data is corrupt")
+
+// Re-hashes complete pieces every ClientConfig.ScrubInterval until the torrent is closed.
+func (t *Torrent) scrubber() {
+	interval := t.cl.config.ScrubInterval
+	for {
+		select {
+		case <-t.closedCtx.Done():
+			return
+		case <-time.After(interval):
+		}
+		if !t.scrubPass() {
+			return
+		}
+	}
+}
+
+// Re-hashes every complete piece once. The goroutine has idle I/O priority for the pass, so it holds
+// its thread only while it's scrubbing. Returns false if the torrent was closed.
+func (t *Torrent) scrubPass() bool {
+	restore, err := lowerIoPriority()
+	if err != nil {
+		t.slogger().Debug("error lowering scrubber I/O priority", "err", err)
+	}
+	defer restore()
+	passStart := time.Now()
+	for i := range t.numPieces() {
+		if !t.scrubPiece(i) {
+			return false
+		}
+	}
+	t.slogger().Debug("finished scrubbing pass", "took", time.Since(passStart))
+	return true
+}
+
+// Re-hashes the piece if it's complete and nothing else is checking it. Returns false if the
+// torrent was closed.
+func (t *Torrent) scrubPiece(i pieceIndex) bool {
+	t.cl.rLock()
+	closed := t.closed.IsSet()
+	p := t.piece(i)
+	skip := !t.pieceComplete(i) || p.hashing || p.marking || p.queuedForHash()
+	length := int(p.length())
+	t.cl.rUnlock()
+	if closed {
+		return false
+	}
+	if skip {
+		return true
+	}
+	if limiter := t.cl.config.ScrubRateLimiter; limiter != nil && limiter.Limit() != rate.Inf {
+		for length > 0 {
+			n := min(length, limiter.Burst())
+			if limiter.WaitN(t.closedCtx, n) != nil {
+				return false
+			}
+			length -= n
+		}
+	}
+	correct, err := t.verifyCompletePieceData(i)
+	if errors.Is(err, errTorrentClosed) {
+		return false
+	}
+	t.counters.PiecesScrubbed.Add(1)
+	t.cl.counters.PiecesScrubbed.Add(1)
+	if !correct {
+		t.cl.lock()
+		t.onPieceCorrupted(i, PieceCorruptionScrub, err)
+		t.cl.unlock()
+	}
+	return true
+}
+
+// Hashes the data for a complete piece without the Client lock. Missing data fails the piece.
+func (t *Torrent) verifyCompletePieceData(i pieceIndex) (correct bool, err error) {
+	t.storageLock.RLock()
+	defer t.storageLock.RUnlock()
+	if t.closed.IsSet() || t.storage == nil {
+		return false, errTorrentClosed
+	}
+	correct, _, err = t.hashPieceData(i, true)
+	return
+}
+
+// Handles a complete piece failing a hash check outside of the usual piece checks. The Client lock
+// must be held.
+func (t *Torrent) onPieceCorrupted(i pieceIndex, source PieceCorruptionSource, err error) {
+	p := t.piece(i)
+	p.readVerified.Store(0)
+	if t.closed.IsSet() || !t.pieceComplete(i) || p.hashing || p.queuedForHash() {
+		return
+	}
+	// The cached completion may not have caught up with a failed check yet.
+	if !t.pieceCompleteUncached(i).Complete {
+		return
+	}
+	t.slogger().Warn("complete piece is corrupt", "piece", i, "source", source, "err", err)
+	t.counters.PiecesCorrupted.Add(1)
+	t.cl.counters.PiecesCorrupted.Add(1)
+	for _, cb := range t.cl.config.Callbacks.PieceCorrupted {
+		cb(PieceCorruptedEvent{
+			Torrent: t,
+			Piece:   i,
+			Source:  source,
+			Err:     err,
+		})
+	}
+	_, _ = t.queuePieceCheck(i)
+}
+
+type pieceReadVerifyLock struct {
+	stdsync.Mutex
+	// Callers holding or waiting for the lock. Protected by Torrent.readVerifyMu.
+	refs int
+}
+
+// Locks verifying the piece for reading, and returns the unlock function.
+func (t *Torrent) lockPieceReadVerify(i pieceIndex) (unlock func()) {
+	t.readVerifyMu.Lock()
+	l := t.readVerifyLocks[i]
+	if l == nil {
+		l = new(pieceReadVerifyLock)
+		g.MakeMapIfNil(&t.readVerifyLocks)
+		t.readVerifyLocks[i] = l
+	}
+	l.refs++
+	t.readVerifyMu.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		t.readVerifyMu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(t.readVerifyLocks, i)
+		}
+		t.readVerifyMu.Unlock()
+	}
+}
+
+// Verifies a piece before data is read from it for upload, if it hasn't been recently. Called
+// without the Client lock.
+func (t *Torrent) verifyPieceForRead(i pieceIndex) error {
+	p := t.piece(i)
+	verified := func() bool {
+		return time.Since(time.Unix(0, p.readVerified.Load())) < verifyOnReadValidity
+	}
+	if verified() {
+		return nil
+	}
+	defer t.lockPieceReadVerify(i)()
+	if verified() {
+		return nil
+	}
+	correct, err := t.verifyCompletePieceData(i)
+	if correct {
+		p.readVerified.Store(time.Now().UnixNano())
+		return nil
+	}
+	if errors.Is(err, errTorrentClosed) {
+		return err
+	}
+	t.cl.lock()
+	t.onPieceCorrupted(i, PieceCorruptionUploadRead, err)
+	t.cl.unlock()
+	if err != nil {
+		return fmt.Errorf("%w: %w", errPieceCorrupted, err)
+	}
+	return errPieceCorrupted
+}
@@ -0,0 +1,94 @@
+package torrent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+)
+
+func testPieceCorruption(t *testing.T, configure func(*ClientConfig), corrupt func(*Torrent)) PieceCorruptedEvent {
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	events := make(chan PieceCorruptedEvent, 1)
+	cfg := TestingConfig(t)
+	cfg.DataDir = dir
+	cfg.Callbacks.PieceCorrupted = append(cfg.Callbacks.PieceCorrupted, func(ev PieceCorruptedEvent) {
+		select {
+		case events <- ev:
+		default:
+		}
+	})
+	configure(cfg)
+	cl, err := NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	tt, err := cl.AddTorrent(mi)
+	qt.Assert(t, qt.IsNil(err))
+	<-tt.GotInfo()
+	qt.Assert(t, qt.IsNil(tt.VerifyData()))
+	qt.Assert(t, qt.IsTrue(tt.Complete().Bool()))
+	qt.Assert(t, qt.IsNil(os.WriteFile(
+		filepath.Join(dir, testutil.GreetingFileName),
+		[]byte("HELLO,\x00WORLD\n"),
+		0o644)))
+	corrupt(tt)
+	var ev PieceCorruptedEvent
+	select {
+	case ev = <-events:
+	case <-time.After(10 * time.Second):
+		t.Fatal("corruption not detected")
+	}
+	qt.Check(t, qt.Equals(ev.Torrent, tt))
+	qt.Check(t, qt.Equals(ev.Piece, 0))
+	// Pieces are checked again and marked not complete.
+	for tt.Complete().Bool() {
+		time.Sleep(time.Millisecond)
+	}
+	stats := tt.Stats()
+	qt.Check(t, qt.IsTrue(stats.PiecesCorrupted.Int64() >= 1))
+	return ev
+}
+
+func TestScrubDetectsCorruption(t *testing.T) {
+	ev := testPieceCorruption(t, func(cfg *ClientConfig) {
+		cfg.ScrubInterval = time.Millisecond
+	}, func(*Torrent) {})
+	qt.Check(t, qt.Equals(ev.Source, PieceCorruptionScrub))
+}
+
+func TestVerifyOnReadDetectsCorruption(t *testing.T) {
+	ev := testPieceCorruption(t, func(cfg *ClientConfig) {
+		cfg.VerifyOnRead = true
+	}, func(tt *Torrent) {
+		qt.Check(t, qt.ErrorIs(tt.verifyPieceForRead(0), errPieceCorrupted))
+	})
+	qt.Check(t, qt.Equals(ev.Source, PieceCorruptionUploadRead))
+}
+
+func TestPieceReadVerifyLocks(t *testing.T) {
+	var tt Torrent
+	unlock0 := tt.lockPieceReadVerify(0)
+	// Other pieces aren't held up.
+	tt.lockPieceReadVerify(1)()
+	locked := make(chan struct{})
+	go func() {
+		defer tt.lockPieceReadVerify(0)()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("piece verified concurrently")
+	case <-time.After(time.Millisecond):
+	}
+	unlock0()
+	<-locked
+	// Unused locks are removed.
+	tt.readVerifyMu.Lock()
+	qt.Check(t, qt.HasLen(tt.readVerifyLocks, 0))
+	tt.readVerifyMu.Unlock()
+}
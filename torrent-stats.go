@@ -48,4 +48,10 @@ func (me *TorrentGauges) Add(agg TorrentGauges) {
 
 type TorrentStatCounters struct {
 	BytesHashed Count
+	// Pieces that failed hashing without being read, because storage reported missing data.
+	PiecesHashSkipped Count
+	// Complete pieces re-hashed by the scrubber, and complete pieces found to be corrupt by the
+	// scrubber or when verifying reads for upload.
+	PiecesScrubbed  Count
+	PiecesCorrupted Count
 }
@@ -119,6 +119,13 @@ type Torrent struct {
 	// deadlock between pieceHasher (storageLock→Client.lock) and
 	// receiveChunk/startHash (Client.lock→storageLock).
 	storageLock stdsync.RWMutex
+	// Serializes verifying each piece for reading with ClientConfig.VerifyOnRead, so concurrent reads
+	// hash a piece once without holding up other pieces. Locks are removed when unused. They're here
+	// rather than in Piece to keep that small.
+	readVerifyMu    stdsync.Mutex
+	readVerifyLocks map[pieceIndex]*pieceReadVerifyLock
+	// Set while the storage is being moved. Protected by the Client lock.
+	storageMoveProgress Option[storage.MoveProgress]
 
 	announceList metainfo.AnnounceList
 
@@ -208,8 +215,9 @@ type Torrent struct {
 	smartBanCache smartBanCache
 
 	// Large allocations reused between request state updates.
-	requestPieceStates []g.Option[request_strategy.PieceRequestOrderState]
-	requestIndexes     []RequestIndex
+	requestPieceStates    []g.Option[request_strategy.PieceRequestOrderState]
+	requestPieceDeadlines []time.Time
+	requestIndexes        []RequestIndex
 
 	// Disable actions after updating piece priorities, for benchmarking.
 	disableTriggers bool
@@ -224,11 +232,18 @@ type Torrent struct {
 
 	// Endgame mode: when few pieces remain, allow duplicate requesting.
 	endgameMode bool
+
+	// Deadlines for time-critical pieces, see SetPieceDeadline.
+	pieceDeadlines       map[pieceIndex]pieceDeadline
+	pieceDeadlineTimer   *time.Timer
+	pieceDeadlineCheckAt time.Time
 }
 
 type torrentTrackerAnnouncerKey struct {
 	shortInfohash [20]byte
 	url           string
+	// Set instead of url for announcers covering an entire announce-list tier.
+	tier g.Option[int]
 }
 
 type outgoingConnAttemptKey = *PeerInfo
@@ -601,6 +616,9 @@ func (t *Torrent) onSetInfo() {
 	t.updateWantPeersEvent()
 	t.requestState = make(map[RequestIndex]requestState)
 	panicif.Err(t.startPieceHashers())
+	if t.cl.config.ScrubInterval > 0 {
+		go t.scrubber()
+	}
 	t.iterPeers(func(p *Peer) {
 		p.onGotInfo(t.info)
 		p.onNeedUpdateRequests("onSetInfo")
@@ -1252,11 +1270,34 @@ func (t *Torrent) hashPiece(piece pieceIndex) (
 	// bannable addr for peer types that are rebuked differently.
 	differingPeers map[bannableAddr]struct{},
 	err error,
+) {
+	return t.hashPieceData(piece, t.piece(piece).hashCanSkipMissing)
+}
+
+// Hashes the piece's data in storage. If canSkipMissing, the piece fails without being read if
+// storage reports it's missing data.
+func (t *Torrent) hashPieceData(piece pieceIndex, canSkipMissing bool) (
+	correct bool,
+	differingPeers map[bannableAddr]struct{},
+	err error,
 ) {
 	p := t.piece(piece)
 	p.waitNoPendingWrites()
 	storagePiece := p.Storage()
 
+	// Don't read data that storage knows is incomplete, such as holes in sparse files.
+	if i, ok := storagePiece.PieceImpl.(storage.MissingDataChecker); ok && canSkipMissing {
+		var missing bool
+		missing, err = i.MissingData()
+		if err == nil && missing {
+			t.counters.PiecesHashSkipped.Add(1)
+			t.cl.counters.PiecesHashSkipped.Add(1)
+			return
+		}
+		// Hash normally if the check fails.
+		err = nil
+	}
+
 	if p.hash != nil {
 		// Does the backend want to do its own hashing?
 		if i, ok := storagePiece.PieceImpl.(storage.SelfHashing); ok {
@@ -1508,6 +1549,16 @@ func (t *Torrent) readersChanged() {
 
 func (t *Torrent) updateReaderPieces() {
 	t._readerNowPieces, t._readerReadaheadPieces = t.readerPiecePriorities()
+	if t.storage != nil && t.storage.SetReaderPieces != nil {
+		union := t._readerNowPieces.Copy()
+		union.Union(t._readerReadaheadPieces)
+		var pieces []int
+		union.IterTyped(func(i int) bool {
+			pieces = append(pieces, i)
+			return true
+		})
+		t.storage.SetReaderPieces(pieces)
+	}
 }
 
 func (t *Torrent) readerPosChanged(from, to pieceRange) {
@@ -2264,14 +2315,7 @@ func (t *Torrent) startScrapingTrackerWithInfohash(u *url.URL, urlStr string, sh
 				return nil
 			}
 		}
-		newAnnouncer := &trackerScraper{
-			shortInfohash:   shortInfohash,
-			u:               *u,
-			t:               t,
-			lookupTrackerIp: t.cl.config.LookupTrackerIp,
-			stopCh:          make(chan struct{}),
-			originalUrl:     u.String(),
-		}
+		newAnnouncer := t.newTrackerScraper(u, shortInfohash)
 		go newAnnouncer.Run()
 		return newAnnouncer
 	}()
@@ -2284,12 +2328,27 @@ func (t *Torrent) startScrapingTrackerWithInfohash(u *url.URL, urlStr string, sh
 	}
 }
 
+func (t *Torrent) newTrackerScraper(u *url.URL, shortInfohash [20]byte) *trackerScraper {
+	return &trackerScraper{
+		shortInfohash:   shortInfohash,
+		u:               *u,
+		t:               t,
+		lookupTrackerIp: t.cl.config.LookupTrackerIp,
+		stopCh:          make(chan struct{}),
+		originalUrl:     u.String(),
+	}
+}
+
 // Adds and starts tracker scrapers for tracker URLs that aren't already
 // running.
 func (t *Torrent) startMissingTrackerScrapers() {
 	if t.cl.config.DisableTrackers {
 		return
 	}
+	if t.cl.config.TieredTrackerAnnouncing {
+		t.startMissingTrackerTierAnnouncers()
+		return
+	}
 	for _, tier := range t.announceList {
 		for _, url := range tier {
 			t.startScrapingTracker(url)
@@ -2809,6 +2868,7 @@ func (t *Torrent) cancelRequestsForPiece(piece pieceIndex) {
 }
 
 func (t *Torrent) onPieceCompleted(piece pieceIndex) {
+	delete(t.pieceDeadlines, piece)
 	t.pendAllChunkSpecs(piece)
 	t.cancelRequestsForPiece(piece)
 	t.piece(piece).readerCond.Broadcast()
@@ -2890,6 +2950,7 @@ func (t *Torrent) startHash(pi pieceIndex) {
 	p := t.piece(pi)
 	t.piecesQueuedForHash.Remove(pi)
 	p.hashing = true
+	p.hashCanSkipMissing = !p.hasDirtyChunks()
 	t.deferPublishPieceStateChange(pi)
 	t.updatePiecePriority(pi, "Torrent.startHash")
 	t.storageLock.RLock()
@@ -3759,6 +3820,11 @@ type TrackerStatus struct {
 	Interval         time.Duration
 	NextAnnounce     time.Time
 	ConsecutiveFails int
+	// Times the torrent has been downloaded in full, from the most recent scrape. Seeders and
+	// Leechers are also taken from the scrape if it's newer than the last announce.
+	Completed       int32
+	LastScrape      time.Time
+	LastScrapeError error
 }
 
 func (ts TrackerStatus) IsWorking() bool {
@@ -3827,21 +3893,13 @@ func (t *Torrent) TrackerStatuses() []TrackerStatus {
 	for _, announcer := range t.trackerAnnouncers {
 		switch ta := announcer.(type) {
 		case *trackerScraper:
-			status := TrackerStatus{
-				URL:              ta.originalUrl,
-				Tier:             t.trackerTier(ta.originalUrl),
-				LastError:        ta.lastAnnounce.Err,
-				LastAnnounce:     ta.lastAnnounce.Completed,
-				NumPeers:         ta.lastAnnounce.NumPeers,
-				Seeders:          ta.lastAnnounce.Seeders,
-				Leechers:         ta.lastAnnounce.Leechers,
-				Interval:         ta.lastAnnounce.Interval,
-				ConsecutiveFails: ta.consecutiveFails,
-			}
-			if !ta.lastAnnounce.Completed.IsZero() && ta.lastAnnounce.Interval > 0 {
-				status.NextAnnounce = ta.lastAnnounce.Completed.Add(ta.lastAnnounce.Interval)
+			statuses = append(statuses, ta.status(t.trackerTier(ta.originalUrl)))
+		case *trackerTierAnnouncer:
+			for _, e := range ta.entries {
+				for _, s := range e.scrapers {
+					statuses = append(statuses, s.status(ta.tier))
+				}
 			}
-			statuses = append(statuses, status)
 		case *websocketTrackerStatus:
 			statuses = append(statuses, TrackerStatus{
 				URL:  ta.url.String(),
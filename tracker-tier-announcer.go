@@ -0,0 +1,290 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	g "github.com/anacrolix/generics"
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent/tracker"
+)
+
+// Announces to a single announce-list tier as described in BEP 12. Trackers in the tier are tried
+// in order until one works, and the working tracker is moved to the front of the tier.
+type trackerTierAnnouncer struct {
+	t             *Torrent
+	shortInfohash [20]byte
+	tier          int
+
+	// Protected by the Client lock. Ordered by preference.
+	entries      []*trackerTierEntry
+	lastAnnounce trackerAnnounceResult
+	// Consecutive announces where no tracker in the tier worked.
+	consecutiveFails int
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// A tracker URL from the announce list. A udp URL is announced over both IPv4 and IPv6.
+type trackerTierEntry struct {
+	url      string
+	scrapers []*trackerScraper
+	// Whether a started event has been accepted by each scraper.
+	started []bool
+}
+
+var _ torrentTrackerAnnouncer = (*trackerTierAnnouncer)(nil)
+
+// Starts tier announcers for announce-list tiers that don't have one. Websocket trackers aren't
+// part of tier announcing and are started individually.
+func (t *Torrent) startMissingTrackerTierAnnouncers() {
+	for tierIndex, tier := range t.announceList {
+		for _, urlStr := range tier {
+			if u, err := url.Parse(urlStr); err == nil && (u.Scheme == "ws" || u.Scheme == "wss") {
+				t.startScrapingTracker(urlStr)
+			}
+		}
+		if t.infoHash.Ok {
+			t.startTrackerTierAnnouncer(tierIndex, t.infoHash.Value)
+		}
+		if t.infoHashV2.Ok {
+			t.startTrackerTierAnnouncer(tierIndex, *t.infoHashV2.Value.ToShort())
+		}
+	}
+}
+
+func (t *Torrent) startTrackerTierAnnouncer(tier int, shortInfohash [20]byte) {
+	key := torrentTrackerAnnouncerKey{
+		shortInfohash: shortInfohash,
+		tier:          g.Some(tier),
+	}
+	if _, ok := t.trackerAnnouncers[key]; ok {
+		return
+	}
+	ta := &trackerTierAnnouncer{
+		t:             t,
+		shortInfohash: shortInfohash,
+		tier:          tier,
+		stopCh:        make(chan struct{}),
+	}
+	ta.updateEntries()
+	g.MakeMapIfNil(&t.trackerAnnouncers)
+	t.trackerAnnouncers[key] = ta
+	go ta.Run()
+}
+
+// Adds entries for tracker URLs that have been added to the tier. New URLs are shuffled amongst
+// themselves and placed after existing entries. Call with the Client lock held.
+func (me *trackerTierAnnouncer) updateEntries() {
+	if me.tier >= len(me.t.announceList) {
+		return
+	}
+	var added []*trackerTierEntry
+	for _, urlStr := range me.t.announceList[me.tier] {
+		if slices.ContainsFunc(me.entries, func(e *trackerTierEntry) bool { return e.url == urlStr }) {
+			continue
+		}
+		e := me.newEntry(urlStr)
+		if e == nil {
+			continue
+		}
+		added = append(added, e)
+	}
+	rand.Shuffle(len(added), func(i, j int) {
+		added[i], added[j] = added[j], added[i]
+	})
+	me.entries = append(me.entries, added...)
+}
+
+// Returns nil if the URL can't or shouldn't be announced to.
+func (me *trackerTierAnnouncer) newEntry(urlStr string) *trackerTierEntry {
+	t := me.t
+	if urlStr == "" {
+		return nil
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		// URLs with a leading '*' appear to be a uTorrent convention to disable trackers.
+		if urlStr[0] != '*' {
+			t.logger.Levelf(log.Warning, "error parsing tracker url: %v", err)
+		}
+		return nil
+	}
+	var schemes []string
+	switch u.Scheme {
+	case "ws", "wss":
+		return nil
+	case "udp":
+		schemes = []string{"udp4", "udp6"}
+	default:
+		schemes = []string{u.Scheme}
+	}
+	e := &trackerTierEntry{url: urlStr}
+	for _, scheme := range schemes {
+		switch scheme {
+		case "udp4":
+			if t.cl.config.DisableIPv4Peers || t.cl.config.DisableIPv4 {
+				continue
+			}
+		case "udp6":
+			if t.cl.config.DisableIPv6 {
+				continue
+			}
+		}
+		su := *u
+		su.Scheme = scheme
+		e.scrapers = append(e.scrapers, t.newTrackerScraper(&su, me.shortInfohash))
+	}
+	if len(e.scrapers) == 0 {
+		return nil
+	}
+	e.started = make([]bool, len(e.scrapers))
+	return e
+}
+
+// Moves e to the front of the tier. Call with the Client lock held.
+func (me *trackerTierAnnouncer) promote(e *trackerTierEntry) {
+	i := slices.Index(me.entries, e)
+	if i <= 0 {
+		return
+	}
+	copy(me.entries[1:i+1], me.entries[:i])
+	me.entries[0] = e
+}
+
+// Returns the URL of the preferred tracker. Call with the Client lock held.
+func (me *trackerTierAnnouncer) URL() *url.URL {
+	if len(me.entries) == 0 {
+		return &url.URL{}
+	}
+	return me.entries[0].scrapers[0].URL()
+}
+
+func (me *trackerTierAnnouncer) statusLine() string {
+	return fmt.Sprintf("tier %v, %v trackers, %v", me.tier, len(me.entries), func() string {
+		if me.lastAnnounce.Err != nil {
+			return me.lastAnnounce.Err.Error()
+		}
+		if me.lastAnnounce.Completed.IsZero() {
+			return "never announced"
+		}
+		return fmt.Sprintf("%d peers", me.lastAnnounce.NumPeers)
+	}())
+}
+
+func (me *trackerTierAnnouncer) Stop() {
+	me.stopOnce.Do(func() {
+		close(me.stopCh)
+	})
+}
+
+func (me *trackerTierAnnouncer) Run() {
+	defer me.announceStopped()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		defer cancel()
+		select {
+		case <-ctx.Done():
+		case <-me.t.Closed():
+		}
+	}()
+
+	for {
+		ar := me.announce(ctx)
+		me.t.cl.lock()
+		me.lastAnnounce = ar
+		if ar.Err != nil {
+			me.consecutiveFails++
+		} else {
+			me.consecutiveFails = 0
+		}
+		consecutiveFails := me.consecutiveFails
+		me.t.cl.unlock()
+
+		if !me.t.waitForNextTrackerAnnounce(ar, consecutiveFails, me.stopCh) {
+			return
+		}
+	}
+}
+
+// Tries each tracker in the tier in order, stopping at the first that works.
+func (me *trackerTierAnnouncer) announce(ctx context.Context) (ret trackerAnnounceResult) {
+	me.t.cl.lock()
+	me.updateEntries()
+	entries := slices.Clone(me.entries)
+	me.t.cl.unlock()
+	if len(entries) == 0 {
+		ret.Err = errors.New("no usable trackers in tier")
+		ret.Interval = time.Minute
+		ret.Completed = time.Now()
+		return
+	}
+	for _, e := range entries {
+		ret = me.announceEntry(ctx, e)
+		if ret.Err == nil {
+			me.t.cl.lock()
+			me.promote(e)
+			me.t.cl.unlock()
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		me.t.logger.Levelf(log.Debug, "tier %v: falling through from %q: %v", me.tier, e.url, ret.Err)
+	}
+	return
+}
+
+// Announces to every scraper for the entry. The entry works if any of them do.
+func (me *trackerTierAnnouncer) announceEntry(ctx context.Context, e *trackerTierEntry) (ret trackerAnnounceResult) {
+	var worked g.Option[trackerAnnounceResult]
+	for i, s := range e.scrapers {
+		me.t.cl.rLock()
+		event := tracker.None
+		if !e.started[i] {
+			event = tracker.Started
+		}
+		me.t.cl.rUnlock()
+		ar := s.announce(ctx, event)
+		me.t.cl.lock()
+		s.setLastAnnounce(ar)
+		if ar.Err == nil {
+			e.started[i] = true
+		}
+		me.t.cl.unlock()
+		if ar.Err == nil && !worked.Ok {
+			worked.Set(ar)
+		}
+		ret = ar
+	}
+	return worked.UnwrapOr(ret)
+}
+
+// Sends stopped to every tracker we've successfully sent started to.
+func (me *trackerTierAnnouncer) announceStopped() {
+	ctx, cancel := context.WithTimeout(context.Background(), tracker.DefaultTrackerAnnounceTimeout)
+	defer cancel()
+	me.t.cl.rLock()
+	var started []*trackerScraper
+	for _, e := range me.entries {
+		for i, s := range e.scrapers {
+			if e.started[i] {
+				started = append(started, s)
+			}
+		}
+	}
+	me.t.cl.rUnlock()
+	for _, s := range started {
+		s.announce(ctx, tracker.Stopped)
+	}
+}
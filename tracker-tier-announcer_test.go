@@ -0,0 +1,88 @@
+package torrent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/internal/testutil"
+	httpTracker "github.com/anacrolix/torrent/tracker/http"
+)
+
+func TestTrackerTierAnnouncerFailover(t *testing.T) {
+	var brokenHits, workingHits atomic.Int32
+	working := make(chan struct{}, 1)
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		brokenHits.Add(1)
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		workingHits.Add(1)
+		bencode.NewEncoder(w).Encode(httpTracker.HttpResponse{Interval: 1800})
+		select {
+		case working <- struct{}{}:
+		default:
+		}
+	}))
+	defer good.Close()
+
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = false
+	cfg.TieredTrackerAnnouncing = true
+	cl, err := NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	mi.AnnounceList = [][]string{{broken.URL + "/announce", good.URL + "/announce"}}
+	tor, err := cl.AddTorrent(mi)
+	qt.Assert(t, qt.IsNil(err))
+
+	select {
+	case <-working:
+	case <-time.After(10 * time.Second):
+		t.Fatal("working tracker wasn't announced to")
+	}
+	// The working tracker is promoted once its response is handled.
+	preferred := func() string {
+		cl.lock()
+		defer cl.unlock()
+		qt.Assert(t, qt.HasLen(tor.trackerAnnouncers, 1))
+		for _, ta := range tor.trackerAnnouncers {
+			return ta.URL().String()
+		}
+		return ""
+	}
+	for preferred() != good.URL+"/announce" {
+		time.Sleep(10 * time.Millisecond)
+	}
+	qt.Check(t, qt.Equals(workingHits.Load(), 1))
+	qt.Check(t, qt.IsTrue(brokenHits.Load() <= 1))
+	qt.Check(t, qt.HasLen(tor.TrackerStatuses(), 2))
+}
+
+func TestTrackerTierAnnouncerPromote(t *testing.T) {
+	var ta trackerTierAnnouncer
+	for _, u := range []string{"a", "b", "c"} {
+		ta.entries = append(ta.entries, &trackerTierEntry{url: u})
+	}
+	order := func() (ret []string) {
+		for _, e := range ta.entries {
+			ret = append(ret, e.url)
+		}
+		return
+	}
+	ta.promote(ta.entries[2])
+	qt.Check(t, qt.DeepEquals(order(), []string{"c", "a", "b"}))
+	ta.promote(ta.entries[0])
+	qt.Check(t, qt.DeepEquals(order(), []string{"c", "a", "b"}))
+	ta.promote(ta.entries[1])
+	qt.Check(t, qt.DeepEquals(order(), []string{"a", "c", "b"}))
+}
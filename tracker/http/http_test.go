@@ -1,6 +1,9 @@
 package httpTracker
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 
@@ -73,3 +76,45 @@ func TestSetAnnounceInfohashParamWithSpaces(t *testing.T) {
 		qt.StringContains(someUrl.String(),
 			"info_hash=%2Bv%0A%A1x%93%200%C8G%DC%DF%8E%AE%BFV%0A%1B%D1l"))
 }
+
+func TestScrapeUrl(t *testing.T) {
+	for _, tc := range []struct {
+		announce, scrape string
+	}{
+		{"http://example.com/announce", "http://example.com/scrape"},
+		{"http://example.com/x/announce", "http://example.com/x/scrape"},
+		{"http://example.com/announce.php", "http://example.com/scrape.php"},
+		{"http://example.com/announce?x2%0644", "http://example.com/scrape?x2%0644"},
+		{"http://example.com/x%064announce", ""},
+		{"http://example.com/a", ""},
+		{"http://example.com/announce?x=2/4", "http://example.com/scrape?x=2/4"},
+	} {
+		u, err := url.Parse(tc.announce)
+		qt.Assert(t, qt.IsNil(err))
+		su, err := ScrapeUrl(u)
+		if tc.scrape == "" {
+			qt.Check(t, qt.ErrorIs(err, ErrScrapeUnsupported))
+			continue
+		}
+		qt.Assert(t, qt.IsNil(err))
+		qt.Check(t, qt.Equals(su.String(), tc.scrape))
+	}
+}
+
+// Scrape guesses a scrape URL for announce URLs that don't follow BEP 48, but ScrapeWithOpt doesn't.
+func TestScrapeNonStandardAnnounceUrl(t *testing.T) {
+	var paths []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte("d5:filesdee"))
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL + "/x/a")
+	qt.Assert(t, qt.IsNil(err))
+	cl := NewClient(u, NewClientOpts{})
+	_, err = cl.Scrape(context.Background(), nil)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(paths, []string{"/x/scrape"}))
+	_, err = cl.ScrapeWithOpt(context.Background(), nil, ScrapeOpt{})
+	qt.Check(t, qt.ErrorIs(err, ErrScrapeUnsupported))
+}
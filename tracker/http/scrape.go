@@ -1,25 +1,87 @@
 package httpTracker
 
 import (
+	"bytes"
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"path"
+	"strings"
+
+	"github.com/anacrolix/missinggo/httptoo"
 
 	"github.com/anacrolix/torrent/bencode"
 	"github.com/anacrolix/torrent/tracker/udp"
 	"github.com/anacrolix/torrent/types/infohash"
+	"github.com/anacrolix/torrent/version"
 )
 
 type scrapeResponse struct {
-	Files files `bencode:"files"`
+	FailureReason string      `bencode:"failure reason"`
+	Files         files       `bencode:"files"`
+	Flags         scrapeFlags `bencode:"flags"`
+}
+
+type scrapeFlags struct {
+	MinRequestInterval int32 `bencode:"min_request_interval"`
 }
 
 // Bencode should support bencode.Unmarshalers from a string in the dict key position.
 type files = map[string]udp.ScrapeInfohashResult
 
+// Returned for announce URLs that don't follow the scrape convention in BEP 48.
+var ErrScrapeUnsupported = errors.New("tracker doesn't support scraping")
+
+// Derives the scrape URL from an announce URL as described in BEP 48.
+func ScrapeUrl(announce *url.URL) (*url.URL, error) {
+	dir, file := path.Split(announce.Path)
+	if !strings.HasPrefix(file, "announce") {
+		return nil, ErrScrapeUnsupported
+	}
+	ret := httptoo.CopyURL(announce)
+	ret.Path = dir + "scrape" + strings.TrimPrefix(file, "announce")
+	ret.RawPath = ""
+	return ret, nil
+}
+
+type ScrapeOpt struct {
+	UserAgent           string
+	HostHeader          string
+	HttpRequestDirector func(*http.Request) error
+}
+
+type ScrapeResponse struct {
+	// Results for each requested infohash, in the same order.
+	Files udp.ScrapeResponse
+	// Seconds to wait before scraping again. Zero if the tracker didn't say.
+	MinRequestInterval int32
+}
+
+// Scrapes the tracker at the URL derived per BEP 48. If the announce URL doesn't follow BEP 48, the
+// scrape URL is guessed to be alongside it.
 func (cl Client) Scrape(ctx context.Context, ihs []infohash.T) (out udp.ScrapeResponse, err error) {
-	_url := cl.url_.JoinPath("..", "scrape")
+	_url, err := ScrapeUrl(cl.url_)
+	if err != nil {
+		_url = cl.url_.JoinPath("..", "scrape")
+	}
+	resp, err := cl.scrape(ctx, _url, ihs, ScrapeOpt{})
+	out = resp.Files
+	return
+}
+
+// Scrapes the tracker, failing with ErrScrapeUnsupported if the announce URL doesn't follow BEP 48.
+func (cl Client) ScrapeWithOpt(ctx context.Context, ihs []infohash.T, opt ScrapeOpt) (ret ScrapeResponse, err error) {
+	_url, err := ScrapeUrl(cl.url_)
+	if err != nil {
+		return
+	}
+	return cl.scrape(ctx, _url, ihs, opt)
+}
+
+func (cl Client) scrape(ctx context.Context, _url *url.URL, ihs []infohash.T, opt ScrapeOpt) (ret ScrapeResponse, err error) {
 	query, err := url.ParseQuery(_url.RawQuery)
 	if err != nil {
 		return
@@ -28,20 +90,51 @@ func (cl Client) Scrape(ctx context.Context, ihs []infohash.T) (out udp.ScrapeRe
 		query.Add("info_hash", ih.AsString())
 	}
 	_url.RawQuery = query.Encode()
-	log.Printf("%q", _url.String())
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, _url.String(), nil)
 	if err != nil {
 		return
 	}
+	userAgent := opt.UserAgent
+	if userAgent == "" {
+		userAgent = version.DefaultHttpUserAgent
+	}
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	if opt.HttpRequestDirector != nil {
+		err = opt.HttpRequestDirector(req)
+		if err != nil {
+			err = fmt.Errorf("error modifying HTTP request: %w", err)
+			return
+		}
+	}
+	req.Host = opt.HostHeader
 	resp, err := cl.hc.Do(req)
 	if err != nil {
 		return
 	}
 	defer resp.Body.Close()
+	var buf bytes.Buffer
+	io.Copy(&buf, resp.Body)
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("response from tracker: %s: %q", resp.Status, buf.Bytes())
+		return
+	}
 	var decodedResp scrapeResponse
-	err = bencode.NewDecoder(resp.Body).Decode(&decodedResp)
+	err = bencode.Unmarshal(buf.Bytes(), &decodedResp)
+	if _, ok := err.(bencode.ErrUnusedTrailingBytes); ok {
+		err = nil
+	} else if err != nil {
+		err = fmt.Errorf("error decoding %q: %s", buf.Bytes(), err)
+		return
+	}
+	if decodedResp.FailureReason != "" {
+		err = fmt.Errorf("tracker gave failure reason: %q", decodedResp.FailureReason)
+		return
+	}
 	for _, ih := range ihs {
-		out = append(out, decodedResp.Files[ih.AsString()])
+		ret.Files = append(ret.Files, decodedResp.Files[ih.AsString()])
 	}
+	ret.MinRequestInterval = decodedResp.Flags.MinRequestInterval
 	return
 }
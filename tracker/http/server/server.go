@@ -1,6 +1,7 @@
 package httpTrackerServer
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -23,6 +24,11 @@ type Handler struct {
 	// Called to derive an announcer's IP if non-nil. If not specified, the Request.RemoteAddr is
 	// used. Necessary for instances running behind reverse proxies for example.
 	RequestHost func(r *http.Request) (netip.Addr, error)
+	// Requests from sources over the limit get StatusTooManyRequests if this is non-nil.
+	RateLimiter *trackerServer.IpRateLimiter
+	// If non-zero, peers are omitted from announce responses to keep the body within this many
+	// bytes.
+	MaxResponseSize int
 }
 
 func unmarshalQueryKeyToArray(w http.ResponseWriter, key string, query url.Values) (ret [20]byte, ok bool) {
@@ -73,6 +79,10 @@ func (me Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "error determining your IP", http.StatusBadGateway)
 		return
 	}
+	if me.RateLimiter != nil && !me.RateLimiter.Allow(addr) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+		return
+	}
 	portU64, _ := strconv.ParseUint(vs.Get("port"), 0, 16)
 	addrPort := netip.AddrPortFrom(addr, uint16(portU64))
 	left, err := strconv.ParseInt(vs.Get("left"), 0, 64)
@@ -95,6 +105,14 @@ func (me Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		},
 	)
 	err = res.Err
+	if errors.Is(err, trackerServer.ErrAnnounceTooFrequent) {
+		// Trackers report announce failures to clients in the response body.
+		me.writeResponse(w, httpTracker.HttpResponse{
+			FailureReason: err.Error(),
+			MinInterval:   res.MinInterval.Value,
+		})
+		return
+	}
 	if err != nil {
 		log.Printf("error serving announce: %v", err)
 		http.Error(w, "error handling announce", http.StatusInternalServerError)
@@ -104,6 +122,7 @@ func (me Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	resp.Incomplete = res.Leechers.Value
 	resp.Complete = res.Seeders.Value
 	resp.Interval = res.Interval.UnwrapOr(5 * 60)
+	resp.MinInterval = res.MinInterval.Value
 	resp.Peers.Compact = true
 	for _, peer := range res.Peers {
 		if peer.Addr().Is4() {
@@ -118,8 +137,34 @@ func (me Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			})
 		}
 	}
-	err = bencode.NewEncoder(w).Encode(resp)
+	if me.MaxResponseSize != 0 {
+		capResponsePeers(&resp, me.MaxResponseSize)
+	}
+	me.writeResponse(w, resp)
+}
+
+func (me Handler) writeResponse(w http.ResponseWriter, resp httpTracker.HttpResponse) {
+	err := bencode.NewEncoder(w).Encode(resp)
 	if err != nil {
 		log.Printf("error encoding and writing response body: %v", err)
 	}
 }
+
+// Truncates the response peers so the encoded response fits in maxSize bytes. IPv4 peers are
+// preferred, as they're cheaper.
+func capResponsePeers(resp *httpTracker.HttpResponse, maxSize int) {
+	peers, peers6 := resp.Peers.List, resp.Peers6
+	resp.Peers.List, resp.Peers6 = nil, nil
+	empty, err := bencode.Marshal(*resp)
+	if err != nil {
+		return
+	}
+	// Allow for the string length prefixes of the compact peer lists growing.
+	const lengthPrefixSlack = 2 * 8
+	budget := maxSize - len(empty) - lengthPrefixSlack
+	// Compact peers are 6 bytes for IPv4 and 18 bytes for IPv6.
+	numPeers := min(max(budget/6, 0), len(peers))
+	resp.Peers.List = peers[:numPeers]
+	budget -= numPeers * 6
+	resp.Peers6 = peers6[:min(max(budget/18, 0), len(peers6))]
+}
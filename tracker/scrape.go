@@ -0,0 +1,75 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/anacrolix/log"
+
+	trHttp "github.com/anacrolix/torrent/tracker/http"
+	"github.com/anacrolix/torrent/tracker/udp"
+	"github.com/anacrolix/torrent/types/infohash"
+)
+
+// Scrapes a tracker for several infohashes at once. UDP trackers can't handle more than
+// udp.MaxScrapeInfoHashes at a time.
+type Scrape struct {
+	TrackerUrl          string
+	InfoHashes          []infohash.T
+	HostHeader          string
+	HttpProxy           func(*http.Request) (*url.URL, error)
+	HttpRequestDirector func(*http.Request) error
+	DialContext         func(ctx context.Context, network, addr string) (net.Conn, error)
+	ListenPacket        func(network, addr string) (net.PacketConn, error)
+	ServerName          string
+	UserAgent           string
+	UdpNetwork          string
+	Context             context.Context
+	Logger              log.Logger
+}
+
+type ScrapeResponse struct {
+	// Results for each of the requested infohashes, in the same order.
+	Files udp.ScrapeResponse
+	// How long to wait before scraping the tracker again. Zero if the tracker didn't say.
+	MinRequestInterval time.Duration
+}
+
+func (me Scrape) Do() (res ScrapeResponse, err error) {
+	cl, err := NewClient(me.TrackerUrl, NewClientOpts{
+		Http: trHttp.NewClientOpts{
+			Proxy:       me.HttpProxy,
+			DialContext: me.DialContext,
+			ServerName:  me.ServerName,
+		},
+		UdpNetwork:   me.UdpNetwork,
+		Logger:       me.Logger.WithContextValue(fmt.Sprintf("tracker client for %q", me.TrackerUrl)),
+		ListenPacket: me.ListenPacket,
+	})
+	if err != nil {
+		return
+	}
+	defer cl.Close()
+	if me.Context == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultTrackerAnnounceTimeout)
+		defer cancel()
+		me.Context = ctx
+	}
+	if httpCl, ok := cl.(trHttp.Client); ok {
+		var httpRes trHttp.ScrapeResponse
+		httpRes, err = httpCl.ScrapeWithOpt(me.Context, me.InfoHashes, trHttp.ScrapeOpt{
+			UserAgent:           me.UserAgent,
+			HostHeader:          me.HostHeader,
+			HttpRequestDirector: me.HttpRequestDirector,
+		})
+		res.Files = httpRes.Files
+		res.MinRequestInterval = time.Duration(httpRes.MinRequestInterval) * time.Second
+		return
+	}
+	res.Files, err = cl.Scrape(me.Context, me.InfoHashes)
+	return
+}
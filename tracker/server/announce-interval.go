@@ -0,0 +1,56 @@
+package trackerServer
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/tracker"
+)
+
+// Returned in ServerAnnounceResult.Err when an announcer ignores the minimum announce interval.
+// Servers should report this back to the announcer rather than treat it as an internal error.
+var ErrAnnounceTooFrequent = errors.New("announcing too frequently")
+
+type announceIntervalKey struct {
+	infoHash InfoHash
+	addr     AnnounceAddr
+}
+
+// Tracks when each peer last announced each infohash.
+type announceIntervals struct {
+	mu        sync.Mutex
+	last      map[announceIntervalKey]time.Time
+	lastPrune time.Time
+}
+
+// Records an announce at now, and returns false if the previous announce for the same key was
+// less than min ago. Announces carrying an event are always allowed, as clients are required to
+// send them promptly.
+func (me *announceIntervals) check(
+	infoHash InfoHash, addr AnnounceAddr, event tracker.AnnounceEvent, min time.Duration, now time.Time,
+) bool {
+	key := announceIntervalKey{infoHash, addr}
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if now.Sub(me.lastPrune) >= min {
+		me.lastPrune = now
+		for k, t := range me.last {
+			if now.Sub(t) >= min {
+				delete(me.last, k)
+			}
+		}
+	}
+	if event == tracker.Stopped {
+		delete(me.last, key)
+		return true
+	}
+	if last, ok := me.last[key]; ok && event == tracker.None && now.Sub(last) < min {
+		return false
+	}
+	if me.last == nil {
+		me.last = make(map[announceIntervalKey]time.Time)
+	}
+	me.last[key] = now
+	return true
+}
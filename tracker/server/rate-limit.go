@@ -0,0 +1,88 @@
+package trackerServer
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limits request rates per source IP. IPv6 sources are grouped by /64, since a single host
+// typically controls at least that much address space. Limit and Burst must be set before use.
+type IpRateLimiter struct {
+	// Sustained requests per second allowed for each source.
+	Limit rate.Limit
+	// Requests allowed in a burst for each source.
+	Burst int
+
+	mu        sync.Mutex
+	limiters  map[netip.Addr]*ipRateLimiterEntry
+	lastPrune time.Time
+}
+
+type ipRateLimiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// How often idle per-source limiters are discarded.
+const ipRateLimiterPruneInterval = time.Minute
+
+// Returns whether a request from addr should be served now.
+func (me *IpRateLimiter) Allow(addr netip.Addr) bool {
+	return me.allowAt(addr, time.Now())
+}
+
+func (me *IpRateLimiter) allowAt(addr netip.Addr, now time.Time) bool {
+	key := ipRateLimiterKey(addr)
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.maybePrune(now)
+	e, ok := me.limiters[key]
+	if !ok {
+		e = &ipRateLimiterEntry{limiter: rate.NewLimiter(me.Limit, me.Burst)}
+		if me.limiters == nil {
+			me.limiters = make(map[netip.Addr]*ipRateLimiterEntry)
+		}
+		me.limiters[key] = e
+	}
+	e.lastSeen = now
+	return e.limiter.AllowN(now, 1)
+}
+
+// Drops limiters that have been idle long enough to have refilled completely, as they're
+// indistinguishable from new ones.
+func (me *IpRateLimiter) maybePrune(now time.Time) {
+	if now.Sub(me.lastPrune) < ipRateLimiterPruneInterval {
+		return
+	}
+	me.lastPrune = now
+	refill := ipRateLimiterPruneInterval
+	if me.Limit > 0 && me.Limit != rate.Inf {
+		refill = time.Duration(float64(me.Burst) / float64(me.Limit) * float64(time.Second))
+	}
+	for key, e := range me.limiters {
+		if now.Sub(e.lastSeen) >= refill {
+			delete(me.limiters, key)
+		}
+	}
+}
+
+// Returns the number of sources currently being tracked.
+func (me *IpRateLimiter) Len() int {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return len(me.limiters)
+}
+
+func ipRateLimiterKey(addr netip.Addr) netip.Addr {
+	addr = addr.Unmap()
+	if addr.Is6() {
+		prefix, err := addr.Prefix(64)
+		if err == nil {
+			return prefix.Addr()
+		}
+	}
+	return addr.WithZone("")
+}
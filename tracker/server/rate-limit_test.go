@@ -0,0 +1,49 @@
+package trackerServer
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	qt "github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent/tracker"
+)
+
+func TestIpRateLimiter(t *testing.T) {
+	l := IpRateLimiter{Limit: 1, Burst: 2}
+	now := time.Unix(1_000_000, 0)
+	a := netip.MustParseAddr("1.2.3.4")
+	qt.Check(t, qt.IsTrue(l.allowAt(a, now)))
+	qt.Check(t, qt.IsTrue(l.allowAt(a, now)))
+	qt.Check(t, qt.IsFalse(l.allowAt(a, now)))
+	// Mapped addresses share the limit of the plain IPv4 address.
+	qt.Check(t, qt.IsFalse(l.allowAt(netip.MustParseAddr("::ffff:1.2.3.4"), now)))
+	qt.Check(t, qt.IsTrue(l.allowAt(netip.MustParseAddr("1.2.3.5"), now)))
+	qt.Check(t, qt.IsTrue(l.allowAt(a, now.Add(time.Second))))
+	// Idle sources are forgotten.
+	qt.Check(t, qt.IsTrue(l.allowAt(a, now.Add(time.Hour))))
+	qt.Check(t, qt.Equals(l.Len(), 1))
+}
+
+func TestIpRateLimiterIpv6Prefix(t *testing.T) {
+	l := IpRateLimiter{Limit: 1, Burst: 1}
+	now := time.Unix(1_000_000, 0)
+	qt.Check(t, qt.IsTrue(l.allowAt(netip.MustParseAddr("2001:db8::1"), now)))
+	qt.Check(t, qt.IsFalse(l.allowAt(netip.MustParseAddr("2001:db8::2"), now)))
+	qt.Check(t, qt.IsTrue(l.allowAt(netip.MustParseAddr("2001:db8:0:1::1"), now)))
+}
+
+func TestAnnounceIntervals(t *testing.T) {
+	var ai announceIntervals
+	now := time.Unix(1_000_000, 0)
+	addr := netip.MustParseAddrPort("1.2.3.4:5678")
+	const min = time.Minute
+	var ih InfoHash
+	qt.Check(t, qt.IsTrue(ai.check(ih, addr, tracker.Started, min, now)))
+	qt.Check(t, qt.IsFalse(ai.check(ih, addr, tracker.None, min, now.Add(time.Second))))
+	qt.Check(t, qt.IsTrue(ai.check(ih, addr, tracker.Completed, min, now.Add(time.Second))))
+	qt.Check(t, qt.IsTrue(ai.check(ih, addr, tracker.None, min, now.Add(2*min))))
+	ih[0] = 1
+	qt.Check(t, qt.IsTrue(ai.check(ih, addr, tracker.None, min, now.Add(2*min))))
+}
@@ -49,8 +49,10 @@ type ServerAnnounceResult struct {
 	Err      error
 	Peers    []PeerInfo
 	Interval generics.Option[int32]
-	Leechers generics.Option[int32]
-	Seeders  generics.Option[int32]
+	// Set when the handler enforces a minimum announce interval, in seconds.
+	MinInterval generics.Option[int32]
+	Leechers    generics.Option[int32]
+	Seeders     generics.Option[int32]
 }
 
 type AnnounceHandler struct {
@@ -61,6 +63,11 @@ type AnnounceHandler struct {
 	UpstreamAnnouncePeerId [20]byte
 	UpstreamAnnounceGate   UpstreamAnnounceGater
 
+	// If non-zero, periodic announces for an infohash from the same address more frequent than
+	// this fail with ErrAnnounceTooFrequent.
+	MinAnnounceInterval time.Duration
+	announceIntervals   announceIntervals
+
 	mu sync.Mutex
 	// Operations are only removed when all the upstream peers have been tracked.
 	ongoingUpstreamAugmentations map[InfoHash]augmentationOperation
@@ -133,6 +140,12 @@ func (me *AnnounceHandler) Serve(
 	if req.Port != 0 {
 		addr = netip.AddrPortFrom(addr.Addr(), req.Port)
 	}
+	if me.MinAnnounceInterval != 0 &&
+		!me.announceIntervals.check(req.InfoHash, addr, req.Event, me.MinAnnounceInterval, time.Now()) {
+		ret.Err = ErrAnnounceTooFrequent
+		ret.MinInterval = generics.Some(me.minIntervalSeconds())
+		return
+	}
 	ret.Err = me.AnnounceTracker.TrackAnnounce(ctx, req, addr)
 	if ret.Err != nil {
 		ret.Err = fmt.Errorf("tracking announce: %w", ret.Err)
@@ -160,6 +173,12 @@ func (me *AnnounceHandler) Serve(
 	if ret.Err != nil {
 		return
 	}
+	if me.MinAnnounceInterval != 0 {
+		ret.MinInterval = generics.Some(me.minIntervalSeconds())
+		if ret.Interval.Ok && ret.Interval.Value < ret.MinInterval.Value {
+			ret.Interval.Value = ret.MinInterval.Value
+		}
+	}
 	// Take whatever peers it has ready. If it's finished, it doesn't matter if we do this inside
 	// the mutex or not.
 	if op.Ok {
@@ -198,6 +217,10 @@ func (me *AnnounceHandler) Serve(
 	return
 }
 
+func (me *AnnounceHandler) minIntervalSeconds() int32 {
+	return int32((me.MinAnnounceInterval + time.Second - 1) / time.Second)
+}
+
 func (me *AnnounceHandler) augmentPeersFromUpstream(infoHash [20]byte) augmentationOperation {
 	const announceTimeout = time.Minute
 	announceCtx, cancel := context.WithTimeout(context.Background(), announceTimeout)
@@ -1,5 +1,9 @@
 package udp
 
+// BEP 15 says up to about 74 torrents can be scraped at once, as a full scrape response for this
+// many fits in a single packet.
+const MaxScrapeInfoHashes = 74
+
 type ScrapeRequest []InfoHash
 
 type ScrapeResponse []ScrapeInfohashResult
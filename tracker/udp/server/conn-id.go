@@ -0,0 +1,89 @@
+package udpTrackerServer
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+
+	"github.com/anacrolix/torrent/tracker/udp"
+)
+
+// Implemented by ConnectionTrackers that derive connection IDs themselves instead of recording
+// randomly generated ones with Add.
+type ConnectionIdIssuer interface {
+	Issue(ctx context.Context, addr ConnectionTrackerAddr) (udp.ConnectionId, error)
+}
+
+// BEP 15 requires trackers accept a connection ID for 2 minutes after it's sent.
+const DefaultConnectionIdRotation = 2 * time.Minute
+
+// A ConnectionTracker that stores nothing. Connection IDs are an HMAC of the source address and
+// the current rotation period, so any ID is accepted for at least Rotation after it's issued, and
+// at most twice that.
+type HmacConnectionTracker struct {
+	// Keys the HMAC. Changing it invalidates all outstanding connection IDs. Instances sharing a
+	// secret accept each other's connection IDs.
+	Secret []byte
+	// Length of each rotation period. Defaults to DefaultConnectionIdRotation.
+	Rotation time.Duration
+	// Overrides time.Now for testing.
+	now func() time.Time
+}
+
+var (
+	_ ConnectionTracker  = (*HmacConnectionTracker)(nil)
+	_ ConnectionIdIssuer = (*HmacConnectionTracker)(nil)
+)
+
+// Returns a HmacConnectionTracker with a random secret.
+func NewHmacConnectionTracker() *HmacConnectionTracker {
+	secret := make([]byte, sha256.Size)
+	_, err := rand.Read(secret)
+	if err != nil {
+		panic(err)
+	}
+	return &HmacConnectionTracker{Secret: secret}
+}
+
+func (me *HmacConnectionTracker) Issue(ctx context.Context, addr ConnectionTrackerAddr) (udp.ConnectionId, error) {
+	return me.connectionId(me.period(), addr), nil
+}
+
+// Does nothing, as connection IDs aren't stored. Connection IDs not from Issue won't pass Check.
+func (me *HmacConnectionTracker) Add(ctx context.Context, addr ConnectionTrackerAddr, id udp.ConnectionId) error {
+	return nil
+}
+
+func (me *HmacConnectionTracker) Check(ctx context.Context, addr ConnectionTrackerAddr, id udp.ConnectionId) (bool, error) {
+	period := me.period()
+	return hmac.Equal(connectionIdBytes(me.connectionId(period, addr)), connectionIdBytes(id)) ||
+		hmac.Equal(connectionIdBytes(me.connectionId(period-1, addr)), connectionIdBytes(id)), nil
+}
+
+func (me *HmacConnectionTracker) period() uint64 {
+	now := time.Now
+	if me.now != nil {
+		now = me.now
+	}
+	rotation := me.Rotation
+	if rotation <= 0 {
+		rotation = DefaultConnectionIdRotation
+	}
+	return uint64(now().UnixNano() / int64(rotation))
+}
+
+func (me *HmacConnectionTracker) connectionId(period uint64, addr ConnectionTrackerAddr) udp.ConnectionId {
+	mac := hmac.New(sha256.New, me.Secret)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], period)
+	mac.Write(b[:])
+	mac.Write([]byte(addr))
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
+
+func connectionIdBytes(id udp.ConnectionId) []byte {
+	return binary.BigEndian.AppendUint64(nil, id)
+}
@@ -0,0 +1,43 @@
+package udpTrackerServer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/go-quicktest/qt"
+)
+
+func TestHmacConnectionTrackerRotation(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_000_000, 0)
+	ct := NewHmacConnectionTracker()
+	ct.now = func() time.Time { return now }
+	const addr = "1.2.3.4:5678"
+	id, err := ct.Issue(ctx, addr)
+	qt.Assert(t, qt.IsNil(err))
+	check := func(addr ConnectionTrackerAddr) bool {
+		ok, err := ct.Check(ctx, addr, id)
+		qt.Assert(t, qt.IsNil(err))
+		return ok
+	}
+	qt.Check(t, qt.IsTrue(check(addr)))
+	qt.Check(t, qt.IsFalse(check("1.2.3.4:5679")))
+	now = now.Add(DefaultConnectionIdRotation)
+	qt.Check(t, qt.IsTrue(check(addr)))
+	now = now.Add(DefaultConnectionIdRotation)
+	qt.Check(t, qt.IsFalse(check(addr)))
+}
+
+func TestHmacConnectionTrackerSharedSecret(t *testing.T) {
+	ctx := context.Background()
+	a := NewHmacConnectionTracker()
+	b := &HmacConnectionTracker{Secret: a.Secret}
+	c := NewHmacConnectionTracker()
+	id, err := a.Issue(ctx, "[::1]:42")
+	qt.Assert(t, qt.IsNil(err))
+	ok, _ := b.Check(ctx, "[::1]:42", id)
+	qt.Check(t, qt.IsTrue(ok))
+	ok, _ = c.Check(ctx, "[::1]:42", id)
+	qt.Check(t, qt.IsFalse(ok))
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -37,8 +38,15 @@ type Server struct {
 	ConnTracker  ConnectionTracker
 	SendResponse func(ctx context.Context, data []byte, addr net.Addr) (int, error)
 	Announce     *trackerServer.AnnounceHandler
+	// Requests from sources over the limit are dropped without a response if this is non-nil.
+	RateLimiter *trackerServer.IpRateLimiter
+	// If non-zero, peers are omitted from announce responses to keep them within this many bytes.
+	MaxResponseSize int
 }
 
+// Returned by HandleRequest for requests dropped by the Server's RateLimiter.
+var ErrRateLimited = errors.New("rate limited")
+
 type RequestSourceAddr = net.Addr
 
 var tracer = otel.Tracer("torrent.tracker.udp")
@@ -57,6 +65,10 @@ func (me *Server) HandleRequest(
 			span.SetStatus(codes.Error, err.Error())
 		}
 	}()
+	if me.RateLimiter != nil && !me.RateLimiter.Allow(sourceIp(source)) {
+		span.SetAttributes(attribute.Bool("rate_limited", true))
+		return ErrRateLimited
+	}
 	var h udp.RequestHeader
 	var r bytes.Reader
 	r.Reset(body)
@@ -96,6 +108,7 @@ func (me *Server) handleAnnounce(
 		return err
 	}
 	if !ok {
+		me.sendError(ctx, source, tid, "connection ID expired")
 		return fmt.Errorf("incorrect connection id: %x", connId)
 	}
 	var req udp.AnnounceRequest
@@ -114,6 +127,10 @@ func (me *Server) handleAnnounce(
 		opts.MaxCount = generics.Some[uint](150)
 	}
 	res := me.Announce.Serve(ctx, req, announceAddr, opts)
+	if errors.Is(res.Err, trackerServer.ErrAnnounceTooFrequent) {
+		return me.sendError(ctx, source, tid, fmt.Sprintf(
+			"%v: minimum interval is %v seconds", res.Err, res.MinInterval.Value))
+	}
 	if res.Err != nil {
 		return res.Err
 	}
@@ -138,6 +155,9 @@ func (me *Server) handleAnnounce(
 			Port: int(p.Port()),
 		})
 	}
+	if me.MaxResponseSize != 0 {
+		nodeAddrs = capNodeAddrs(nodeAddrs, addrFamily, me.MaxResponseSize)
+	}
 	var buf bytes.Buffer
 	err = udp.Write(&buf, udp.ResponseHeader{
 		Action:        udp.ActionAnnounce,
@@ -146,8 +166,12 @@ func (me *Server) handleAnnounce(
 	if err != nil {
 		return err
 	}
+	interval := res.Interval.UnwrapOr(5 * 60)
+	if res.MinInterval.Ok && interval < res.MinInterval.Value {
+		interval = res.MinInterval.Value
+	}
 	err = udp.Write(&buf, udp.AnnounceResponseHeader{
-		Interval: res.Interval.UnwrapOr(5 * 60),
+		Interval: interval,
 		Seeders:  res.Seeders.Value,
 		Leechers: res.Leechers.Value,
 	})
@@ -170,13 +194,56 @@ func (me *Server) handleAnnounce(
 	return err
 }
 
-func (me *Server) handleConnect(ctx context.Context, source RequestSourceAddr, tid udp.TransactionId) error {
-	connId := randomConnectionId()
-	err := me.ConnTracker.Add(ctx, source.String(), connId)
+// Fixed size of an announce response before the peers.
+const announceResponseHeaderSize = 20
+
+// Truncates peers so the announce response fits in maxSize bytes.
+func capNodeAddrs(nodeAddrs []krpc.NodeAddr, family udp.AddrFamily, maxSize int) []krpc.NodeAddr {
+	peerSize := 6
+	if family == udp.AddrFamilyIpv6 {
+		peerSize = 18
+	}
+	maxPeers := max((maxSize-announceResponseHeaderSize)/peerSize, 0)
+	if len(nodeAddrs) > maxPeers {
+		nodeAddrs = nodeAddrs[:maxPeers]
+	}
+	return nodeAddrs
+}
+
+// Sends an error response to source. The returned error only concerns sending the response.
+func (me *Server) sendError(ctx context.Context, source RequestSourceAddr, tid udp.TransactionId, msg string) error {
+	var buf bytes.Buffer
+	udp.Write(&buf, udp.ResponseHeader{
+		Action:        udp.ActionError,
+		TransactionId: tid,
+	})
+	buf.WriteString(msg)
+	n, err := me.SendResponse(ctx, buf.Bytes(), source)
 	if err != nil {
-		err = fmt.Errorf("recording conn id: %w", err)
 		return err
 	}
+	if n < buf.Len() {
+		err = io.ErrShortWrite
+	}
+	return err
+}
+
+func (me *Server) handleConnect(ctx context.Context, source RequestSourceAddr, tid udp.TransactionId) (err error) {
+	var connId udp.ConnectionId
+	if issuer, ok := me.ConnTracker.(ConnectionIdIssuer); ok {
+		connId, err = issuer.Issue(ctx, source.String())
+		if err != nil {
+			err = fmt.Errorf("issuing conn id: %w", err)
+			return err
+		}
+	} else {
+		connId = randomConnectionId()
+		err = me.ConnTracker.Add(ctx, source.String(), connId)
+		if err != nil {
+			err = fmt.Errorf("recording conn id: %w", err)
+			return err
+		}
+	}
 	var buf bytes.Buffer
 	udp.Write(&buf, udp.ResponseHeader{
 		Action:        udp.ActionConnect,
@@ -202,6 +269,14 @@ func randomConnectionId() udp.ConnectionId {
 	return binary.BigEndian.Uint64(b[:])
 }
 
+func sourceIp(source RequestSourceAddr) netip.Addr {
+	if udpAddr, ok := source.(*net.UDPAddr); ok {
+		return udpAddr.AddrPort().Addr()
+	}
+	addrPort, _ := netip.ParseAddrPort(source.String())
+	return addrPort.Addr()
+}
+
 func RunSimple(ctx context.Context, s *Server, pc net.PacketConn, family udp.AddrFamily) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -233,7 +308,7 @@ func RunSimple(ctx context.Context, s *Server, pc net.PacketConn, family udp.Add
 			defer span.End()
 			defer func() { <-sem }()
 			err := s.HandleRequest(ctx, family, addr, b)
-			if err != nil {
+			if err != nil && !errors.Is(err, ErrRateLimited) {
 				log.Printf("error handling %v byte request from %v: %v", n, addr, err)
 			}
 		}()
@@ -30,6 +30,8 @@ type trackerScraper struct {
 	stopCh           chan struct{}
 	originalUrl      string
 	consecutiveFails int
+	// Set by the Client's tracker scrapes. Protected by the Client lock.
+	lastScrape trackerScrapeResult
 }
 
 type torrentTrackerAnnouncer interface {
@@ -201,13 +203,13 @@ func (me *trackerScraper) announce(
 
 // Returns whether we can shorten the interval, and sets notify to a channel that receives when we
 // might change our mind, or leaves it if we won't.
-func (me *trackerScraper) canIgnoreInterval(notify *<-chan struct{}) bool {
-	gotInfo := me.t.GotInfo()
+func (t *Torrent) canIgnoreTrackerInterval(notify *<-chan struct{}) bool {
+	gotInfo := t.GotInfo()
 	select {
 	case <-gotInfo:
 		// Private trackers really don't like us announcing more than they specify. They're also
 		// tracking us very carefully, so it's best to comply.
-		private := me.t.info.Private
+		private := t.info.Private
 		return private == nil || !*private
 	default:
 		*notify = gotInfo
@@ -215,6 +217,42 @@ func (me *trackerScraper) canIgnoreInterval(notify *<-chan struct{}) bool {
 	}
 }
 
+// Call with the Client lock held.
+func (me *trackerScraper) status(tier int) TrackerStatus {
+	status := TrackerStatus{
+		URL:              me.originalUrl,
+		Tier:             tier,
+		LastError:        me.lastAnnounce.Err,
+		LastAnnounce:     me.lastAnnounce.Completed,
+		NumPeers:         me.lastAnnounce.NumPeers,
+		Seeders:          me.lastAnnounce.Seeders,
+		Leechers:         me.lastAnnounce.Leechers,
+		Interval:         me.lastAnnounce.Interval,
+		ConsecutiveFails: me.consecutiveFails,
+		Completed:        me.lastScrape.Completed,
+		LastScrape:       me.lastScrape.Time,
+		LastScrapeError:  me.lastScrape.Err,
+	}
+	if me.lastScrape.Err == nil && me.lastScrape.Time.After(me.lastAnnounce.Completed) {
+		status.Seeders = me.lastScrape.Seeders
+		status.Leechers = me.lastScrape.Leechers
+	}
+	if !me.lastAnnounce.Completed.IsZero() && me.lastAnnounce.Interval > 0 {
+		status.NextAnnounce = me.lastAnnounce.Completed.Add(me.lastAnnounce.Interval)
+	}
+	return status
+}
+
+// Records the result of an announce. Call with the Client lock held.
+func (me *trackerScraper) setLastAnnounce(ar trackerAnnounceResult) {
+	me.lastAnnounce = ar
+	if ar.Err != nil {
+		me.consecutiveFails++
+	} else {
+		me.consecutiveFails = 0
+	}
+}
+
 func (me *trackerScraper) Stop() {
 	me.stopOnce.Do(func() {
 		close(me.stopCh)
@@ -242,58 +280,66 @@ func (me *trackerScraper) Run() {
 		// after first announce, get back to regular "none"
 		e = tracker.None
 		me.t.cl.lock()
-		me.lastAnnounce = ar
-		if ar.Err != nil {
-			me.consecutiveFails++
-		} else {
-			me.consecutiveFails = 0
-		}
+		me.setLastAnnounce(ar)
 		me.t.cl.unlock()
 
-	recalculate:
-		// Make sure we don't announce for at least a minute since the last one.
-		interval := ar.Interval
-		if interval < time.Minute {
-			interval = time.Minute
+		if !me.t.waitForNextTrackerAnnounce(ar, me.consecutiveFails, me.stopCh) {
+			return
 		}
+	}
+}
 
-		me.t.cl.lock()
-		wantPeers := me.t.wantPeersEvent.C()
-		me.t.cl.unlock()
+// Waits until the next announce is due following the announce result ar. Returns false if the
+// announcer should stop instead.
+func (t *Torrent) waitForNextTrackerAnnounce(
+	ar trackerAnnounceResult,
+	consecutiveFails int,
+	stopCh <-chan struct{},
+) bool {
+recalculate:
+	// Make sure we don't announce for at least a minute since the last one.
+	interval := ar.Interval
+	if interval < time.Minute {
+		interval = time.Minute
+	}
 
-		// A channel that receives when we should reconsider our interval. Starts as nil since that
-		// never receives.
-		var reconsider <-chan struct{}
-		select {
-		case <-wantPeers:
-			if interval > time.Minute && me.canIgnoreInterval(&reconsider) {
-				interval = time.Minute
-			}
-		default:
-			reconsider = wantPeers
-		}
+	t.cl.lock()
+	wantPeers := t.wantPeersEvent.C()
+	t.cl.unlock()
 
-		// Exponential backoff for failing trackers: 2m, 4m, 8m cap.
-		// Applied AFTER wantPeers override so backoff always wins —
-		// hammering a failing tracker every minute won't find peers.
-		if me.consecutiveFails > 0 {
-			backoff := time.Duration(1<<min(me.consecutiveFails, 3)) * time.Minute
-			if backoff > interval {
-				interval = backoff
-			}
+	// A channel that receives when we should reconsider our interval. Starts as nil since that
+	// never receives.
+	var reconsider <-chan struct{}
+	select {
+	case <-wantPeers:
+		if interval > time.Minute && t.canIgnoreTrackerInterval(&reconsider) {
+			interval = time.Minute
 		}
+	default:
+		reconsider = wantPeers
+	}
 
-		select {
-		case <-me.stopCh:
-			return
-		case <-me.t.closed.Done():
-			return
-		case <-reconsider:
-			// Recalculate the interval.
-			goto recalculate
-		case <-time.After(time.Until(ar.Completed.Add(interval))):
+	// Exponential backoff for failing trackers: 2m, 4m, 8m cap.
+	// Applied AFTER wantPeers override so backoff always wins —
+	// hammering a failing tracker every minute won't find peers.
+	if consecutiveFails > 0 {
+		backoff := time.Duration(1<<min(consecutiveFails, 3)) * time.Minute
+		if backoff > interval {
+			interval = backoff
 		}
 	}
+
+	select {
+	case <-stopCh:
+		return false
+	case <-t.closed.Done():
+		return false
+	case <-reconsider:
+		// Recalculate the interval.
+		goto recalculate
+	case <-time.After(time.Until(ar.Completed.Add(interval))):
+	}
+	return true
 }
 
 func (me *trackerScraper) announceStopped() {
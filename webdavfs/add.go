@@ -0,0 +1,93 @@
+package webdavfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// The largest .torrent or .magnet file that can be written.
+const maxAddFileSize = 16 << 20
+
+var errAddFileTooLarge = errors.New("file too large to add as a torrent")
+
+// Opens a file written to add a torrent. Only .torrent and .magnet files in the root directory
+// can be written, and only when Options.Writable.
+func (me *FileSystem) openForAdd(name string) (*addFile, error) {
+	name = path.Clean("/" + name)
+	dir, base := path.Split(name)
+	ext := path.Ext(base)
+	if !me.opts.Writable || dir != "/" || (ext != ".torrent" && ext != ".magnet") {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return &addFile{
+		fs:   me,
+		name: base,
+	}, nil
+}
+
+// A .torrent or .magnet file being written. The torrent is added when it's closed. It doesn't
+// appear in the filesystem itself.
+type addFile struct {
+	fs   *FileSystem
+	name string
+	buf  bytes.Buffer
+}
+
+func (f *addFile) Write(b []byte) (int, error) {
+	if f.buf.Len()+len(b) > maxAddFileSize {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: errAddFileTooLarge}
+	}
+	return f.buf.Write(b)
+}
+
+func (f *addFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrPermission}
+}
+
+func (f *addFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+}
+
+func (f *addFile) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: fs.ErrInvalid}
+}
+
+func (f *addFile) Stat() (fs.FileInfo, error) {
+	return fileInfo{
+		name:    f.name,
+		size:    int64(f.buf.Len()),
+		modTime: f.fs.modTime,
+	}, nil
+}
+
+func (f *addFile) Close() error {
+	if f.buf.Len() == 0 {
+		// Clients can create empty files to lock names before writing to them.
+		return nil
+	}
+	err := f.add()
+	if err != nil {
+		return fmt.Errorf("adding torrent from %q: %w", f.name, err)
+	}
+	return nil
+}
+
+func (f *addFile) add() error {
+	cl := f.fs.cl
+	if path.Ext(f.name) == ".magnet" {
+		_, err := cl.AddMagnet(strings.TrimSpace(f.buf.String()))
+		return err
+	}
+	mi, err := metainfo.Load(&f.buf)
+	if err != nil {
+		return err
+	}
+	_, err = cl.AddTorrent(mi)
+	return err
+}
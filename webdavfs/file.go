@@ -0,0 +1,143 @@
+package webdavfs
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/internal/httpfile"
+)
+
+type fileInfo struct {
+	name string
+	size int64
+	dir  bool
+	// Set for files in torrents.
+	etag    string
+	modTime time.Time
+}
+
+var (
+	_ os.FileInfo         = fileInfo{}
+	_ webdav.ETager       = fileInfo{}
+	_ webdav.ContentTyper = fileInfo{}
+)
+
+func (fi fileInfo) Name() string {
+	return fi.name
+}
+
+func (fi fileInfo) Size() int64 {
+	return fi.size
+}
+
+func (fi fileInfo) Mode() fs.FileMode {
+	if fi.IsDir() {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+func (fi fileInfo) ModTime() time.Time {
+	return fi.modTime
+}
+
+func (fi fileInfo) IsDir() bool {
+	return fi.dir
+}
+
+func (fi fileInfo) Sys() any {
+	return nil
+}
+
+func (fi fileInfo) ETag(context.Context) (string, error) {
+	if fi.etag == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return fi.etag, nil
+}
+
+func (fi fileInfo) ContentType(context.Context) (string, error) {
+	return httpfile.ContentType(fi.name), nil
+}
+
+// A file in a torrent open for reading.
+type torrentFile struct {
+	fi fileInfo
+	r  torrent.Reader
+}
+
+func (f *torrentFile) Read(b []byte) (int, error) {
+	return f.r.Read(b)
+}
+
+func (f *torrentFile) Seek(offset int64, whence int) (int64, error) {
+	return f.r.Seek(offset, whence)
+}
+
+func (f *torrentFile) Close() error {
+	return f.r.Close()
+}
+
+func (f *torrentFile) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.fi.name, Err: fs.ErrInvalid}
+}
+
+func (f *torrentFile) Stat() (fs.FileInfo, error) {
+	return f.fi, nil
+}
+
+func (f *torrentFile) Write([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.fi.name, Err: fs.ErrPermission}
+}
+
+// An open directory. The entries are read when it's opened.
+type dirFile struct {
+	fi      fileInfo
+	entries []fs.FileInfo
+	pos     int
+}
+
+func (f *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.fi.name, Err: fs.ErrInvalid}
+}
+
+func (f *dirFile) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekStart {
+		f.pos = 0
+		return 0, nil
+	}
+	return 0, &fs.PathError{Op: "seek", Path: f.fi.name, Err: fs.ErrInvalid}
+}
+
+func (f *dirFile) Close() error {
+	return nil
+}
+
+// Per http.File and os.File.Readdir.
+func (f *dirFile) Readdir(count int) ([]fs.FileInfo, error) {
+	rest := f.entries[f.pos:]
+	if count <= 0 {
+		f.pos = len(f.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(rest))
+	f.pos += n
+	return rest[:n], nil
+}
+
+func (f *dirFile) Stat() (fs.FileInfo, error) {
+	return f.fi, nil
+}
+
+func (f *dirFile) Write([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.fi.name, Err: fs.ErrPermission}
+}
@@ -0,0 +1,245 @@
+// Package webdavfs exposes a Client's torrents as a WebDAV filesystem, for streaming access where
+// FUSE isn't available. The root directory contains an entry for each torrent with info, named for
+// the torrent as in torrent.File.Path, so single-file torrents appear as files and others as
+// directories of their file trees. File data is read through torrent.Readers, so it's downloaded as
+// it's read.
+package webdavfs
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/internal/httpfile"
+)
+
+type Options struct {
+	// Allow torrents to be added by writing .torrent files, or .magnet files containing a magnet
+	// link, to the root directory, and to be dropped by deleting them from the root directory.
+	Writable bool
+}
+
+// A webdav.FileSystem of the torrents in a Client.
+type FileSystem struct {
+	cl   *torrent.Client
+	opts Options
+	// Reported as the modification time of everything, since torrent data doesn't change.
+	modTime time.Time
+}
+
+var _ webdav.FileSystem = (*FileSystem)(nil)
+
+func New(cl *torrent.Client, opts Options) *FileSystem {
+	return &FileSystem{
+		cl:      cl,
+		opts:    opts,
+		modTime: time.Now(),
+	}
+}
+
+// Returns a WebDAV handler serving the FileSystem, with in-memory locks.
+func (me *FileSystem) Handler() http.Handler {
+	h := &webdav.Handler{
+		FileSystem: me,
+		LockSystem: webdav.NewMemLS(),
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			w.Header().Set("Content-Type", httpfile.ContentType(r.URL.Path))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Returns the torrents with info by their root directory entry name. Torrents with the same name
+// are told apart by their infohashes.
+func (me *FileSystem) roots() map[string]*torrent.Torrent {
+	byName := make(map[string][]*torrent.Torrent)
+	for _, t := range me.cl.Torrents() {
+		if t.Info() == nil {
+			continue
+		}
+		name := t.Info().BestName()
+		byName[name] = append(byName[name], t)
+	}
+	ret := make(map[string]*torrent.Torrent, len(byName))
+	for name, ts := range byName {
+		if len(ts) == 1 {
+			ret[name] = ts[0]
+			continue
+		}
+		for _, t := range ts {
+			ret[name+" ["+t.InfoHash().HexString()+"]"] = t
+		}
+	}
+	return ret
+}
+
+// A file or directory in the filesystem.
+type node struct {
+	// Name within the root directory for the torrent, if it's not the root directory.
+	rootName string
+	t        *torrent.Torrent
+	// The path within the torrent, as in torrent.File.Path.
+	torrentPath string
+	// Set for files.
+	file *torrent.File
+}
+
+func (n node) isDir() bool {
+	return n.file == nil
+}
+
+func (me *FileSystem) stat(n node) fileInfo {
+	fi := fileInfo{
+		name:    path.Base("/" + n.torrentPath),
+		dir:     n.isDir(),
+		modTime: me.modTime,
+	}
+	if n.rootName != "" && !strings.Contains(n.torrentPath, "/") {
+		fi.name = n.rootName
+	}
+	if n.file != nil {
+		fi.size = n.file.Length()
+		fi.etag = httpfile.ETag(n.file)
+	}
+	return fi
+}
+
+func isPadding(f *torrent.File) bool {
+	return strings.Contains(f.FileInfo().Attr, "p")
+}
+
+func (me *FileSystem) lookup(name string) (node, error) {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return node{}, nil
+	}
+	rootName, rest, _ := strings.Cut(name, "/")
+	t, ok := me.roots()[rootName]
+	if !ok {
+		return node{}, fs.ErrNotExist
+	}
+	n := node{
+		rootName:    rootName,
+		t:           t,
+		torrentPath: path.Join(t.Info().BestName(), rest),
+	}
+	for _, f := range t.Files() {
+		if isPadding(f) {
+			continue
+		}
+		if f.Path() == n.torrentPath {
+			n.file = f
+			return n, nil
+		}
+		if strings.HasPrefix(f.Path(), n.torrentPath+"/") {
+			return n, nil
+		}
+	}
+	return node{}, fs.ErrNotExist
+}
+
+// Returns the entries of a directory node.
+func (me *FileSystem) readDir(n node) (entries []os.FileInfo) {
+	if n.t == nil {
+		for rootName, t := range me.roots() {
+			var file *torrent.File
+			if !t.Info().IsDir() {
+				file = t.Files()[0]
+			}
+			entries = append(entries, me.stat(node{
+				rootName:    rootName,
+				t:           t,
+				torrentPath: t.Info().BestName(),
+				file:        file,
+			}))
+		}
+	} else {
+		seenDirs := make(map[string]struct{})
+		for _, f := range n.t.Files() {
+			rest, ok := strings.CutPrefix(f.Path(), n.torrentPath+"/")
+			if !ok || isPadding(f) {
+				continue
+			}
+			childName, _, isDir := strings.Cut(rest, "/")
+			child := node{
+				t:           n.t,
+				torrentPath: n.torrentPath + "/" + childName,
+			}
+			if isDir {
+				if _, ok := seenDirs[childName]; ok {
+					continue
+				}
+				seenDirs[childName] = struct{}{}
+			} else {
+				child.file = f
+			}
+			entries = append(entries, me.stat(child))
+		}
+	}
+	slices.SortFunc(entries, func(a, b os.FileInfo) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return
+}
+
+func (me *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	n, err := me.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return me.stat(n), nil
+}
+
+func (me *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return me.openForAdd(name)
+	}
+	n, err := me.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if n.isDir() {
+		return &dirFile{
+			fi:      me.stat(n),
+			entries: me.readDir(n),
+		}, nil
+	}
+	r := n.file.NewReader()
+	// Reads stop waiting for data when the request is done.
+	r.SetContext(ctx)
+	return &torrentFile{
+		fi: me.stat(n),
+		r:  r,
+	}, nil
+}
+
+func (me *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	n, err := me.lookup(name)
+	if err != nil {
+		// Per os.RemoveAll.
+		return nil
+	}
+	if !me.opts.Writable || n.t == nil || strings.Contains(n.torrentPath, "/") {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+	}
+	n.t.Drop()
+	return nil
+}
+
+func (me *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrPermission}
+}
+
+func (me *FileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: fs.ErrPermission}
+}
@@ -0,0 +1,159 @@
+package webdavfs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+var videoData = func() []byte {
+	b := make([]byte, 100<<10)
+	rand.New(rand.NewSource(1)).Read(b)
+	return b
+}()
+
+// Creates a torrent of a "movie" directory, and a client with its data.
+func newSeeder(t *testing.T) (*torrent.Client, *metainfo.MetaInfo) {
+	dataDir := t.TempDir()
+	root := filepath.Join(dataDir, "movie")
+	qt.Assert(t, qt.IsNil(os.MkdirAll(filepath.Join(root, "sub"), 0o755)))
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(root, "video.mp4"), videoData, 0o644)))
+	qt.Assert(t, qt.IsNil(os.WriteFile(filepath.Join(root, "sub", "notes.txt"), []byte("notes\n"), 0o644)))
+	info := metainfo.Info{PieceLength: 16 << 10}
+	qt.Assert(t, qt.IsNil(info.BuildFromFilePath(root)))
+	mi := &metainfo.MetaInfo{InfoBytes: bencode.MustMarshal(&info)}
+	cfg := torrent.TestingConfig(t)
+	cfg.DataDir = dataDir
+	cl, err := torrent.NewClient(cfg)
+	qt.Assert(t, qt.IsNil(err))
+	t.Cleanup(func() { cl.Close() })
+	tor, err := cl.AddTorrent(mi)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(tor.VerifyData()))
+	<-tor.Complete().On()
+	return cl, mi
+}
+
+func names(fis []os.FileInfo) (ret []string) {
+	for _, fi := range fis {
+		name := fi.Name()
+		if fi.IsDir() {
+			name += "/"
+		}
+		ret = append(ret, name)
+	}
+	return
+}
+
+func TestBrowseAndRead(t *testing.T) {
+	cl, _ := newSeeder(t)
+	fs := New(cl, Options{})
+	ctx := context.Background()
+	fi, err := fs.Stat(ctx, "/")
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.IsTrue(fi.IsDir()))
+	f, err := fs.OpenFile(ctx, "/", os.O_RDONLY, 0)
+	qt.Assert(t, qt.IsNil(err))
+	fis, err := f.Readdir(-1)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(names(fis), []string{"movie/"}))
+	f, err = fs.OpenFile(ctx, "/movie", os.O_RDONLY, 0)
+	qt.Assert(t, qt.IsNil(err))
+	fis, err = f.Readdir(1)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(names(fis), []string{"sub/"}))
+	fis, err = f.Readdir(1)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.DeepEquals(names(fis), []string{"video.mp4"}))
+	qt.Check(t, qt.Equals(fis[0].Size(), int64(len(videoData))))
+	_, err = f.Readdir(1)
+	qt.Check(t, qt.Equals(err, io.EOF))
+	_, err = fs.Stat(ctx, "/movie/missing")
+	qt.Check(t, qt.ErrorIs(err, os.ErrNotExist))
+
+	f, err = fs.OpenFile(ctx, "/movie/sub/notes.txt", os.O_RDONLY, 0)
+	qt.Assert(t, qt.IsNil(err))
+	b, err := io.ReadAll(f)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.Equals(string(b), "notes\n"))
+	qt.Check(t, qt.IsNil(f.Close()))
+	_, err = fs.OpenFile(ctx, "/movie/sub/notes.txt", os.O_RDWR, 0)
+	qt.Check(t, qt.ErrorIs(err, os.ErrPermission))
+
+	srv := httptest.NewServer(fs.Handler())
+	defer srv.Close()
+	req, _ := http.NewRequest("PROPFIND", srv.URL+"/movie/", nil)
+	req.Header.Set("Depth", "1")
+	resp, err := http.DefaultClient.Do(req)
+	qt.Assert(t, qt.IsNil(err))
+	b, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	qt.Check(t, qt.Equals(resp.StatusCode, http.StatusMultiStatus))
+	qt.Check(t, qt.StringContains(string(b), "/movie/video.mp4"))
+	qt.Check(t, qt.StringContains(string(b), "video/mp4"))
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/movie/video.mp4", nil)
+	req.Header.Set("Range", "bytes=30000-30999")
+	resp, err = http.DefaultClient.Do(req)
+	qt.Assert(t, qt.IsNil(err))
+	b, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	qt.Check(t, qt.Equals(resp.StatusCode, http.StatusPartialContent))
+	qt.Check(t, qt.Equals(resp.Header.Get("Content-Type"), "video/mp4"))
+	qt.Check(t, qt.DeepEquals(b, videoData[30000:31000]))
+}
+
+func do(t *testing.T, method, url string, body []byte) int {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	qt.Assert(t, qt.IsNil(err))
+	resp, err := http.DefaultClient.Do(req)
+	qt.Assert(t, qt.IsNil(err))
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestWritable(t *testing.T) {
+	_, mi := newSeeder(t)
+	cl, err := torrent.NewClient(torrent.TestingConfig(t))
+	qt.Assert(t, qt.IsNil(err))
+	defer cl.Close()
+	var miBuf bytes.Buffer
+	qt.Assert(t, qt.IsNil(mi.Write(&miBuf)))
+
+	readOnly := httptest.NewServer(New(cl, Options{}).Handler())
+	defer readOnly.Close()
+	qt.Check(t, qt.Not(qt.Equals(do(t, http.MethodPut, readOnly.URL+"/movie.torrent", miBuf.Bytes()), http.StatusCreated)))
+	qt.Check(t, qt.HasLen(cl.Torrents(), 0))
+
+	fs := New(cl, Options{Writable: true})
+	srv := httptest.NewServer(fs.Handler())
+	defer srv.Close()
+	qt.Check(t, qt.Not(qt.Equals(do(t, http.MethodPut, srv.URL+"/movie.txt", []byte("hi")), http.StatusCreated)))
+	qt.Check(t, qt.Equals(do(t, http.MethodPut, srv.URL+"/movie.torrent", miBuf.Bytes()), http.StatusCreated))
+	fi, err := fs.Stat(context.Background(), "/movie")
+	qt.Assert(t, qt.IsNil(err))
+	qt.Check(t, qt.IsTrue(fi.IsDir()))
+	// Files within torrents can't be removed.
+	qt.Check(t, qt.Not(qt.Equals(do(t, http.MethodDelete, srv.URL+"/movie/video.mp4", nil), http.StatusNoContent)))
+	qt.Check(t, qt.Equals(do(t, http.MethodDelete, srv.URL+"/movie", nil), http.StatusNoContent))
+	qt.Check(t, qt.HasLen(cl.Torrents(), 0))
+
+	ih := mi.HashInfoBytes()
+	magnet := mi.Magnet(&ih, nil).String()
+	qt.Check(t, qt.Equals(do(t, http.MethodPut, srv.URL+"/movie.magnet", []byte(magnet+"\n")), http.StatusCreated))
+	_, ok := cl.Torrent(ih)
+	qt.Check(t, qt.IsTrue(ok))
+	qt.Check(t, qt.Not(qt.Equals(do(t, http.MethodPut, srv.URL+"/bad.torrent", []byte(strings.Repeat("x", 10))), http.StatusCreated)))
+}
@@ -0,0 +1,6 @@
+//go:build !linux
+
+package torrent
+
+// Zero-copy uploads are only implemented for Linux.
+const zeroCopyUploadsSupported = false
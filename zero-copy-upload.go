@@ -0,0 +1,113 @@
+package torrent
+
+import (
+	"io"
+	"net"
+	"os"
+
+	g "github.com/anacrolix/generics"
+
+	"github.com/anacrolix/torrent/storage"
+)
+
+// Data for a peer request that's ready to be sent. Either the bytes, or where they are in a file,
+// to be sent to the connection without copying them through memory.
+type peerRequestData struct {
+	b    []byte
+	file g.Option[storage.FileSection]
+}
+
+// Whether chunks can be sent to the peer directly from files. The data must go to a TCP socket
+// unmodified, so this isn't possible with MSE or uTP. Upload rate limiting applies to whole chunks
+// before they're sent, so it isn't affected.
+func (c *PeerConn) zeroCopyUploads() bool {
+	if !zeroCopyUploadsSupported || c.t.cl.config.DisableZeroCopyUploads || c.headerEncrypted {
+		return false
+	}
+	_, ok := c.conn.(*net.TCPConn)
+	return ok
+}
+
+// Returns where the data for a peer request is in a file, if it can be sent from there. Called
+// without the Client lock.
+func (c *PeerConn) peerRequestFileSection(r Request) (_ storage.FileSection, ok bool) {
+	if !c.zeroCopyUploads() {
+		return
+	}
+	t := c.t
+	t.storageLock.RLock()
+	defer t.storageLock.RUnlock()
+	if t.closed.IsSet() || t.storage == nil {
+		return
+	}
+	sectioner, ok := t.storage.PieceWithHash(t.info.Piece(int(r.Index)), g.None[[]byte]()).
+		PieceImpl.(storage.PieceFileSectioner)
+	if !ok {
+		return
+	}
+	return sectioner.FileSection(int64(r.Begin), int64(r.Length))
+}
+
+// Buffers a piece message for a chunk that's sent from a file.
+func (c *PeerConn) sendFileChunk(r Request, section storage.FileSection) (more bool) {
+	more = c.messageWriter.writeFileChunkMsg(r, peerConnMsgWriterFileChunk{
+		section:       section,
+		length:        r.Length.Int(),
+		torrentOffset: c.t.requestOffset(r),
+	})
+	c.modifyRelevantConnStats(func(cs *ConnStats) { cs.wroteChunk(int64(r.Length)) })
+	c.tickleWriter()
+	return
+}
+
+// Writes a chunk from its file to the connection. The message header has already been written, so
+// if the file has gone, the chunk is read from storage instead. Called by the message writer.
+func (c *PeerConn) writeFileChunk(fc peerConnMsgWriterFileChunk) error {
+	f, err := c.openZeroCopyFile(fc.section.Name)
+	if err == nil {
+		_, err = f.Seek(fc.section.Offset, io.SeekStart)
+	}
+	if err != nil {
+		c.slogger.Debug("reading chunk from storage instead of file", "err", err)
+		return c.writeChunkFromStorage(fc)
+	}
+	n, err := c.conn.(*net.TCPConn).ReadFrom(&io.LimitedReader{R: f, N: int64(fc.length)})
+	c.wroteBytes(n)
+	if err == nil && n != int64(fc.length) {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (c *PeerConn) writeChunkFromStorage(fc peerConnMsgWriterFileChunk) error {
+	b := make([]byte, fc.length)
+	n, err := c.t.readAt(b, fc.torrentOffset)
+	if n != len(b) {
+		return err
+	}
+	_, err = c.w.Write(b)
+	return err
+}
+
+// Returns the file, reusing the last one if it has the same name, as consecutive chunks are usually
+// from the same file.
+func (c *PeerConn) openZeroCopyFile(name string) (*os.File, error) {
+	if c.zeroCopyFile != nil && c.zeroCopyFileName == name {
+		return c.zeroCopyFile, nil
+	}
+	c.closeZeroCopyFile()
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	c.zeroCopyFile = f
+	c.zeroCopyFileName = name
+	return f, nil
+}
+
+func (c *PeerConn) closeZeroCopyFile() {
+	if c.zeroCopyFile != nil {
+		c.zeroCopyFile.Close()
+		c.zeroCopyFile = nil
+	}
+}
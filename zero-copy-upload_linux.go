@@ -0,0 +1,4 @@
+package torrent
+
+// Sending from a file to a TCP connection uses sendfile.
+const zeroCopyUploadsSupported = true
@@ -0,0 +1,96 @@
+package torrent
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/anacrolix/chansync"
+	"github.com/go-quicktest/qt"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// File chunks are written between the buffered messages in the order they were buffered.
+func TestMsgWriterFileChunks(t *testing.T) {
+	files := map[string][]byte{
+		"a": []byte("hello, world"),
+		"b": []byte("goodbye"),
+	}
+	var (
+		out    bytes.Buffer
+		closed chansync.SetOnce
+		fills  int
+	)
+	w := &peerConnMsgWriter{
+		fillWriteBuffer: func() {
+			fills++
+			if fills > 1 {
+				closed.Set()
+			}
+		},
+		closed:      &closed,
+		w:           &out,
+		keepAlive:   func() bool { return false },
+		writeBuffer: new(peerConnMsgWriterBuffer),
+		writeFileChunk: func(fc peerConnMsgWriterFileChunk) error {
+			b := files[fc.section.Name]
+			_, err := out.Write(b[fc.section.Offset:][:fc.length])
+			return err
+		},
+	}
+	w.write(pp.Message{Type: pp.Have, Index: 3})
+	w.writeFileChunkMsg(Request{Index: 1, ChunkSpec: ChunkSpec{Begin: 2, Length: 5}},
+		peerConnMsgWriterFileChunk{section: storage.FileSection{Name: "a", Offset: 7}, length: 5})
+	w.writeFileChunkMsg(Request{Index: 1, ChunkSpec: ChunkSpec{Begin: 7, Length: 4}},
+		peerConnMsgWriterFileChunk{section: storage.FileSection{Name: "b", Offset: 0}, length: 4})
+	w.write(pp.Message{Type: pp.Piece, Index: 2, Piece: []byte("memory")})
+	w.run(0)
+	qt.Check(t, qt.Equals(w.totalDataBytesWritten, 15))
+	d := pp.Decoder{R: bufio.NewReader(&out), MaxLength: 1 << 10}
+	var msgs []pp.Message
+	for {
+		var msg pp.Message
+		err := d.Decode(&msg)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		qt.Assert(t, qt.IsNil(err))
+		msgs = append(msgs, msg)
+	}
+	qt.Assert(t, qt.HasLen(msgs, 4))
+	qt.Check(t, qt.Equals(msgs[0].Type, pp.Have))
+	qt.Check(t, qt.Equals(msgs[0].Index, 3))
+	qt.Check(t, qt.Equals(string(msgs[1].Piece), "world"))
+	qt.Check(t, qt.Equals(msgs[1].Begin, 2))
+	qt.Check(t, qt.Equals(string(msgs[2].Piece), "good"))
+	qt.Check(t, qt.Equals(msgs[2].Begin, 7))
+	qt.Check(t, qt.Equals(string(msgs[3].Piece), "memory"))
+}
+
+func TestZeroCopyUploadTransfer(t *testing.T) {
+	if !zeroCopyUploadsSupported {
+		t.Skip("zero-copy uploads not supported")
+	}
+	var seederConns []*PeerConn
+	plainTcp := func(cfg *ClientConfig) {
+		cfg.HeaderObfuscationPolicy = HeaderObfuscationPolicy{}
+		cfg.DisableUTP = true
+	}
+	testClientTransfer(t, testClientTransferParams{
+		ConfigureSeeder: ConfigureClient{
+			Config: func(cfg *ClientConfig) {
+				plainTcp(cfg)
+				cfg.Callbacks.PeerConnAdded = append(cfg.Callbacks.PeerConnAdded, func(pc *PeerConn) {
+					seederConns = append(seederConns, pc)
+					qt.Check(t, qt.IsTrue(pc.zeroCopyUploads()))
+				})
+			},
+		},
+		ConfigureLeecher: ConfigureClient{Config: plainTcp},
+	})
+	qt.Check(t, qt.Not(qt.HasLen(seederConns, 0)))
+}